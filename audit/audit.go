@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Типы событий журнала безопасности
+const (
+	EventLoginFailed     = "login_failed"
+	EventLoginBlocked    = "login_blocked"
+	EventAccountLocked   = "account_locked"
+	EventIPLocked        = "ip_locked"
+	EventLoginAfterFails = "login_after_failures"
+)
+
+type Event struct {
+	Type    string
+	UserID  string
+	IP      string
+	Details map[string]interface{}
+}
+
+type Logger interface {
+	Log(ctx context.Context, event Event)
+}
+
+// SQLLogger пишет события в таблицу audit_log. Ошибки записи только логируются:
+// журнал не должен ломать основной запрос
+type SQLLogger struct {
+	DB *sql.DB
+}
+
+func (logger *SQLLogger) Log(ctx context.Context, event Event) {
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		details = []byte("{}")
+	}
+
+	var userID sql.NullString
+	if event.UserID != "" {
+		userID = sql.NullString{String: event.UserID, Valid: true}
+	}
+
+	_, err = logger.DB.ExecContext(ctx, `
+		INSERT INTO audit_log (event_type, user_id, ip_address, details, created_at)
+		VALUES (?, ?, ?, ?, ?)`, event.Type, userID, event.IP, string(details), time.Now())
+	if err != nil {
+		log.Println("audit: failed to write event", event.Type, ":", err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Edafi/MusicVibe/handlers"
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/reconcile"
+	"github.com/Edafi/MusicVibe/repository"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Административные команды: go run . <команда> [флаги].
+// Все команды читают ту же конфигурацию, что и сервер
+type command struct {
+	Summary string
+	Run     func(ctx context.Context, app *App, args []string) error
+}
+
+var commands = map[string]command{
+	"serve":             {"start the HTTP server (default)", serve},
+	"migrate":           {"apply pending schema migrations and Mongo indexes", migrateCommand},
+	"seed":              {"insert demo genres, users, an artist, an album and tracks", seedCommand},
+	"create-admin":      {"create an admin user or promote an existing one", createAdminCommand},
+	"reindex":           {"rebuild lower-case search columns", reindexCommand},
+	"recompute-streams": {"recompute track stream counts from the stream log", recomputeStreamsCommand},
+	"recompute-charts":  {"rebuild the track chart from recent streams", recomputeChartsCommand},
+	"verify-storage":    {"compare stored objects with track, album and profile rows", verifyStorageCommand},
+	"purge":             {"permanently remove soft-deleted albums and tracks", purgeCommand},
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: MusicVibe [command] [flags]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-18s %s\n", name, commands[name].Summary)
+	}
+	fmt.Fprintln(out, "  help               show this message")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Run '<command> -h' for command flags.")
+}
+
+func migrateCommand(ctx context.Context, app *App, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list pending migrations without applying them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return RunMigrations(ctx, app.DB, app.MongoDatabase, *dryRun)
+}
+
+func createAdminCommand(ctx context.Context, app *App, args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "admin email (required)")
+	username := flags.String("username", "", "username for a new user")
+	password := flags.String("password", "", "password for a new user (default $ADMIN_PASSWORD)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	*email = strings.ToLower(strings.TrimSpace(*email))
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	// Существующему пользователю только выдаётся роль
+	var userID string
+	err := app.DB.QueryRowContext(ctx, `SELECT id FROM user WHERE email = ?`, *email).Scan(&userID)
+	if err == nil {
+		if _, err := app.DB.ExecContext(ctx, `UPDATE user SET role = ? WHERE id = ?`, middleware.RoleAdmin, userID); err != nil {
+			return err
+		}
+		log.Printf("User %s (%s) is now an admin", *email, userID)
+		return nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if *password == "" {
+		*password = os.Getenv("ADMIN_PASSWORD")
+	}
+	if fields := handlers.ValidateAccount(*username, *email, *password); len(fields) > 0 {
+		var problems []string
+		for field, message := range fields {
+			problems = append(problems, field+": "+message)
+		}
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	userID, err = insertUser(ctx, app.DB, *username, *email, *password, middleware.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	log.Printf("Admin %s created with id %s", *email, userID)
+	return nil
+}
+
+// insertUser создаёт пользователя с подтверждённой почтой и пройденной настройкой профиля
+func insertUser(ctx context.Context, db *sql.DB, username, email, password, role string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	userID := uuid.New().String()
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO user (id, username, email, passwd_hash, role, has_complete_setup, email_verified, avatar_path, background_path, description)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, username, email, hashedPassword, role, true, true, "/avatarUser/defaultAvatar.png", "", " ")
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+func reindexCommand(ctx context.Context, app *App, args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	maintenance := &repository.SQLMaintenance{DB: app.DB}
+	updated, err := maintenance.ReindexSearch(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Search columns updated: %d rows", updated)
+	return nil
+}
+
+func recomputeStreamsCommand(ctx context.Context, app *App, args []string) error {
+	flags := flag.NewFlagSet("recompute-streams", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	maintenance := &repository.SQLMaintenance{DB: app.DB}
+	updated, err := maintenance.RecomputeStreamCounts(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Stream counts changed: %d tracks", updated)
+	return nil
+}
+
+func recomputeChartsCommand(ctx context.Context, app *App, args []string) error {
+	flags := flag.NewFlagSet("recompute-charts", flag.ContinueOnError)
+	window := flags.Duration("window", 7*24*time.Hour, "count streams newer than this")
+	size := flags.Int("size", 100, "number of chart positions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *window <= 0 || *size <= 0 {
+		return errors.New("-window and -size must be positive")
+	}
+	maintenance := &repository.SQLMaintenance{DB: app.DB}
+	positions, err := maintenance.RecomputeChart(ctx, time.Now().Add(-*window), *size)
+	if err != nil {
+		return err
+	}
+	log.Printf("Chart rebuilt: %d positions", positions)
+	return nil
+}
+
+func verifyStorageCommand(ctx context.Context, app *App, args []string) error {
+	flags := flag.NewFlagSet("verify-storage", flag.ContinueOnError)
+	quarantine := flags.Bool("quarantine", false, "move orphans older than the grace period to "+reconcile.QuarantinePrefix)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	reconciler := app.Reconciler()
+	var result reconcile.Result
+	if *quarantine {
+		result = reconciler.RunOnce(ctx)
+	} else {
+		result.Report, result.Err = reconciler.Checker.Check(ctx)
+	}
+	if result.Err != nil {
+		return result.Err
+	}
+
+	for _, object := range result.Orphans {
+		fmt.Printf("orphan\t%s\t%d bytes\n", object.Key, object.Size)
+	}
+	for _, object := range result.Unknown {
+		fmt.Printf("unknown\t%s\t%d bytes\n", object.Key, object.Size)
+	}
+	for _, missing := range result.Missing {
+		fmt.Printf("missing\t%s\t%s %s\n", missing.Key, missing.Table, missing.ID)
+	}
+	for _, key := range result.Quarantined {
+		fmt.Printf("quarantined\t%s\n", key)
+	}
+	log.Printf("Checked %d objects: %d orphaned, %d unknown, %d missing, %d quarantined",
+		result.Objects, len(result.Orphans), len(result.Unknown), len(result.Missing), len(result.Quarantined))
+	if len(result.Orphans) > len(result.Quarantined) || len(result.Missing) > 0 {
+		return errors.New("storage and database are out of sync")
+	}
+	return nil
+}
+
+func purgeCommand(ctx context.Context, app *App, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	olderThan := flags.Duration("older-than", time.Duration(app.Config.Purge.Retention), "purge content deleted longer ago than this")
+	dryRun := flags.Bool("dry-run", false, "list what would be purged without deleting it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	result, err := app.Purger().Run(ctx, time.Now().Add(-*olderThan), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range result.Objects {
+		fmt.Println(key)
+	}
+	verb := "Purged"
+	if *dryRun {
+		verb = "Would purge"
+	}
+	log.Printf("%s %d albums, %d tracks, %d objects", verb, len(result.AlbumIDs), len(result.TrackIDs), len(result.Objects))
+	return nil
+}
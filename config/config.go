@@ -0,0 +1,413 @@
+// Package config собирает настройки сервера из значений по умолчанию,
+// необязательного JSON-файла (CONFIG_FILE) и переменных окружения - именно в таком порядке.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EnvProduction  = "production"
+	EnvDevelopment = "development"
+)
+
+type Config struct {
+	// Любое окружение, кроме development (production, staging...), проверяется как
+	// production: ключи подписи JWT и ссылок на медиа и SMTP обязательны. В development
+	// без ключей генерируются временные, и токены и ссылки не переживают перезапуск
+	Env     string  `json:"env"`
+	Server  Server  `json:"server"`
+	MySQL   MySQL   `json:"mysql"`
+	Mongo   Mongo   `json:"mongo"`
+	Storage Storage `json:"storage"`
+	MinIO   MinIO   `json:"minio"`
+	Auth    Auth    `json:"auth"`
+	Mail    Mail    `json:"mail"`
+	Media   Media   `json:"media"`
+	Limits  Limits  `json:"limits"`
+	Release Release `json:"release"`
+	Purge   Purge   `json:"purge"`
+	Metrics Metrics `json:"metrics"`
+}
+
+type Server struct {
+	Addr string `json:"addr"`
+	// Адрес API, из которого строятся ссылки на /media
+	PublicBaseURL string `json:"publicBaseUrl"`
+	// Адрес фронтенда для ссылок в письмах и редиректов после OIDC
+	AppURL      string   `json:"appUrl"`
+	CORSOrigins []string `json:"corsOrigins"`
+
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout"`
+	// Покрывает чтение всего тела, поэтому должен вмещать загрузку альбома
+	ReadTimeout Duration `json:"readTimeout"`
+	// 0 - без ограничения: аудио отдаётся потоком и может идти дольше любого таймаута
+	WriteTimeout Duration `json:"writeTimeout"`
+	IdleTimeout  Duration `json:"idleTimeout"`
+	// Сколько ждать завершения текущих запросов и фоновых задач при остановке
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+}
+
+type MySQL struct {
+	// parseTime, loc и time_zone выставляются при подключении (metrics.OpenMySQL)
+	DSN string `json:"dsn"`
+	// Применять миграции схемы и индексы Mongo при старте сервера; иначе - командой migrate
+	MigrateOnStart bool `json:"migrateOnStart"`
+}
+
+type Mongo struct {
+	URI      string `json:"uri"`
+	Database string `json:"database"`
+}
+
+const (
+	StorageMinIO      = "minio"
+	StorageFilesystem = "filesystem"
+)
+
+// Backend filesystem хранит файлы в Dir - для локальной разработки без MinIO.
+// Имя бакета из MinIO.Bucket остаётся частью путей в БД при любом хранилище
+type Storage struct {
+	Backend string `json:"backend"`
+	Dir     string `json:"dir"`
+	// Как часто сверять хранилище с БД; 0 - только вручную (API или verify-storage)
+	ReconcileInterval Duration `json:"reconcileInterval"`
+	// Объект без строки в БД переносится в карантин, только если он старше этого срока
+	OrphanGracePeriod Duration `json:"orphanGracePeriod"`
+}
+
+type MinIO struct {
+	Endpoint  string `json:"endpoint"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+	UseSSL    bool   `json:"useSsl"`
+	Bucket    string `json:"bucket"`
+}
+
+type Auth struct {
+	JWTKeysFile       string `json:"jwtKeysFile"`
+	JWTSecret         string `json:"jwtSecret"`
+	OIDCProvidersFile string `json:"oidcProvidersFile"`
+}
+
+// Без SMTPHost письма пишутся в лог и, если задан Dir, в файлы. Это допустимо
+// только в development: в письмах лежат токены сброса пароля и подтверждения почты
+type Mail struct {
+	SMTPHost     string `json:"smtpHost"`
+	SMTPPort     int    `json:"smtpPort"`
+	SMTPUsername string `json:"smtpUsername"`
+	SMTPPassword string `json:"smtpPassword"`
+	From         string `json:"from"`
+	Dir          string `json:"dir"`
+}
+
+type Media struct {
+	// Необязательный хост CDN, через который отдаются изображения
+	CDNBaseURL string   `json:"cdnBaseUrl"`
+	SigningKey string   `json:"signingKey"`
+	PresignTTL Duration `json:"presignTtl"`
+}
+
+type Limits struct {
+	AlbumUploadBytes int64 `json:"albumUploadBytes"`
+	ImageUploadBytes int64 `json:"imageUploadBytes"`
+}
+
+// Пустой Token - /metrics открыт; иначе Prometheus передаёт "Authorization: Bearer <token>"
+type Metrics struct {
+	Token string `json:"token"`
+}
+
+type Release struct {
+	SchedulerInterval Duration `json:"schedulerInterval"`
+}
+
+// Строки удалённых альбомов и треков окончательно удаляются через Retention
+type Purge struct {
+	// Как часто искать удалённое с истёкшим сроком; 0 - только вручную (команда purge)
+	Interval  Duration `json:"interval"`
+	Retention Duration `json:"retention"`
+}
+
+// Duration читается из строки вида "5m" или "1h30m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func Default() *Config {
+	return &Config{
+		Env: EnvProduction,
+		Server: Server{
+			Addr:          ":8080",
+			PublicBaseURL: "http://localhost:8080",
+			AppURL:        "http://localhost:8080",
+			CORSOrigins:   []string{"*"},
+
+			ReadHeaderTimeout: Duration(10 * time.Second),
+			ReadTimeout:       Duration(5 * time.Minute),
+			IdleTimeout:       Duration(2 * time.Minute),
+			ShutdownTimeout:   Duration(30 * time.Second),
+		},
+		MySQL: MySQL{MigrateOnStart: true},
+		Mongo: Mongo{Database: "audiostreaming"},
+		Storage: Storage{
+			Backend:           StorageMinIO,
+			Dir:               "data/media",
+			ReconcileInterval: Duration(6 * time.Hour),
+			OrphanGracePeriod: Duration(24 * time.Hour),
+		},
+		MinIO: MinIO{Endpoint: "localhost:9000", Bucket: "music"},
+		Mail:  Mail{SMTPPort: 587},
+		Limits: Limits{
+			AlbumUploadBytes: 50 << 20,
+			ImageUploadBytes: 10 << 20,
+		},
+		Release: Release{SchedulerInterval: Duration(time.Minute)},
+		Purge: Purge{
+			Interval:  Duration(time.Hour),
+			Retention: Duration(30 * 24 * time.Hour),
+		},
+	}
+}
+
+// Load читает CONFIG_FILE (если задан), затем переменные окружения, и проверяет результат
+func Load() (*Config, error) {
+	cfg := Default()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: read %s: %w", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) loadEnv(lookup func(string) (string, bool)) error {
+	stringVars := map[string]*string{
+		"APP_ENV":             &cfg.Env,
+		"HTTP_ADDR":           &cfg.Server.Addr,
+		"PUBLIC_BASE_URL":     &cfg.Server.PublicBaseURL,
+		"APP_URL":             &cfg.Server.AppURL,
+		"MYSQL_DSN":           &cfg.MySQL.DSN,
+		"MONGO_URI":           &cfg.Mongo.URI,
+		"MONGO_DATABASE":      &cfg.Mongo.Database,
+		"STORAGE_BACKEND":     &cfg.Storage.Backend,
+		"STORAGE_DIR":         &cfg.Storage.Dir,
+		"MINIO_ENDPOINT":      &cfg.MinIO.Endpoint,
+		"MINIO_ACCESS_KEY":    &cfg.MinIO.AccessKey,
+		"MINIO_SECRET_KEY":    &cfg.MinIO.SecretKey,
+		"MINIO_BUCKET":        &cfg.MinIO.Bucket,
+		"JWT_KEYS_FILE":       &cfg.Auth.JWTKeysFile,
+		"JWT_SECRET":          &cfg.Auth.JWTSecret,
+		"OIDC_PROVIDERS_FILE": &cfg.Auth.OIDCProvidersFile,
+		"SMTP_HOST":           &cfg.Mail.SMTPHost,
+		"SMTP_USERNAME":       &cfg.Mail.SMTPUsername,
+		"SMTP_PASSWORD":       &cfg.Mail.SMTPPassword,
+		"SMTP_FROM":           &cfg.Mail.From,
+		"MAIL_DIR":            &cfg.Mail.Dir,
+		"MEDIA_CDN_URL":       &cfg.Media.CDNBaseURL,
+		"MEDIA_SIGNING_KEY":   &cfg.Media.SigningKey,
+		"METRICS_TOKEN":       &cfg.Metrics.Token,
+	}
+	for name, target := range stringVars {
+		if value, ok := lookup(name); ok {
+			*target = value
+		}
+	}
+
+	if value, ok := lookup("CORS_ALLOWED_ORIGINS"); ok {
+		cfg.Server.CORSOrigins = nil
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cfg.Server.CORSOrigins = append(cfg.Server.CORSOrigins, origin)
+			}
+		}
+	}
+
+	bools := map[string]*bool{
+		"MINIO_USE_SSL":    &cfg.MinIO.UseSSL,
+		"MIGRATE_ON_START": &cfg.MySQL.MigrateOnStart,
+	}
+	for name, target := range bools {
+		if value, ok := lookup(name); ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("config: %s: %w", name, err)
+			}
+			*target = parsed
+		}
+	}
+
+	ints := map[string]*int64{
+		"ALBUM_UPLOAD_MAX_BYTES": &cfg.Limits.AlbumUploadBytes,
+		"IMAGE_UPLOAD_MAX_BYTES": &cfg.Limits.ImageUploadBytes,
+	}
+	for name, target := range ints {
+		if value, ok := lookup(name); ok {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("config: %s: %w", name, err)
+			}
+			*target = parsed
+		}
+	}
+	if value, ok := lookup("SMTP_PORT"); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("config: SMTP_PORT: %w", err)
+		}
+		cfg.Mail.SMTPPort = port
+	}
+
+	durations := map[string]*Duration{
+		"HTTP_READ_HEADER_TIMEOUT":    &cfg.Server.ReadHeaderTimeout,
+		"HTTP_READ_TIMEOUT":           &cfg.Server.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT":          &cfg.Server.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":           &cfg.Server.IdleTimeout,
+		"HTTP_SHUTDOWN_TIMEOUT":       &cfg.Server.ShutdownTimeout,
+		"MEDIA_PRESIGN_TTL":           &cfg.Media.PresignTTL,
+		"PURGE_INTERVAL":              &cfg.Purge.Interval,
+		"PURGE_RETENTION":             &cfg.Purge.Retention,
+		"RELEASE_SCHEDULER_INTERVAL":  &cfg.Release.SchedulerInterval,
+		"STORAGE_RECONCILE_INTERVAL":  &cfg.Storage.ReconcileInterval,
+		"STORAGE_ORPHAN_GRACE_PERIOD": &cfg.Storage.OrphanGracePeriod,
+	}
+	for name, target := range durations {
+		if value, ok := lookup(name); ok {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("config: %s: %w", name, err)
+			}
+			*target = Duration(parsed)
+		}
+	}
+	return nil
+}
+
+// Validate собирает все ошибки сразу, чтобы не исправлять конфигурацию по одной
+func (cfg *Config) Validate() error {
+	var problems []string
+	require := func(value, name string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, name+" is required")
+		}
+	}
+
+	require(cfg.Server.Addr, "server.addr (HTTP_ADDR)")
+	require(cfg.MySQL.DSN, "mysql.dsn (MYSQL_DSN)")
+	require(cfg.Mongo.URI, "mongo.uri (MONGO_URI)")
+	require(cfg.Mongo.Database, "mongo.database (MONGO_DATABASE)")
+	require(cfg.MinIO.Bucket, "minio.bucket (MINIO_BUCKET)")
+	switch cfg.Storage.Backend {
+	case StorageMinIO:
+		require(cfg.MinIO.Endpoint, "minio.endpoint (MINIO_ENDPOINT)")
+		require(cfg.MinIO.AccessKey, "minio.accessKey (MINIO_ACCESS_KEY)")
+		require(cfg.MinIO.SecretKey, "minio.secretKey (MINIO_SECRET_KEY)")
+	case StorageFilesystem:
+		require(cfg.Storage.Dir, "storage.dir (STORAGE_DIR)")
+	default:
+		problems = append(problems, "storage.backend (STORAGE_BACKEND) must be minio or filesystem")
+	}
+	require(cfg.Env, "env (APP_ENV)")
+	if cfg.Env != EnvDevelopment {
+		if cfg.Auth.JWTKeysFile == "" {
+			require(cfg.Auth.JWTSecret, "auth.jwtKeysFile (JWT_KEYS_FILE) or auth.jwtSecret (JWT_SECRET)")
+		}
+		require(cfg.Media.SigningKey, "media.signingKey (MEDIA_SIGNING_KEY)")
+		require(cfg.Mail.SMTPHost, "mail.smtpHost (SMTP_HOST)")
+	}
+
+	for name, raw := range map[string]string{
+		"server.publicBaseUrl (PUBLIC_BASE_URL)": cfg.Server.PublicBaseURL,
+		"server.appUrl (APP_URL)":                cfg.Server.AppURL,
+	} {
+		parsed, err := url.Parse(raw)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problems = append(problems, name+" must be an absolute http(s) URL")
+		}
+	}
+	if cfg.Media.CDNBaseURL != "" {
+		parsed, err := url.Parse(cfg.Media.CDNBaseURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problems = append(problems, "media.cdnBaseUrl (MEDIA_CDN_URL) must be an absolute http(s) URL")
+		}
+	}
+	cfg.Server.PublicBaseURL = strings.TrimRight(cfg.Server.PublicBaseURL, "/")
+	cfg.Server.AppURL = strings.TrimRight(cfg.Server.AppURL, "/")
+
+	if len(cfg.Server.CORSOrigins) == 0 {
+		problems = append(problems, "server.corsOrigins (CORS_ALLOWED_ORIGINS) must not be empty")
+	}
+	if cfg.Server.ReadHeaderTimeout <= 0 || cfg.Server.ReadTimeout <= 0 || cfg.Server.IdleTimeout <= 0 || cfg.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server timeouts must be positive (writeTimeout may be 0)")
+	}
+	if cfg.Server.WriteTimeout < 0 {
+		problems = append(problems, "server.writeTimeout (HTTP_WRITE_TIMEOUT) must not be negative")
+	}
+	if cfg.Limits.AlbumUploadBytes <= 0 || cfg.Limits.ImageUploadBytes <= 0 {
+		problems = append(problems, "limits must be positive")
+	}
+	if cfg.Mail.SMTPPort <= 0 || cfg.Mail.SMTPPort > 65535 {
+		problems = append(problems, "mail.smtpPort (SMTP_PORT) is out of range")
+	}
+	if cfg.Media.PresignTTL < 0 || time.Duration(cfg.Media.PresignTTL) > 7*24*time.Hour {
+		problems = append(problems, "media.presignTtl (MEDIA_PRESIGN_TTL) must be between 0 and 168h")
+	}
+	if cfg.Storage.ReconcileInterval < 0 {
+		problems = append(problems, "storage.reconcileInterval (STORAGE_RECONCILE_INTERVAL) must not be negative")
+	}
+	if time.Duration(cfg.Storage.OrphanGracePeriod) < time.Hour {
+		problems = append(problems, "storage.orphanGracePeriod (STORAGE_ORPHAN_GRACE_PERIOD) must be at least 1h")
+	}
+	if cfg.Release.SchedulerInterval <= 0 {
+		problems = append(problems, "release.schedulerInterval (RELEASE_SCHEDULER_INTERVAL) must be positive")
+	}
+	if cfg.Purge.Interval < 0 {
+		problems = append(problems, "purge.interval (PURGE_INTERVAL) must not be negative")
+	}
+	if time.Duration(cfg.Purge.Retention) < time.Hour {
+		problems = append(problems, "purge.retention (PURGE_RETENTION) must be at least 1h")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func loadFromEnv(t *testing.T, env map[string]string) (*Config, error) {
+	t.Helper()
+	cfg := Default()
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := cfg.loadEnv(lookup); err != nil {
+		t.Fatal(err)
+	}
+	return cfg, cfg.Validate()
+}
+
+func baseEnv() map[string]string {
+	return map[string]string{
+		"MYSQL_DSN":         "user:pass@tcp(localhost:3306)/musicvibe",
+		"MONGO_URI":         "mongodb://localhost:27017",
+		"STORAGE_BACKEND":   StorageFilesystem,
+		"STORAGE_DIR":       "data/media",
+		"JWT_SECRET":        "jwt-secret",
+		"MEDIA_SIGNING_KEY": "media-secret",
+		"SMTP_HOST":         "smtp.example.com",
+	}
+}
+
+func TestProductionRequiresSigningKeys(t *testing.T) {
+	env := baseEnv()
+	delete(env, "JWT_SECRET")
+	delete(env, "MEDIA_SIGNING_KEY")
+
+	_, err := loadFromEnv(t, env)
+	if err == nil {
+		t.Fatal("config without signing keys passed validation in production")
+	}
+	for _, want := range []string{"JWT_SECRET", "MEDIA_SIGNING_KEY"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestProductionRequiresSMTP(t *testing.T) {
+	env := baseEnv()
+	delete(env, "SMTP_HOST")
+
+	if _, err := loadFromEnv(t, env); err == nil || !strings.Contains(err.Error(), "SMTP_HOST") {
+		t.Fatalf("err = %v, want an SMTP_HOST problem", err)
+	}
+}
+
+func TestProductionAcceptsJWTKeysFile(t *testing.T) {
+	env := baseEnv()
+	delete(env, "JWT_SECRET")
+	env["JWT_KEYS_FILE"] = "/etc/musicvibe/jwt-keys.json"
+
+	if _, err := loadFromEnv(t, env); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDevelopmentAllowsEphemeralKeys(t *testing.T) {
+	env := baseEnv()
+	delete(env, "JWT_SECRET")
+	delete(env, "MEDIA_SIGNING_KEY")
+	delete(env, "SMTP_HOST")
+	env["APP_ENV"] = EnvDevelopment
+
+	if _, err := loadFromEnv(t, env); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOtherEnvsUseProductionRules(t *testing.T) {
+	env := baseEnv()
+	env["APP_ENV"] = "staging"
+	if _, err := loadFromEnv(t, env); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(env, "MEDIA_SIGNING_KEY")
+	if _, err := loadFromEnv(t, env); err == nil || !strings.Contains(err.Error(), "MEDIA_SIGNING_KEY") {
+		t.Fatalf("err = %v, want a MEDIA_SIGNING_KEY problem in staging", err)
+	}
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Edafi/MusicVibe/mailer"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tokenPurposeVerifyEmail   = "verify_email"
+	tokenPurposeResetPassword = "reset_password"
+
+	verifyEmailTokenTTL   = 48 * time.Hour
+	resetPasswordTokenTTL = time.Hour
+)
+
+var errInvalidOneTimeToken = errors.New("invalid or expired token")
+
+// Одноразовый токен: пользователю уходит случайная строка, в user_token лежит её sha256
+func (handler *AuthHandler) issueOneTimeToken(userID, purpose string, ttl time.Duration) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	// Старые неиспользованные токены того же типа больше не действуют
+	_, err := handler.DB.Exec(`UPDATE user_token SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL`,
+		time.Now(), userID, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = handler.DB.Exec(`
+		INSERT INTO user_token (token_hash, user_id, purpose, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		hashToken(token), userID, purpose, time.Now(), time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Помечает токен использованным в рамках транзакции и возвращает его владельца
+func consumeOneTimeToken(tx *sql.Tx, token, purpose string) (string, error) {
+	var userID string
+	err := tx.QueryRow(`
+		SELECT user_id FROM user_token
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		FOR UPDATE`, hashToken(token), purpose, time.Now()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", errInvalidOneTimeToken
+	} else if err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(`UPDATE user_token SET used_at = ? WHERE token_hash = ?`, time.Now(), hashToken(token)); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+func (handler *AuthHandler) link(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", handler.AppURL, path, url.QueryEscape(token))
+}
+
+func (handler *AuthHandler) sendVerificationEmail(ctx context.Context, userID, email string) error {
+	token, err := handler.issueOneTimeToken(userID, tokenPurposeVerifyEmail, verifyEmailTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return handler.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Подтвердите адрес электронной почты",
+		Body: "Чтобы подтвердить адрес, перейдите по ссылке:\n\n" +
+			handler.link("/verify-email", token) + "\n\nСсылка действует 48 часов.",
+	})
+}
+
+func (handler *AuthHandler) sendPasswordResetEmail(ctx context.Context, userID, email string) error {
+	token, err := handler.issueOneTimeToken(userID, tokenPurposeResetPassword, resetPasswordTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return handler.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Сброс пароля",
+		Body: "Для установки нового пароля перейдите по ссылке:\n\n" +
+			handler.link("/reset-password", token) +
+			"\n\nСсылка действует 1 час. Если вы не запрашивали сброс, просто проигнорируйте письмо.",
+	})
+}
+
+// POST /auth/email/verify
+func (handler *AuthHandler) VerifyEmail(response http.ResponseWriter, request *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("VerifyEmail - begin error:", err)
+		http.Error(response, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeOneTimeToken(tx, req.Token, tokenPurposeVerifyEmail)
+	if errors.Is(err, errInvalidOneTimeToken) {
+		http.Error(response, "Invalid or expired token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Println("VerifyEmail - token error:", err)
+		http.Error(response, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE user SET email_verified = 1 WHERE id = ?`, userID); err != nil {
+		log.Println("VerifyEmail - update error:", err)
+		http.Error(response, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("VerifyEmail - commit error:", err)
+		http.Error(response, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// POST /auth/email/resend
+func (handler *AuthHandler) ResendVerificationEmail(response http.ResponseWriter, request *http.Request) {
+	userID, _, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var email string
+	var verified bool
+	err := handler.DB.QueryRow(`SELECT email, email_verified FROM user WHERE id = ?`, userID).Scan(&email, &verified)
+	if err != nil {
+		log.Println("ResendVerificationEmail - user error:", err)
+		http.Error(response, "User not found", http.StatusNotFound)
+		return
+	}
+	if verified {
+		http.Error(response, "Email already verified", http.StatusConflict)
+		return
+	}
+
+	if err := handler.sendVerificationEmail(request.Context(), userID, email); err != nil {
+		log.Println("ResendVerificationEmail - send error:", err)
+		http.Error(response, "Failed to send email", http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusAccepted)
+}
+
+// POST /auth/password/forgot - ответ одинаковый независимо от того, есть ли такой email
+func (handler *AuthHandler) ForgotPassword(response http.ResponseWriter, request *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	var userID, email string
+	err := handler.DB.QueryRow(`SELECT id, email FROM user WHERE email = ?`, normalizeEmail(req.Email)).Scan(&userID, &email)
+	if err == nil {
+		if err := handler.sendPasswordResetEmail(request.Context(), userID, email); err != nil {
+			log.Println("ForgotPassword - send error:", err)
+		}
+	} else if err != sql.ErrNoRows {
+		log.Println("ForgotPassword - user error:", err)
+	}
+
+	response.WriteHeader(http.StatusAccepted)
+}
+
+// POST /auth/password/reset - устанавливает новый пароль и завершает все сессии, отзывает API-токены
+func (handler *AuthHandler) ResetPassword(response http.ResponseWriter, request *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if message := validatePassword(req.Password); message != "" {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"password": message})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("ResetPassword - hash error:", err)
+		http.Error(response, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("ResetPassword - begin error:", err)
+		http.Error(response, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeOneTimeToken(tx, req.Token, tokenPurposeResetPassword)
+	if errors.Is(err, errInvalidOneTimeToken) {
+		http.Error(response, "Invalid or expired token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Println("ResetPassword - token error:", err)
+		http.Error(response, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	// Ссылка пришла на почту, значит адрес заодно подтверждён
+	if _, err := tx.Exec(`UPDATE user SET passwd_hash = ?, email_verified = 1 WHERE id = ?`, hashedPassword, userID); err != nil {
+		log.Println("ResetPassword - update error:", err)
+		http.Error(response, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	if _, err := tx.Exec(`UPDATE user_session SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, now, userID); err != nil {
+		log.Println("ResetPassword - revoke error:", err)
+		http.Error(response, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(`UPDATE api_token SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, now, userID); err != nil {
+		log.Println("ResetPassword - revoke tokens error:", err)
+		http.Error(response, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("ResetPassword - commit error:", err)
+		http.Error(response, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// POST /auth/password/change - текущая сессия остаётся, остальные завершаются, API-токены отзываются
+func (handler *AuthHandler) ChangePassword(response http.ResponseWriter, request *http.Request) {
+	userID, sessionID, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if message := validatePassword(req.NewPassword); message != "" {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"newPassword": message})
+		return
+	}
+
+	var passwordHash string
+	if err := handler.DB.QueryRow(`SELECT passwd_hash FROM user WHERE id = ?`, userID).Scan(&passwordHash); err != nil {
+		log.Println("ChangePassword - user error:", err)
+		http.Error(response, "User not found", http.StatusNotFound)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.CurrentPassword)); err != nil {
+		http.Error(response, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("ChangePassword - hash error:", err)
+		http.Error(response, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("ChangePassword - begin error:", err)
+		http.Error(response, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE user SET passwd_hash = ? WHERE id = ?`, hashedPassword, userID); err != nil {
+		log.Println("ChangePassword - update error:", err)
+		http.Error(response, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	if _, err := tx.Exec(`UPDATE user_session SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL`,
+		now, userID, sessionID); err != nil {
+		log.Println("ChangePassword - revoke error:", err)
+		http.Error(response, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(`UPDATE api_token SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, now, userID); err != nil {
+		log.Println("ChangePassword - revoke tokens error:", err)
+		http.Error(response, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("ChangePassword - commit error:", err)
+		http.Error(response, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultAPITokenDays = 90
+	maxAPITokenDays     = 365
+	maxAPITokensPerUser = 50
+)
+
+type APITokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// GET /auth/tokens
+func (handler *AuthHandler) GetAPITokens(response http.ResponseWriter, request *http.Request) {
+	userID, _, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := handler.DB.Query(`
+		SELECT id, name, scopes, created_at, expires_at, last_used_at
+		FROM api_token
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY created_at DESC`, userID, time.Now())
+	if err != nil {
+		log.Println("GetAPITokens - DB Query error:", err)
+		http.Error(response, "Failed to load tokens", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var tokens []APITokenResponse = make([]APITokenResponse, 0)
+	for rows.Next() {
+		var t APITokenResponse
+		var scopes string
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &scopes, &t.CreatedAt, &t.ExpiresAt, &lastUsed); err != nil {
+			log.Println("GetAPITokens - Row Scan error:", err)
+			http.Error(response, "Failed to load tokens", http.StatusInternalServerError)
+			return
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, t)
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(tokens)
+}
+
+// POST /auth/tokens - сам токен возвращается только в этом ответе
+func (handler *AuthHandler) CreateAPIToken(response http.ResponseWriter, request *http.Request) {
+	userID, _, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expiresInDays"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	fields := FieldErrors{}
+	if req.Name == "" || len(req.Name) > 100 {
+		fields.Add("name", "Name must be 1-100 characters")
+	}
+
+	// Дубликаты scope убираем, неизвестные считаем ошибкой
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := map[string]bool{}
+	for _, s := range req.Scopes {
+		if !middleware.IsValidScope(middleware.Scope(s)) {
+			fields.Add("scopes", "Unknown scope: "+s)
+			continue
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	if len(req.Scopes) == 0 {
+		fields.Add("scopes", "At least one scope is required")
+	}
+
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAPITokenDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxAPITokenDays {
+		fields.Add("expiresInDays", "Expiry must be between 1 and 365 days")
+	}
+	if len(fields) > 0 {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", fields)
+		return
+	}
+
+	var count int
+	err := handler.DB.QueryRow(`SELECT COUNT(*) FROM api_token WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?`,
+		userID, time.Now()).Scan(&count)
+	if err != nil {
+		log.Println("CreateAPIToken - count error:", err)
+		http.Error(response, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxAPITokensPerUser {
+		http.Error(response, "Too many active tokens", http.StatusConflict)
+		return
+	}
+
+	token, hash, err := middleware.NewAPIToken()
+	if err != nil {
+		log.Println("CreateAPIToken - generate error:", err)
+		http.Error(response, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	id := uuid.New().String()
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+	_, err = handler.DB.Exec(`
+		INSERT INTO api_token (id, user_id, name, token_hash, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, id, userID, req.Name, hash, strings.Join(scopes, ","), now, expiresAt)
+	if err != nil {
+		log.Println("CreateAPIToken - insert error:", err)
+		http.Error(response, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusCreated)
+	json.NewEncoder(response).Encode(map[string]interface{}{
+		"token": token,
+		"info": APITokenResponse{
+			ID:        id,
+			Name:      req.Name,
+			Scopes:    scopes,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		},
+	})
+}
+
+// DELETE /auth/tokens/{id}
+func (handler *AuthHandler) RevokeAPIToken(response http.ResponseWriter, request *http.Request) {
+	userID, _, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokenID := mux.Vars(request)["id"]
+	result, err := handler.DB.Exec(`UPDATE api_token SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		time.Now(), tokenID, userID)
+	if err != nil {
+		log.Println("RevokeAPIToken - revoke error:", err)
+		http.Error(response, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(response, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
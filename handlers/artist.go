@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Edafi/MusicVibe/imageproc"
+	"github.com/Edafi/MusicVibe/mediaurl"
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/storage"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxArtistNameLength     = 64
+	maxArtistBioLength      = 2000
+	maxArtistProfilesByUser = 10
+	defaultArtistAvatarPath = "/avatarUser/defaultAvatar.png"
+)
+
+var errNoArtistProfile = errors.New("user has no artist profile")
+
+type ArtistHandler struct {
+	DB            *sql.DB
+	Store         storage.BlobStore
+	Bucket        string
+	MaxImageBytes int64
+	Media         *mediaurl.Builder
+}
+
+type ArtistProfile struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+// Возвращает профиль музыканта, от имени которого действует пользователь.
+// Если requestedID пуст, а профиль у пользователя один - берётся он
+func ownedMusicianID(db *sql.DB, userID, requestedID string) (string, error) {
+	if requestedID != "" {
+		var musicianID string
+		err := db.QueryRow(`SELECT id FROM musician WHERE id = ? AND user_id = ?`, requestedID, userID).Scan(&musicianID)
+		if err == sql.ErrNoRows {
+			return "", errNoArtistProfile
+		}
+		return musicianID, err
+	}
+
+	rows, err := db.Query(`SELECT id FROM musician WHERE user_id = ? LIMIT 2`, userID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", errNoArtistProfile
+	case 1:
+		return ids[0], nil
+	}
+	return "", errors.New("musicianId is required for users with several artist profiles")
+}
+
+// POST /artists - "стать артистом": создаёт профиль музыканта для текущего пользователя
+func (handler *ArtistHandler) CreateArtist(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := parseMultipartForm(response, request, handler.MaxImageBytes+formOverheadBytes); err != nil {
+		log.Println("CreateArtist - parse form error:", err)
+		writeFormError(response, err)
+		return
+	}
+
+	name := strings.TrimSpace(request.FormValue("name"))
+	description := strings.TrimSpace(request.FormValue("description"))
+
+	fields := FieldErrors{}
+	if length := utf8.RuneCountInString(name); length == 0 || length > maxArtistNameLength {
+		fields.Add("name", "Artist name must be between 1 and 64 characters")
+	}
+	if utf8.RuneCountInString(description) > maxArtistBioLength {
+		fields.Add("description", "Description is too long")
+	}
+
+	var genreIDs []int
+	for _, raw := range request.MultipartForm.Value["genreIds[]"] {
+		genreID, err := strconv.Atoi(raw)
+		if err != nil {
+			fields.Add("genreIds", "Invalid genre id")
+			break
+		}
+		genreIDs = append(genreIDs, genreID)
+	}
+	if len(fields) > 0 {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", fields)
+		return
+	}
+
+	var profiles int
+	if err := handler.DB.QueryRow(`SELECT COUNT(*) FROM musician WHERE user_id = ?`, userID).Scan(&profiles); err != nil {
+		log.Println("CreateArtist - count error:", err)
+		http.Error(response, "Failed to create artist", http.StatusInternalServerError)
+		return
+	}
+	if profiles >= maxArtistProfilesByUser {
+		http.Error(response, "Too many artist profiles", http.StatusForbidden)
+		return
+	}
+
+	var nameTaken bool
+	if err := handler.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM musician WHERE name_lower = ?)`, strings.ToLower(name)).Scan(&nameTaken); err != nil {
+		log.Println("CreateArtist - uniqueness error:", err)
+		http.Error(response, "Failed to create artist", http.StatusInternalServerError)
+		return
+	}
+	if nameTaken {
+		writeFieldErrors(response, http.StatusConflict, "Artist already exists", FieldErrors{"name": "Artist name is already taken"})
+		return
+	}
+
+	musicianID := uuid.New().String()
+	avatarPath := defaultArtistAvatarPath
+
+	// Аватар необязателен
+	if _, _, err := request.FormFile("avatar"); err == nil {
+		img, problem := readImageUpload(request, "avatar", handler.MaxImageBytes)
+		if problem != "" {
+			writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"avatar": problem})
+			return
+		}
+		avatarPath, err = StoreImageVariants(request.Context(), handler.Store, handler.Bucket, storage.MusicianDir(musicianID), storage.KindAvatar, musicianID, img, imageproc.AvatarVariants)
+		if err != nil {
+			log.Println("CreateArtist - avatar upload error:", err)
+			http.Error(response, "Failed to upload avatar", http.StatusInternalServerError)
+			return
+		}
+	} else if err != http.ErrMissingFile {
+		log.Println("CreateArtist - avatar error:", err)
+		http.Error(response, "Invalid avatar", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("CreateArtist - begin error:", err)
+		http.Error(response, "Failed to create artist", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO musician (id, user_id, name, avatar_path, name_lower, description)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		musicianID, userID, name, avatarPath, strings.ToLower(name), description)
+	if isDuplicateEntry(err) {
+		writeFieldErrors(response, http.StatusConflict, "Artist already exists", FieldErrors{"name": "Artist name is already taken"})
+		return
+	} else if err != nil {
+		log.Println("CreateArtist - insert error:", err)
+		http.Error(response, "Failed to create artist", http.StatusInternalServerError)
+		return
+	}
+
+	for _, genreID := range genreIDs {
+		_, err := tx.Exec(`
+			INSERT IGNORE INTO musician_genre (musician_id, genre_id)
+			SELECT ?, id FROM genre WHERE id = ?`, musicianID, genreID)
+		if err != nil {
+			log.Println("CreateArtist - genre error:", err)
+			http.Error(response, "Failed to save genres", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Первый профиль переводит обычного слушателя в роль музыканта. Право на загрузку
+	// появится в access-токене после /auth/refresh: роль при обновлении читается из БД
+	_, err = tx.Exec(`UPDATE user SET role = ? WHERE id = ? AND role = ?`, middleware.RoleMusician, userID, middleware.RoleUser)
+	if err != nil {
+		log.Println("CreateArtist - role error:", err)
+		http.Error(response, "Failed to create artist", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("CreateArtist - commit error:", err)
+		http.Error(response, "Failed to create artist", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusCreated)
+	json.NewEncoder(response).Encode(ArtistProfile{
+		ID:        musicianID,
+		Name:      name,
+		AvatarURL: handler.Media.Image(avatarPath),
+	})
+}
+
+// GET /artists/mine - профили музыкантов, которыми управляет пользователь
+func (handler *ArtistHandler) GetMyArtists(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := handler.DB.Query(`SELECT id, name, avatar_path FROM musician WHERE user_id = ? ORDER BY name`, userID)
+	if err != nil {
+		log.Println("GetMyArtists - DB Query error:", err)
+		http.Error(response, "Failed to load artists", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var artists []ArtistProfile = make([]ArtistProfile, 0)
+	for rows.Next() {
+		var artist ArtistProfile
+		if err := rows.Scan(&artist.ID, &artist.Name, &artist.AvatarURL); err != nil {
+			log.Println("GetMyArtists - Row Scan error:", err)
+			http.Error(response, "Failed to load artists", http.StatusInternalServerError)
+			return
+		}
+		artist.AvatarURL = handler.Media.Image(artist.AvatarURL)
+		artists = append(artists, artist)
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(artists)
+}
+
+type TrackStats struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	AlbumTitle  string `json:"albumTitle"`
+	StreamCount int    `json:"streamCount"`
+}
+
+// GET /artists/{id}/stats - прослушивания по трекам, только для владельца профиля
+func (handler *ArtistHandler) GetArtistStats(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	musicianID, err := ownedMusicianID(handler.DB, userID, mux.Vars(request)["id"])
+	if errors.Is(err, errNoArtistProfile) {
+		http.Error(response, "Artist not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("GetArtistStats - owner check error:", err)
+		http.Error(response, "Failed to load stats", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := handler.DB.Query(`
+		SELECT t.id, t.title, COALESCE(a.title, ''), t.stream_count
+		FROM track t
+		LEFT JOIN album a ON a.id = t.album_id
+		WHERE t.musician_id = ? AND t.deleted_at IS NULL
+		ORDER BY t.stream_count DESC`, musicianID)
+	if err != nil {
+		log.Println("GetArtistStats - DB Query error:", err)
+		http.Error(response, "Failed to load stats", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var tracks []TrackStats = make([]TrackStats, 0)
+	total := 0
+	for rows.Next() {
+		var t TrackStats
+		if err := rows.Scan(&t.ID, &t.Title, &t.AlbumTitle, &t.StreamCount); err != nil {
+			log.Println("GetArtistStats - Row Scan error:", err)
+			http.Error(response, "Failed to load stats", http.StatusInternalServerError)
+			return
+		}
+		total += t.StreamCount
+		tracks = append(tracks, t)
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(map[string]interface{}{
+		"musicianId":   musicianID,
+		"totalStreams": total,
+		"tracks":       tracks,
+	})
+}
+
+// PATCH /artists/{id} - меняются только переданные поля
+func (handler *ArtistHandler) UpdateArtist(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	musicianID, err := ownedMusicianID(handler.DB, userID, mux.Vars(request)["id"])
+	if errors.Is(err, errNoArtistProfile) {
+		http.Error(response, "Artist not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("UpdateArtist - owner check error:", err)
+		http.Error(response, "Failed to update artist", http.StatusInternalServerError)
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		GenreIDs    *[]int  `json:"genreIds"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		http.Error(response, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	fields := FieldErrors{}
+	if req.Name != nil {
+		*req.Name = strings.TrimSpace(*req.Name)
+		if length := utf8.RuneCountInString(*req.Name); length == 0 || length > maxArtistNameLength {
+			fields.Add("name", "Artist name must be between 1 and 64 characters")
+		}
+	}
+	if req.Description != nil {
+		*req.Description = strings.TrimSpace(*req.Description)
+		if utf8.RuneCountInString(*req.Description) > maxArtistBioLength {
+			fields.Add("description", "Description is too long")
+		}
+	}
+	if req.GenreIDs != nil {
+		for _, genreID := range *req.GenreIDs {
+			var exists bool
+			if err := handler.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM genre WHERE id = ?)`, genreID).Scan(&exists); err != nil {
+				log.Println("UpdateArtist - genre check error:", err)
+				http.Error(response, "Failed to update artist", http.StatusInternalServerError)
+				return
+			}
+			if !exists {
+				fields.Add("genreIds", fmt.Sprintf("Unknown genre id %d", genreID))
+				break
+			}
+		}
+	}
+	if len(fields) > 0 {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", fields)
+		return
+	}
+
+	if req.Name != nil {
+		var nameTaken bool
+		err := handler.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM musician WHERE name_lower = ? AND id <> ?)`,
+			strings.ToLower(*req.Name), musicianID).Scan(&nameTaken)
+		if err != nil {
+			log.Println("UpdateArtist - uniqueness error:", err)
+			http.Error(response, "Failed to update artist", http.StatusInternalServerError)
+			return
+		}
+		if nameTaken {
+			writeFieldErrors(response, http.StatusConflict, "Artist already exists", FieldErrors{"name": "Artist name is already taken"})
+			return
+		}
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("UpdateArtist - begin error:", err)
+		http.Error(response, "Failed to update artist", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if req.Name != nil {
+		_, err := tx.Exec(`UPDATE musician SET name = ?, name_lower = ? WHERE id = ?`, *req.Name, strings.ToLower(*req.Name), musicianID)
+		if isDuplicateEntry(err) {
+			writeFieldErrors(response, http.StatusConflict, "Artist already exists", FieldErrors{"name": "Artist name is already taken"})
+			return
+		} else if err != nil {
+			log.Println("UpdateArtist - name error:", err)
+			http.Error(response, "Failed to update artist", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.Description != nil {
+		if _, err := tx.Exec(`UPDATE musician SET description = ? WHERE id = ?`, *req.Description, musicianID); err != nil {
+			log.Println("UpdateArtist - description error:", err)
+			http.Error(response, "Failed to update artist", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.GenreIDs != nil {
+		if _, err := tx.Exec(`DELETE FROM musician_genre WHERE musician_id = ?`, musicianID); err != nil {
+			log.Println("UpdateArtist - clear genres error:", err)
+			http.Error(response, "Failed to save genres", http.StatusInternalServerError)
+			return
+		}
+		for _, genreID := range *req.GenreIDs {
+			if _, err := tx.Exec(`INSERT IGNORE INTO musician_genre (musician_id, genre_id) VALUES (?, ?)`, musicianID, genreID); err != nil {
+				log.Println("UpdateArtist - genre error:", err)
+				http.Error(response, "Failed to save genres", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("UpdateArtist - commit error:", err)
+		http.Error(response, "Failed to update artist", http.StatusInternalServerError)
+		return
+	}
+
+	var artist ArtistProfile
+	err = handler.DB.QueryRow(`SELECT id, name, avatar_path FROM musician WHERE id = ?`, musicianID).Scan(&artist.ID, &artist.Name, &artist.AvatarURL)
+	if err != nil {
+		log.Println("UpdateArtist - reload error:", err)
+		http.Error(response, "Failed to load artist", http.StatusInternalServerError)
+		return
+	}
+	artist.AvatarURL = handler.Media.Image(artist.AvatarURL)
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(artist)
+}
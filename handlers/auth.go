@@ -6,29 +6,44 @@ import (
 	"log"
 	"net/http"
 	"strings"
-	"time"
 
+	"github.com/Edafi/MusicVibe/audit"
+	"github.com/Edafi/MusicVibe/jwtkeys"
+	"github.com/Edafi/MusicVibe/loginguard"
+	"github.com/Edafi/MusicVibe/mailer"
+	"github.com/Edafi/MusicVibe/mediaurl"
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/oidc"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtKey = []byte("1111")
-
 type Credentials struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Название устройства для списка активных сессий
+	DeviceName string `json:"deviceName"`
 }
 
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID    string `json:"user_id"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
 type AuthHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Keys   *jwtkeys.KeySet
+	Mailer mailer.Mailer
+	Guard  *loginguard.Guard
+	Audit  audit.Logger
+	OIDC   *oidc.Registry
+	// Адрес фронтенда для ссылок в письмах
+	AppURL string
+	Media  *mediaurl.Builder
 }
 
 // Регистрация
@@ -40,6 +55,37 @@ func (handler *AuthHandler) Register(response http.ResponseWriter, request *http
 		return
 	}
 
+	creds.Username = strings.TrimSpace(creds.Username)
+	creds.Email = normalizeEmail(creds.Email)
+
+	fields := ValidateAccount(creds.Username, creds.Email, creds.Password)
+	if len(fields) > 0 {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", fields)
+		return
+	}
+
+	// Проверка уникальности email и имени
+	var emailTaken, nameTaken bool
+	err := handler.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user WHERE email = ?)`, creds.Email).Scan(&emailTaken)
+	if err == nil {
+		err = handler.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user WHERE LOWER(username) = ?)`, strings.ToLower(creds.Username)).Scan(&nameTaken)
+	}
+	if err != nil {
+		log.Println("Uniqueness check error:", err)
+		http.Error(response, "Error checking user", http.StatusInternalServerError)
+		return
+	}
+	if emailTaken {
+		fields.Add("email", "Email is already registered")
+	}
+	if nameTaken {
+		fields.Add("username", "Username is already taken")
+	}
+	if len(fields) > 0 {
+		writeFieldErrors(response, http.StatusConflict, "User already exists", fields)
+		return
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Println("Hash error:", err)
@@ -53,48 +99,42 @@ func (handler *AuthHandler) Register(response http.ResponseWriter, request *http
 	default_background_path := "https://avatars.mds.yandex.net/i?id=2d0ed205049cd9c3b56db4cab9f02b9d_l-4255743-images-thumbs&n=13"
 	default_description := " "
 
-	query := `INSERT INTO user (id, username, email, passwd_hash, role, has_complete_setup, avatar_path, background_path, description) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err = handler.DB.Exec(query, id, creds.Username, creds.Email, hashedPassword, role, false, default_avatar_path, default_background_path, default_description)
-	if err != nil {
+	// Профиль музыканта не создаётся: слушатель становится артистом через POST /artists
+	query := `INSERT INTO user (id, username, email, passwd_hash, role, has_complete_setup, email_verified, avatar_path, background_path, description) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = handler.DB.Exec(query, id, creds.Username, creds.Email, hashedPassword, role, false, false, default_avatar_path, default_background_path, default_description)
+	if isDuplicateEntry(err) {
+		// Параллельная регистрация с теми же данными
+		writeFieldErrors(response, http.StatusConflict, "User already exists", FieldErrors{"email": "Email or username is already taken"})
+		return
+	} else if err != nil {
 		log.Println("Insert error:", err)
 		http.Error(response, "Error inserting user", http.StatusInternalServerError)
 		return
 	}
 
-	// Создание JWT
-	expiration := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		UserID: id,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiration),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	// Создание сессии и JWT
+	tokens, err := handler.createSession(request, id, role, creds.DeviceName)
 	if err != nil {
-		log.Println("Token error:", err)
-		http.Error(response, "Error signing token", http.StatusInternalServerError)
+		log.Println("Session error:", err)
+		http.Error(response, "Error creating session", http.StatusInternalServerError)
 		return
 	}
 
-	musician_id := uuid.New().String()
-	query = `INSERT INTO musician (id, user_id, name, avatar_path, name_lower) VALUES (?, ?, ?, ?, ?)`
-	_, err = handler.DB.Exec(query, musician_id, claims.UserID, creds.Username, default_avatar_path, strings.ToLower(creds.Username))
-	if err != nil {
-		log.Println("Insert error:", err)
-		http.Error(response, "Error inserting user", http.StatusInternalServerError)
-		return
+	// Письмо не критично для регистрации, его можно запросить повторно
+	if err := handler.sendVerificationEmail(request.Context(), id, creds.Email); err != nil {
+		log.Println("Verification email error:", err)
 	}
 
 	response.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(response).Encode(map[string]interface{}{
-		"token": tokenString,
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
 		"user": map[string]interface{}{
 			"id":                id,
 			"email":             creds.Email,
 			"username":          creds.Username,
 			"hasCompletedSetup": false, // по умолчанию
+			"emailVerified":     false,
 		},
 	})
 }
@@ -108,66 +148,108 @@ func (handler *AuthHandler) Login(response http.ResponseWriter, request *http.Re
 		return
 	}
 
-	var userID, username, email, passwordHash, role string
-	query := `SELECT id, username, email, passwd_hash, role FROM user WHERE email = ?`
-	err := handler.DB.QueryRow(query, creds.Email).Scan(&userID, &username, &email, &passwordHash, &role)
+	ctx := request.Context()
+	ip := clientIP(request)
+	account := normalizeEmail(creds.Email)
+
+	verdict, err := handler.Guard.Check(ctx, account, ip)
 	if err != nil {
-		log.Println("User not found:", err)
-		http.Error(response, "User not found", http.StatusUnauthorized)
+		log.Println("Login guard error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	if verdict.Blocked() {
+		handler.Audit.Log(ctx, audit.Event{Type: audit.EventLoginBlocked, IP: ip,
+			Details: map[string]interface{}{"account": account, "reason": verdict.Reason, "locked": verdict.Locked}})
+		writeTooManyAttempts(response, verdict.RetryAfter)
+		return
+	}
+
+	var userID, passwordHash string
+	query := `SELECT id, passwd_hash FROM user WHERE email = ?`
+	err = handler.DB.QueryRow(query, account).Scan(&userID, &passwordHash)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Login query error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(creds.Password)); err != nil {
-		log.Println("Password mismatch:", err)
+	// Для несуществующего пользователя всё равно сравниваем хэш, чтобы время ответа не отличалось
+	if err == sql.ErrNoRows {
+		passwordHash = dummyPasswordHash()
+	}
+	passwordErr := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(creds.Password))
+
+	if err == sql.ErrNoRows || passwordErr != nil {
+		log.Println("Login failed for", account)
+		handler.recordLoginFailure(ctx, account, userID, ip)
 		http.Error(response, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	expiration := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiration),
-		},
+	handler.recordLoginSuccess(ctx, account, userID, ip)
+
+	// При включённой 2FA настоящие токены выдаются только после POST /auth/2fa/verify
+	twoFactor, err := handler.twoFactorEnabled(userID)
+	if err != nil {
+		log.Println("2FA status error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor {
+		challenge, err := handler.issueMFAChallenge(userID, creds.DeviceName)
+		if err != nil {
+			log.Println("Challenge error:", err)
+			http.Error(response, "Error signing token", http.StatusInternalServerError)
+			return
+		}
+		response.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(response).Encode(map[string]interface{}{
+			"mfaRequired":    true,
+			"challengeToken": challenge,
+		})
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+
+	handler.completeLogin(response, request, userID, creds.DeviceName)
+}
+
+// Создаёт сессию и отдаёт ответ логина
+func (handler *AuthHandler) completeLogin(response http.ResponseWriter, request *http.Request, userID, device string) {
+	var username, email, role string
+	var hasCompletedSetup bool
+	query := `SELECT username, email, role, has_complete_setup FROM user WHERE id = ?`
+	if err := handler.DB.QueryRow(query, userID).Scan(&username, &email, &role, &hasCompletedSetup); err != nil {
+		log.Println("Login user error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := handler.createSession(request, userID, role, device)
 	if err != nil {
-		log.Println("Token error:", err)
-		http.Error(response, "Error signing token", http.StatusInternalServerError)
+		log.Println("Session error:", err)
+		http.Error(response, "Error creating session", http.StatusInternalServerError)
 		return
 	}
 
 	response.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(response).Encode(map[string]interface{}{
-		"token": tokenString,
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
 		"user": map[string]interface{}{
 			"id":                userID,
 			"email":             email,
 			"username":          username,
-			"hasCompletedSetup": false, // можно потом получить это из базы, если добавишь флаг
+			"hasCompletedSetup": hasCompletedSetup,
 		},
 	})
 }
 
 func (handler *AuthHandler) Me(response http.ResponseWriter, request *http.Request) {
-	authHeader := request.Header.Get("Authorization")
-	if authHeader == "" {
-		log.Println("Missing token")
-		http.Error(response, "Missing token", http.StatusUnauthorized)
-		return
-	}
-
-	tokenString := authHeader[len("Bearer "):]
-
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if err != nil || !token.Valid {
-		log.Println("Invalid token")
-		http.Error(response, "Invalid token", http.StatusUnauthorized)
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		log.Println("Me - UserID not found in context")
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -177,14 +259,15 @@ func (handler *AuthHandler) Me(response http.ResponseWriter, request *http.Reque
 		avatarPath                  string
 		backgroundPath, description sql.NullString
 		hasCompletedSetup           bool
+		emailVerified               bool
 	)
 
 	query := `
-		SELECT username, email, avatar_path, background_path, description, has_complete_setup 
+		SELECT username, email, avatar_path, background_path, description, has_complete_setup, email_verified
 		FROM user
 		WHERE id = ?`
-	err = handler.DB.QueryRow(query, claims.UserID).Scan(
-		&name, &email, &avatarPath, &backgroundPath, &description, &hasCompletedSetup)
+	err := handler.DB.QueryRow(query, userID).Scan(
+		&name, &email, &avatarPath, &backgroundPath, &description, &hasCompletedSetup, &emailVerified)
 	if err != nil {
 		log.Printf("User not found: %v", err)
 		http.Error(response, "User not found", http.StatusNotFound)
@@ -202,15 +285,13 @@ func (handler *AuthHandler) Me(response http.ResponseWriter, request *http.Reque
 		desc = description.String
 	}
 
-	hasSetup := false
-
 	// Жанры
 	genres := []string{}
 	rows, err := handler.DB.Query(`
 		SELECT g.name
 		FROM genre g
 		JOIN user_genre ug ON g.id = ug.genre_id
-		WHERE ug.user_id = ?`, claims.UserID)
+		WHERE ug.user_id = ?`, userID)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -229,7 +310,7 @@ func (handler *AuthHandler) Me(response http.ResponseWriter, request *http.Reque
 		SELECT sn.name, us.profile_url
 		FROM social_network sn
 		JOIN user_social_network us ON sn.id = us.social_network_id
-		WHERE us.user_id = ?`, claims.UserID)
+		WHERE us.user_id = ?`, userID)
 	if err == nil {
 		defer socialRows.Close()
 		for socialRows.Next() {
@@ -246,15 +327,23 @@ func (handler *AuthHandler) Me(response http.ResponseWriter, request *http.Reque
 	response.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(response).Encode(map[string]interface{}{
 		"user": map[string]interface{}{
-			"id":                claims.UserID,
+			"id":                userID,
 			"username":          name,
 			"email":             email,
-			"avatarUrl":         avatarPath,
-			"backgroundUrl":     bgPath,
+			"avatarUrl":         handler.Media.Image(avatarPath),
+			"backgroundUrl":     handler.Media.Image(bgPath),
 			"description":       desc,
 			"genres":            genres,
-			"hasCompletedSetup": hasSetup,
+			"hasCompletedSetup": hasCompletedSetup,
+			"emailVerified":     emailVerified,
 			"socialLinks":       socialLinks,
 		},
 	})
 }
+
+// GET /.well-known/jwks.json - публичные ключи для проверки наших токенов другими сервисами
+func (handler *AuthHandler) JWKS(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(response).Encode(handler.Keys.JWKS())
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Edafi/MusicVibe/imageproc"
+	"github.com/Edafi/MusicVibe/mediaurl"
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/repository"
+	"github.com/Edafi/MusicVibe/storage"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxTitleLength      = 255
+	maxAlbumDescription = 2000
+	// Сколько ждать удаления файлов и комментариев после удаления трека или альбома
+	deleteCleanupTimeout = 30 * time.Second
+)
+
+// Редактирование и удаление альбомов и треков их владельцем
+type CatalogEditHandler struct {
+	Catalog       repository.CatalogRepo
+	MongoDatabase *mongo.Database
+	Store         storage.BlobStore
+	Bucket        string
+	MaxImageBytes int64
+	Media         *mediaurl.Builder
+}
+
+// PATCH /album/{id}
+func (handler *CatalogEditHandler) UpdateAlbum(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	albumID := mux.Vars(request)["id"]
+	if _, err := handler.Catalog.OwnedAlbum(request.Context(), userID, albumID); errors.Is(err, repository.ErrNotFound) {
+		http.Error(response, "Album not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("UpdateAlbum - owner check error:", err)
+		http.Error(response, "Failed to update album", http.StatusInternalServerError)
+		return
+	}
+
+	var req struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		GenreID     *int    `json:"genreId"`
+		// Применяется ко всем трекам альбома
+		Visibility *string    `json:"visibility"`
+		ReleaseAt  *time.Time `json:"releaseAt"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		http.Error(response, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	fields := FieldErrors{}
+	if req.Title != nil {
+		*req.Title = strings.TrimSpace(*req.Title)
+		if length := utf8.RuneCountInString(*req.Title); length == 0 || length > maxTitleLength {
+			fields.Add("title", "Title must be between 1 and 255 characters")
+		}
+	}
+	if req.Description != nil && utf8.RuneCountInString(*req.Description) > maxAlbumDescription {
+		fields.Add("description", "Description is too long")
+	}
+	if req.GenreID != nil {
+		exists, err := handler.Catalog.GenreExists(request.Context(), *req.GenreID)
+		if err != nil {
+			log.Println("UpdateAlbum - genre check error:", err)
+			http.Error(response, "Failed to update album", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			fields.Add("genreId", "Unknown genre")
+		}
+	}
+	fields.Add(validateVisibilityChange(req.Visibility, req.ReleaseAt))
+	if len(fields) > 0 {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", fields)
+		return
+	}
+
+	changes := repository.AlbumChanges{Title: req.Title, Description: req.Description, GenreID: req.GenreID}
+	if req.Visibility != nil {
+		changes.Visibility = &repository.VisibilityChange{Visibility: *req.Visibility, ReleaseAt: req.ReleaseAt}
+	}
+	if err := handler.Catalog.UpdateAlbum(request.Context(), albumID, changes); err != nil {
+		log.Println("UpdateAlbum - update error:", err)
+		http.Error(response, "Failed to update album", http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /album/{id}/cover - заменяет обложку и все её варианты
+func (handler *CatalogEditHandler) ReplaceAlbumCover(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	albumID := mux.Vars(request)["id"]
+	musicianID, err := handler.Catalog.OwnedAlbum(request.Context(), userID, albumID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(response, "Album not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("ReplaceAlbumCover - owner check error:", err)
+		http.Error(response, "Failed to replace cover", http.StatusInternalServerError)
+		return
+	}
+
+	if err := parseMultipartForm(response, request, handler.MaxImageBytes+formOverheadBytes); err != nil {
+		log.Println("ReplaceAlbumCover - parse form error:", err)
+		writeFormError(response, err)
+		return
+	}
+
+	cover, problem := readImageUpload(request, "cover", handler.MaxImageBytes)
+	if problem != "" {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"cover": problem})
+		return
+	}
+	if bounds := cover.Bounds(); bounds.Dx() < imageproc.MinCoverSide || bounds.Dy() < imageproc.MinCoverSide {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"cover": "Cover must be at least 300x300 pixels"})
+		return
+	}
+
+	// Ключи объектов не меняются, поэтому новые варианты просто перезаписывают старые
+	coverPath, err := StoreImageVariants(request.Context(), handler.Store, handler.Bucket, storage.MusicianDir(musicianID), storage.KindCover, albumID, cover, imageproc.CoverVariants)
+	if err != nil {
+		log.Println("ReplaceAlbumCover - upload error:", err)
+		http.Error(response, "Failed to upload cover", http.StatusInternalServerError)
+		return
+	}
+	if err := handler.Catalog.SetAlbumCover(request.Context(), albumID, coverPath); err != nil {
+		log.Println("ReplaceAlbumCover - update error:", err)
+		http.Error(response, "Failed to save cover", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(map[string]interface{}{
+		"url": handler.Media.Image(coverPath),
+	})
+}
+
+// PATCH /track/{id}
+func (handler *CatalogEditHandler) UpdateTrack(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	trackID := mux.Vars(request)["id"]
+	if err := handler.Catalog.OwnedTrack(request.Context(), userID, trackID); errors.Is(err, repository.ErrNotFound) {
+		http.Error(response, "Track not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("UpdateTrack - owner check error:", err)
+		http.Error(response, "Failed to update track", http.StatusInternalServerError)
+		return
+	}
+
+	var req struct {
+		Title      *string    `json:"title"`
+		Visibility *string    `json:"visibility"`
+		ReleaseAt  *time.Time `json:"releaseAt"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		http.Error(response, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	fields := FieldErrors{}
+	if req.Title != nil {
+		*req.Title = strings.TrimSpace(*req.Title)
+		if length := utf8.RuneCountInString(*req.Title); length == 0 || length > maxTitleLength {
+			fields.Add("title", "Title must be between 1 and 255 characters")
+		}
+	}
+	fields.Add(validateVisibilityChange(req.Visibility, req.ReleaseAt))
+	if len(fields) > 0 {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", fields)
+		return
+	}
+
+	changes := repository.TrackChanges{Title: req.Title}
+	if req.Visibility != nil {
+		changes.Visibility = &repository.VisibilityChange{Visibility: *req.Visibility, ReleaseAt: req.ReleaseAt}
+	}
+	if err := handler.Catalog.UpdateTrack(request.Context(), trackID, changes); err != nil {
+		log.Println("UpdateTrack - update error:", err)
+		http.Error(response, "Failed to update track", http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /track/{id} - удаление необратимо. Трек сразу пропадает из каталога, избранного
+// и плейлистов, его файлы и комментарии удаляются здесь же. Строка с deleted_at остаётся,
+// пока purge не удалит её вместе с журналом прослушиваний; заодно purge дочищает файлы
+// и комментарии, которые не удалось удалить сразу
+func (handler *CatalogEditHandler) DeleteTrack(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	trackID := mux.Vars(request)["id"]
+	if err := handler.Catalog.OwnedTrack(request.Context(), userID, trackID); errors.Is(err, repository.ErrNotFound) {
+		http.Error(response, "Track not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("DeleteTrack - owner check error:", err)
+		http.Error(response, "Failed to delete track", http.StatusInternalServerError)
+		return
+	}
+
+	track, err := handler.Catalog.DeleteTrack(request.Context(), trackID, time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(response, "Track not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("DeleteTrack - delete error:", err)
+		http.Error(response, "Failed to delete track", http.StatusInternalServerError)
+		return
+	}
+	handler.removeDeletedData([]repository.DeletedTrack{track}, "")
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /album/{id} - удаляет альбом с обложкой и всеми треками, см. DeleteTrack
+func (handler *CatalogEditHandler) DeleteAlbum(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	albumID := mux.Vars(request)["id"]
+	musicianID, err := handler.Catalog.OwnedAlbum(request.Context(), userID, albumID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(response, "Album not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("DeleteAlbum - owner check error:", err)
+		http.Error(response, "Failed to delete album", http.StatusInternalServerError)
+		return
+	}
+
+	tracks, err := handler.Catalog.DeleteAlbum(request.Context(), albumID, time.Now())
+	if err != nil {
+		log.Println("DeleteAlbum - delete error:", err)
+		http.Error(response, "Failed to delete album", http.StatusInternalServerError)
+		return
+	}
+	handler.removeDeletedData(tracks, storage.ImagePrefix(storage.MusicianDir(musicianID), storage.KindCover, albumID))
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// Удаляет файлы треков, объекты с префиксом coverPrefix (если задан) и комментарии.
+// БД на них уже не ссылается, поэтому ошибки только логируем: остаток дочистит purge.
+// Контекст свой, чтобы очистка не прерывалась, если клиент закрыл соединение
+func (handler *CatalogEditHandler) removeDeletedData(tracks []repository.DeletedTrack, coverPrefix string) {
+	ctx, cancel := context.WithTimeout(context.Background(), deleteCleanupTimeout)
+	defer cancel()
+
+	var keys, trackIDs []string
+	for _, track := range tracks {
+		trackIDs = append(trackIDs, track.ID)
+		audioKey := storage.TrackAudioKey(track.MusicianID, track.ID)
+		keys = append(keys, audioKey)
+		if key, ok := storage.KeyFromStoredPath(handler.Bucket, track.FilePath); ok && key != audioKey {
+			keys = append(keys, key)
+		}
+	}
+	if coverPrefix != "" {
+		covers, err := handler.Store.List(ctx, coverPrefix)
+		if err != nil {
+			log.Println("Delete - list covers error:", err)
+		}
+		for _, object := range covers {
+			keys = append(keys, object.Key)
+		}
+	}
+	for _, key := range keys {
+		if err := handler.Store.Delete(ctx, key); err != nil {
+			log.Println("Delete - remove object error:", key, err)
+		}
+	}
+
+	if len(trackIDs) > 0 {
+		_, err := handler.MongoDatabase.Collection("track_comments").DeleteMany(ctx, bson.M{"track_id": bson.M{"$in": trackIDs}})
+		if err != nil {
+			log.Println("Delete - delete comments error:", err)
+		}
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Edafi/MusicVibe/mediaurl"
 	"github.com/Edafi/MusicVibe/middleware"
 	"github.com/Edafi/MusicVibe/models"
+	"github.com/Edafi/MusicVibe/repository"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -20,11 +22,17 @@ import (
 type CommentHandler struct {
 	DB            *sql.DB
 	MongoDatabase *mongo.Database
+	Tracks        repository.TrackRepo
+	Media         *mediaurl.Builder
 }
 
 func (handler *CommentHandler) GetTrackComments(response http.ResponseWriter, request *http.Request) {
 	trackID := mux.Vars(request)["id"]
 
+	if !handler.checkTrackVisible(response, request, trackID) {
+		return
+	}
+
 	// Получение комментариев из MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -32,7 +40,7 @@ func (handler *CommentHandler) GetTrackComments(response http.ResponseWriter, re
 	collection := handler.MongoDatabase.Collection("track_comments")
 
 	filter := bson.M{"track_id": trackID}
-	options := options.Find().SetSort(bson.D{{"created_at", -1}})
+	options := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
 	cursor, err := collection.Find(ctx, filter, options)
 	if err != nil {
 		log.Println("MongoDB error:", err)
@@ -57,33 +65,14 @@ func (handler *CommentHandler) GetTrackComments(response http.ResponseWriter, re
 			continue
 		}
 
-		// Получение информации о пользователе из MariaDB
-		var musician models.CommentAuthor
-		musician.ID = comment.UserID
-
-		if comment.UserID == "" {
-			log.Println("GetTrackComments - пустой user_id")
-			musician.Name = "Неизвестный пользователь"
-			musician.AvatarURL = "/avatarUser/default.png"
-		} else {
-			query := `SELECT name, avatar_path FROM musician WHERE id = ?`
-			err := handler.DB.QueryRow(query, comment.UserID).Scan(&musician.Name, &musician.AvatarURL)
-			if err == sql.ErrNoRows {
-				log.Println("GetTrackComments - музыкант не найден:", comment.UserID)
-				musician.Name = "Неизвестный пользователь"
-				musician.AvatarURL = "/avatarUser/default.png"
-			} else if err != nil {
-				log.Println("GetTrackComments - SQL ошибка:", err)
-				musician.Name = "Неизвестный пользователь"
-				musician.AvatarURL = "/avatarUser/default.png"
-			}
-		}
+		// Получение информации об авторе из MariaDB
+		author := handler.commentAuthor(comment.UserID)
 
 		results = append(results, models.CommentResponse{
 			ID:        comment.ID.Hex(),
 			Text:      comment.Comment,
 			CreatedAt: comment.CreatedAt,
-			User:      musician,
+			User:      author,
 		})
 	}
 
@@ -101,13 +90,8 @@ func (handler *CommentHandler) PostTrackComment(response http.ResponseWriter, re
 	userID := request.Context().Value(middleware.ContextUserIDKey).(string)
 	trackID := mux.Vars(request)["id"]
 
-	var musicianID, musician_avatar_path string
-	query := `SELECT m.id, m.avatar_path FROM musician AS m
-	JOIN user ON user.id = m.user_id
-	WHERE user.id = ?`
-	err := handler.DB.QueryRow(query, userID).Scan(&musicianID, &musician_avatar_path)
-	if err != nil {
-		log.Println("PostTrackComment 1 - SQL error for user", userID, ":", err)
+	if !handler.checkTrackVisible(response, request, trackID) {
+		return
 	}
 
 	var req models.CreateCommentRequest
@@ -118,9 +102,10 @@ func (handler *CommentHandler) PostTrackComment(response http.ResponseWriter, re
 
 	createdAt := time.Now()
 
+	// Автор комментария - пользователь, а не профиль музыканта: у слушателей его нет
 	comment := models.TrackComment{
 		TrackID:   trackID,
-		UserID:    musicianID,
+		UserID:    userID,
 		Comment:   req.Text,
 		CreatedAt: createdAt,
 	}
@@ -135,24 +120,85 @@ func (handler *CommentHandler) PostTrackComment(response http.ResponseWriter, re
 		return
 	}
 
-	var user models.CommentAuthor
-	user.ID = userID
-	query = `SELECT name, avatar_path FROM musician WHERE musician.id = ?`
-	err = handler.DB.QueryRow(query, musicianID).Scan(&user.Name, &user.AvatarURL)
-	if err != nil {
-		log.Println("PostTrackComment 2 - SQL error for user", userID, ":", err)
-		user.Name = "Неизвестный пользователь"
-		user.AvatarURL = "/avatarUser/default.png"
-	}
-
 	commentResponse := models.CommentResponse{
 		ID:        result.InsertedID.(primitive.ObjectID).Hex(),
 		Text:      req.Text,
 		CreatedAt: createdAt,
-		User:      user,
+		User:      handler.commentAuthor(userID),
 	}
 
 	response.Header().Set("Content-Type", "application/json")
 	response.WriteHeader(http.StatusCreated)
 	json.NewEncoder(response).Encode(commentResponse)
 }
+
+// DELETE /comments/{id} - модератор удаляет чужой комментарий
+func (handler *CommentHandler) DeleteComment(response http.ResponseWriter, request *http.Request) {
+	commentID, err := primitive.ObjectIDFromHex(mux.Vars(request)["id"])
+	if err != nil {
+		http.Error(response, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := handler.MongoDatabase.Collection("track_comments").DeleteOne(ctx, bson.M{"_id": commentID})
+	if err != nil {
+		log.Println("DeleteComment - Error deleting comment:", err)
+		http.Error(response, "Error deleting comment", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(response, "Comment not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("DeleteComment - comment %s deleted by moderator %s", commentID.Hex(), requestUserID(request))
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// Старые комментарии хранят id музыканта, новые - id пользователя
+func (handler *CommentHandler) commentAuthor(authorID string) models.CommentAuthor {
+	author := models.CommentAuthor{
+		ID:        authorID,
+		Name:      "Неизвестный пользователь",
+		AvatarURL: handler.Media.Image("/avatarUser/default.png"),
+	}
+	if authorID == "" {
+		log.Println("commentAuthor - пустой user_id")
+		return author
+	}
+
+	var name, avatarPath string
+	err := handler.DB.QueryRow(`SELECT username, avatar_path FROM user WHERE id = ?`, authorID).Scan(&name, &avatarPath)
+	if err == sql.ErrNoRows {
+		err = handler.DB.QueryRow(`SELECT name, avatar_path FROM musician WHERE id = ?`, authorID).Scan(&name, &avatarPath)
+	}
+	if err == sql.ErrNoRows {
+		log.Println("commentAuthor - автор не найден:", authorID)
+		return author
+	} else if err != nil {
+		log.Println("commentAuthor - SQL ошибка:", err)
+		return author
+	}
+
+	author.Name = name
+	author.AvatarURL = handler.Media.Image(avatarPath)
+	return author
+}
+
+// Комментарии скрытого трека недоступны так же, как сам трек
+func (handler *CommentHandler) checkTrackVisible(response http.ResponseWriter, request *http.Request, trackID string) bool {
+	visible, err := handler.Tracks.IsVisible(request.Context(), trackID, viewerFrom(request))
+	if err != nil {
+		log.Println("Comments - visibility error:", err)
+		http.Error(response, "Error fetching comments", http.StatusInternalServerError)
+		return false
+	}
+	if !visible {
+		http.Error(response, "Track not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/repository"
+	"github.com/gorilla/mux"
+)
+
+// Подделка отвечает только на IsVisible; остальные методы комментариям не нужны
+type fakeTrackRepo struct {
+	repository.TrackRepo
+	visible bool
+	err     error
+
+	trackID string
+	viewer  repository.Viewer
+}
+
+func (repo *fakeTrackRepo) IsVisible(ctx context.Context, trackID string, viewer repository.Viewer) (bool, error) {
+	repo.trackID, repo.viewer = trackID, viewer
+	return repo.visible, repo.err
+}
+
+func serveComments(handler *CommentHandler, method, target, body string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/comments/track/{id}", handler.GetTrackComments).Methods("GET")
+	router.HandleFunc("/comments/track/{id}", handler.PostTrackComment).Methods("POST")
+
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request = request.WithContext(context.WithValue(request.Context(), middleware.ContextUserIDKey, "user-1"))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCommentsOfHiddenTrackAreNotFound(t *testing.T) {
+	for _, method := range []string{"GET", "POST"} {
+		tracks := &fakeTrackRepo{}
+		recorder := serveComments(&CommentHandler{Tracks: tracks}, method, "/comments/track/track-1?share=secret", `{"text":"hi"}`)
+
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", method, recorder.Code)
+		}
+		want := repository.Viewer{UserID: "user-1", ShareToken: "secret"}
+		if tracks.trackID != "track-1" || tracks.viewer != want {
+			t.Errorf("%s: IsVisible(%q, %+v), want (%q, %+v)", method, tracks.trackID, tracks.viewer, "track-1", want)
+		}
+	}
+}
+
+func TestCommentsVisibilityError(t *testing.T) {
+	tracks := &fakeTrackRepo{err: errors.New("db down")}
+	recorder := serveComments(&CommentHandler{Tracks: tracks}, "GET", "/comments/track/track-1", "")
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", recorder.Code)
+	}
+}
+
+func TestPostCommentOnVisibleTrackReadsBody(t *testing.T) {
+	tracks := &fakeTrackRepo{visible: true}
+	recorder := serveComments(&CommentHandler{Tracks: tracks}, "POST", "/comments/track/track-1", "not json")
+
+	// Проверка видимости пройдена, запрос дошёл до разбора тела
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", recorder.Code)
+	}
+}
@@ -1,17 +1,18 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
 
 	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/repository"
 	"github.com/gorilla/mux"
 )
 
 type FavoritesHandler struct {
-	DB *sql.DB
+	Library repository.LibraryRepo
+	Tracks  repository.TrackRepo
 }
 
 // Получить избранные треки
@@ -24,31 +25,12 @@ func (handler *FavoritesHandler) GetFavoriteTracks(response http.ResponseWriter,
 		return
 	}
 
-	query := `
-		SELECT t.id
-		FROM liked_tracks lt
-		JOIN track t ON lt.track_id = t.id
-		WHERE lt.user_id = ?
-	`
-
-	rows, err := handler.DB.Query(query, userID)
+	trackIDs, err := handler.Library.LikedTrackIDs(request.Context(), userID)
 	if err != nil {
 		log.Println("GetFavoriteTracks - DB Query error:", err)
 		http.Error(response, "Failed to load favorite track IDs", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var trackIDs []string = make([]string, 0)
-	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
-			log.Println("GetFavoriteTracks - Row Scan error:", err)
-			http.Error(response, "Failed to parse track ID", http.StatusInternalServerError)
-			return
-		}
-		trackIDs = append(trackIDs, id)
-	}
 
 	response.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(response).Encode(trackIDs)
@@ -66,7 +48,19 @@ func (handler *FavoritesHandler) AddFavoriteTrack(response http.ResponseWriter,
 
 	trackID := mux.Vars(request)["id"]
 
-	_, err := handler.DB.Exec(`INSERT IGNORE INTO liked_tracks (user_id, track_id) VALUES (?, ?)`, userID, trackID)
+	viewer := repository.Viewer{UserID: userID, ShareToken: shareTokenFrom(request)}
+	visible, err := handler.Tracks.IsVisible(request.Context(), trackID, viewer)
+	if err != nil {
+		log.Println("AddFavoriteTrack - visibility error:", err)
+		http.Error(response, "Failed to add to favorites", http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.Error(response, "Track not found", http.StatusNotFound)
+		return
+	}
+
+	err = handler.Library.LikeTrack(request.Context(), userID, trackID)
 	if err != nil {
 		log.Println("AddFavoriteTrack - Insert error:", err)
 		http.Error(response, "Failed to add to favorites", http.StatusInternalServerError)
@@ -88,7 +82,7 @@ func (handler *FavoritesHandler) DeleteFavoriteTrack(response http.ResponseWrite
 
 	trackID := mux.Vars(request)["id"]
 
-	_, err := handler.DB.Exec(`DELETE FROM liked_tracks WHERE user_id = ? AND track_id = ?`, userID, trackID)
+	err := handler.Library.UnlikeTrack(request.Context(), userID, trackID)
 	if err != nil {
 		log.Println("DeleteFavoriteTrack - Delete error:", err)
 		http.Error(response, "Failed to remove from favorites", http.StatusInternalServerError)
@@ -109,31 +103,12 @@ func (handler *FavoritesHandler) GetFavoriteAlbums(response http.ResponseWriter,
 		return
 	}
 
-	query := `
-		SELECT a.id
-		FROM liked_albums la
-		JOIN album a ON la.album_id = a.id
-		WHERE la.user_id = ?
-	`
-
-	rows, err := handler.DB.Query(query, userID)
+	albumIDs, err := handler.Library.LikedAlbumIDs(request.Context(), userID)
 	if err != nil {
 		log.Println("GetFavoriteAlbums - DB Query error:", err)
 		http.Error(response, "Failed to load favorite album IDs", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var albumIDs []string = make([]string, 0)
-	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
-			log.Println("GetFavoriteAlbums - Row Scan error:", err)
-			http.Error(response, "Failed to parse album ID", http.StatusInternalServerError)
-			return
-		}
-		albumIDs = append(albumIDs, id)
-	}
 
 	response.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(response).Encode(albumIDs)
@@ -151,7 +126,7 @@ func (handler *FavoritesHandler) AddFavoriteAlbum(response http.ResponseWriter,
 
 	albumID := mux.Vars(request)["id"]
 
-	_, err := handler.DB.Exec(`INSERT IGNORE INTO liked_albums (user_id, album_id) VALUES (?, ?)`, userID, albumID)
+	err := handler.Library.LikeAlbum(request.Context(), userID, albumID)
 	if err != nil {
 		log.Println("AddFavoriteAlbum - Insert error:", err)
 		http.Error(response, "Failed to add album to favorites", http.StatusInternalServerError)
@@ -173,7 +148,7 @@ func (handler *FavoritesHandler) DeleteFavoriteAlbum(response http.ResponseWrite
 
 	albumID := mux.Vars(request)["id"]
 
-	_, err := handler.DB.Exec(`DELETE FROM liked_albums WHERE user_id = ? AND album_id = ?`, userID, albumID)
+	err := handler.Library.UnlikeAlbum(request.Context(), userID, albumID)
 	if err != nil {
 		log.Println("DeleteFavoriteAlbum - Delete error:", err)
 		http.Error(response, "Failed to remove album from favorites", http.StatusInternalServerError)
@@ -1,17 +1,17 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
 
 	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/repository"
 	"github.com/gorilla/mux"
 )
 
 type FollowingHandler struct {
-	DB *sql.DB
+	Library repository.LibraryRepo
 }
 
 // Получить подписанных музыкантов
@@ -24,28 +24,12 @@ func (handler *FollowingHandler) GetFollowingMusicians(response http.ResponseWri
 		return
 	}
 
-	rows, err := handler.DB.Query(`
-		SELECT m.id
-		FROM user_following uf
-		JOIN musician m ON uf.musician_id = m.id
-		WHERE uf.user_id = ?`, userID)
+	musicianIDs, err := handler.Library.FollowedMusicianIDs(request.Context(), userID)
 	if err != nil {
 		log.Println("GetFollowingMusicians - DB Query error:", err)
 		http.Error(response, "Failed to load followed musicians", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var musicianIDs []string = make([]string, 0)
-	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
-			log.Println("GetFollowingMusicians - Row Scan error:", err)
-			http.Error(response, "Failed to parse musician ID", http.StatusInternalServerError)
-			return
-		}
-		musicianIDs = append(musicianIDs, id)
-	}
 
 	response.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(response).Encode(musicianIDs)
@@ -72,7 +56,7 @@ func (handler *FollowingHandler) FollowMusician(response http.ResponseWriter, re
 
 	log.Println("Musician ID:", musicianID)
 
-	_, err := handler.DB.Exec("INSERT IGNORE INTO user_following (user_id, musician_id) VALUES (?, ?)", userID, musicianID)
+	err := handler.Library.Follow(request.Context(), userID, musicianID)
 	if err != nil {
 		http.Error(response, "Insert error", http.StatusInternalServerError)
 		return
@@ -101,7 +85,7 @@ func (handler *FollowingHandler) UnfollowMusician(response http.ResponseWriter,
 
 	log.Println("Musician ID:", musicianID)
 
-	_, err := handler.DB.Exec("DELETE FROM user_following WHERE user_id = ? AND musician_id = ?", userID, musicianID)
+	err := handler.Library.Unfollow(request.Context(), userID, musicianID)
 	if err != nil {
 		http.Error(response, "Delete error", http.StatusInternalServerError)
 		return
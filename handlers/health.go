@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Edafi/MusicVibe/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+// HealthHandler отвечает балансировщику: /healthz - процесс жив, /readyz - зависимости
+// доступны и сервер не останавливается
+type HealthHandler struct {
+	DB          *sql.DB
+	MongoClient *mongo.Client
+	Store       storage.BlobStore
+	// Закрывается в начале остановки, чтобы новые запросы уходили на другие серверы
+	ShuttingDown <-chan struct{}
+}
+
+type dependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	Status string                      `json:"status"`
+	Checks map[string]dependencyStatus `json:"checks"`
+}
+
+func (handler *HealthHandler) Healthz(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(map[string]string{"status": "ok"})
+}
+
+func (handler *HealthHandler) Readyz(response http.ResponseWriter, request *http.Request) {
+	checks := map[string]func(ctx context.Context) error{
+		"mysql":   handler.DB.PingContext,
+		"mongo":   func(ctx context.Context) error { return handler.MongoClient.Ping(ctx, nil) },
+		"storage": handler.Store.Ping,
+	}
+
+	// Зависимости проверяются параллельно, каждая со своим таймаутом
+	body := readinessResponse{Status: "ok", Checks: make(map[string]dependencyStatus, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(request.Context(), readinessCheckTimeout)
+			defer cancel()
+
+			started := time.Now()
+			err := check(ctx)
+			status := dependencyStatus{Status: "ok", LatencyMs: time.Since(started).Milliseconds()}
+			if err != nil {
+				status.Status, status.Error = "unavailable", err.Error()
+			}
+			mu.Lock()
+			body.Checks[name] = status
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	for _, status := range body.Checks {
+		if status.Status != "ok" {
+			body.Status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	select {
+	case <-handler.ShuttingDown:
+		body.Status, code = "shutting_down", http.StatusServiceUnavailable
+	default:
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("Cache-Control", "no-store")
+	response.WriteHeader(code)
+	json.NewEncoder(response).Encode(body)
+}
@@ -1,19 +1,20 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"path/filepath"
 
+	"github.com/Edafi/MusicVibe/mediaurl"
 	"github.com/Edafi/MusicVibe/middleware"
 	"github.com/Edafi/MusicVibe/models"
+	"github.com/Edafi/MusicVibe/repository"
 )
 
 type HomeHandler struct {
-	DB *sql.DB
+	Tracks repository.TrackRepo
+	Albums repository.AlbumRepo
+	Media  *mediaurl.Builder
 }
 
 type AlbumResponse struct {
@@ -21,294 +22,91 @@ type AlbumResponse struct {
 	Artist string `json:"artist"`
 }
 
-func (handler *HomeHandler) GetRecommendedTracks(response http.ResponseWriter, request *http.Request) {
-	val := request.Context().Value(middleware.ContextUserIDKey)
-	userID, ok := val.(string)
-	if !ok {
-		log.Println("UserID not found in context")
-		http.Error(response, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	query := `
-		SELECT t.id, t.musician_id, t.title, t.duration, t.file_path, t.stream_count,
-		m.name AS artist, a.cover_path, t.visibility
-		FROM track t
-		JOIN album a ON t.album_id = a.id
-		JOIN musician m ON t.musician_id = m.id
-		JOIN musician_genre mg ON m.id = mg.musician_id
-		JOIN user_genre ug ON mg.genre_id = ug.genre_id
-		WHERE ug.user_id = ? and t.visibility = 'public'
-		GROUP BY t.id
-		ORDER BY RAND()
-		LIMIT 50;
-	`
-
-	rows, err := handler.DB.Query(query, userID)
-	if err != nil {
-		log.Println("GetRecommendedTracks:", err)
-		http.Error(response, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var tracks []models.TrackResponse = make([]models.TrackResponse, 0)
-	for rows.Next() {
-		var tr models.TrackResponse
-		if err := rows.Scan(
-			&tr.ID, &tr.ArtistID, &tr.Title, &tr.Duration, &tr.AudioURL, &tr.Plays,
-			&tr.ArtistName, &tr.ImageURL, &tr.Visibility,
-		); err != nil {
-			log.Println("GetRecommendedTracks:", err)
-			http.Error(response, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		baseURL := "http://37.46.130.29:8080"
-		tr.AudioURL = fmt.Sprintf("%s/media/audio/%s", baseURL, tr.ID)
-		tr.ImageURL = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(tr.ImageURL))
-		tracks = append(tracks, tr)
-	}
+const (
+	recommendationsLimit = 50
+	homeSectionLimit     = 8
+)
 
-	response.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(response).Encode(tracks)
+func (handler *HomeHandler) GetRecommendedTracks(response http.ResponseWriter, request *http.Request) {
+	handler.writeRecommendedTracks(response, request, "GetRecommendedTracks", recommendationsLimit)
 }
 
 func (handler *HomeHandler) GetRecommendedAlbums(response http.ResponseWriter, request *http.Request) {
-	val := request.Context().Value(middleware.ContextUserIDKey)
-	userID, ok := val.(string)
-	if !ok {
-		log.Println("UserID not found in context")
-		http.Error(response, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	handler.writeRecommendedAlbums(response, request, "GetRecommendedAlbums", recommendationsLimit)
+}
 
-	query := `
-		SELECT a.id, a.title, a.musician_id, m.name AS artist_name,
-		a.cover_path, YEAR(a.release_date), a.description
-		FROM album a
-		JOIN musician m ON a.musician_id = m.id
-		JOIN user_genre ug ON a.genre_id = ug.genre_id
-		WHERE ug.user_id = ?
-		ORDER BY RAND()
-		LIMIT 50;
-	`
+func (handler *HomeHandler) GetTrackedTracks(response http.ResponseWriter, request *http.Request) {
+	handler.writeLikedTracks(response, request, "GetTrackedTracks", 0)
+}
 
-	rows, err := handler.DB.Query(query, userID)
-	if err != nil {
-		log.Println("GetRecommendedAlbums:", err)
-		http.Error(response, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-	var albums []models.RecommendedAlbum = make([]models.RecommendedAlbum, 0)
-	for rows.Next() {
-		var al models.RecommendedAlbum
-		if err := rows.Scan(
-			&al.ID, &al.Title, &al.ArtistID, &al.ArtistName,
-			&al.CoverUrl, &al.Year, &al.Description,
-		); err != nil {
-			log.Println("GetRecommendedAlbums:", err)
-			http.Error(response, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		baseURL := "http://37.46.130.29:8080"
-		al.CoverUrl = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(al.CoverUrl))
-		albums = append(albums, al)
-	}
+func (handler *HomeHandler) GetHomeRecommendedTracks(response http.ResponseWriter, request *http.Request) {
+	handler.writeRecommendedTracks(response, request, "GetHomeRecommendedTracks", homeSectionLimit)
+}
 
-	response.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(response).Encode(albums)
+func (handler *HomeHandler) GetHomeRecommendedAlbums(response http.ResponseWriter, request *http.Request) {
+	handler.writeRecommendedAlbums(response, request, "GetHomeRecommendedAlbums", homeSectionLimit)
 }
 
-func (handler *HomeHandler) GetTrackedTracks(response http.ResponseWriter, request *http.Request) {
-	val := request.Context().Value(middleware.ContextUserIDKey)
-	userID, ok := val.(string)
+func (handler *HomeHandler) GetHomeTrackedTracks(response http.ResponseWriter, request *http.Request) {
+	handler.writeLikedTracks(response, request, "GetHomeTrackedTracks", homeSectionLimit)
+}
+
+func contextUserID(response http.ResponseWriter, request *http.Request) (string, bool) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
 	if !ok {
 		log.Println("UserID not found in context")
 		http.Error(response, "Unauthorized", http.StatusUnauthorized)
-		return
 	}
-	query := `
-		SELECT t.id, t.title, t.musician_id, m.name AS artist_name, a.cover_path,
-		t.file_path, t.duration, t.stream_count, t.visibility
-		FROM liked_tracks lt
-		JOIN track t ON lt.track_id = t.id
-		JOIN album a ON t.album_id = a.id
-		JOIN musician m ON t.musician_id = m.id
-		WHERE lt.user_id = ? and t.visibility = 'public';
-	`
-
-	rows, err := handler.DB.Query(query, userID)
-	if err != nil {
-		log.Println("GetTrackedTracks:", err)
-		http.Error(response, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var tracks []models.TrackResponse = make([]models.TrackResponse, 0)
-	for rows.Next() {
-		var tr models.TrackResponse
-		if err := rows.Scan(
-			&tr.ID, &tr.ArtistID, &tr.Title, &tr.Duration, &tr.AudioURL, &tr.Plays,
-			&tr.ArtistName, &tr.ImageURL, &tr.Visibility,
-		); err != nil {
-			log.Println("GetTrackedTracks:", err)
-			http.Error(response, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		baseURL := "http://37.46.130.29:8080"
-		tr.AudioURL = fmt.Sprintf("%s/media/audio/%s", baseURL, tr.ID)
-		tr.ImageURL = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(tr.ImageURL))
-		tracks = append(tracks, tr)
-	}
-
-	response.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(response).Encode(tracks)
+	return userID, ok
 }
 
-func (handler *HomeHandler) GetHomeRecommendedTracks(response http.ResponseWriter, request *http.Request) {
-	val := request.Context().Value(middleware.ContextUserIDKey)
-	userID, ok := val.(string)
+func (handler *HomeHandler) writeRecommendedTracks(response http.ResponseWriter, request *http.Request, name string, limit int) {
+	userID, ok := contextUserID(response, request)
 	if !ok {
-		log.Println("UserID not found in context")
-		http.Error(response, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	query := `
-		SELECT 
-		t.id, t.title, t.musician_id, m.name AS artist_name, a.cover_path,
-		t.file_path, t.duration, t.stream_count, t.visibility
-		FROM track t
-		JOIN album a ON t.album_id = a.id
-		JOIN musician m ON t.musician_id = m.id
-		JOIN musician_genre mg ON m.id = mg.musician_id
-		JOIN user_genre ug ON mg.genre_id = ug.genre_id
-		WHERE t.visibility = 'public' and ug.user_id = ?
-		GROUP BY t.id
-		ORDER BY RAND()
-		LIMIT 8;
-	`
-	rows, err := handler.DB.Query(query, userID)
+	tracks, err := handler.Tracks.ListRecommended(request.Context(), userID, limit)
 	if err != nil {
-		log.Println("GetHomeRecommendedTracks:", err)
+		log.Println(name+":", err)
 		http.Error(response, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-	var tracks []models.TrackResponse = make([]models.TrackResponse, 0)
-	for rows.Next() {
-		var tr models.TrackResponse
-		if err := rows.Scan(
-			&tr.ID, &tr.Title, &tr.ArtistID, &tr.ArtistName, &tr.ImageURL,
-			&tr.AudioURL, &tr.Duration, &tr.Plays, &tr.Visibility,
-		); err != nil {
-			log.Println("GetHomeRecommendedTracks:", err)
-			http.Error(response, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		baseURL := "http://37.46.130.29:8080"
-		tr.AudioURL = fmt.Sprintf("%s/media/audio/%s", baseURL, tr.ID)
-		tr.ImageURL = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(tr.ImageURL))
-		tracks = append(tracks, tr)
-	}
 
 	response.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(response).Encode(tracks)
+	json.NewEncoder(response).Encode(presentTracks(handler.Media, viewerFrom(request), tracks))
 }
 
-func (handler *HomeHandler) GetHomeRecommendedAlbums(response http.ResponseWriter, request *http.Request) {
-	val := request.Context().Value(middleware.ContextUserIDKey)
-	userID, ok := val.(string)
+func (handler *HomeHandler) writeLikedTracks(response http.ResponseWriter, request *http.Request, name string, limit int) {
+	userID, ok := contextUserID(response, request)
 	if !ok {
-		log.Println("UserID not found in context")
-		http.Error(response, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	query := `
-		SELECT a.id, a.title, a.musician_id, m.name AS artist_name,
-		a.cover_path, YEAR(a.release_date), a.description
-		FROM album a
-		JOIN musician m ON a.musician_id = m.id
-		JOIN user_genre ug ON a.genre_id = ug.genre_id
-		WHERE ug.user_id = ?
-		ORDER BY RAND()
-		LIMIT 8;
-	`
-
-	rows, err := handler.DB.Query(query, userID)
+	tracks, err := handler.Tracks.ListLiked(request.Context(), userID, limit)
 	if err != nil {
-		log.Println("GetHomeRecommendedAlbums:", err)
+		log.Println(name+":", err)
 		http.Error(response, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var albums []models.RecommendedAlbum = make([]models.RecommendedAlbum, 0)
-	for rows.Next() {
-		var al models.RecommendedAlbum
-		if err := rows.Scan(
-			&al.ID, &al.Title, &al.ArtistID, &al.ArtistName,
-			&al.CoverUrl, &al.Year, &al.Description,
-		); err != nil {
-			log.Println("GetHomeRecommendedAlbums:", err)
-			http.Error(response, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		baseURL := "http://37.46.130.29:8080"
-		al.CoverUrl = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(al.CoverUrl))
-		albums = append(albums, al)
-	}
 
 	response.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(response).Encode(albums)
+	json.NewEncoder(response).Encode(presentTracks(handler.Media, viewerFrom(request), tracks))
 }
 
-func (handler *HomeHandler) GetHomeTrackedTracks(response http.ResponseWriter, request *http.Request) {
-	val := request.Context().Value(middleware.ContextUserIDKey)
-	userID, ok := val.(string)
+func (handler *HomeHandler) writeRecommendedAlbums(response http.ResponseWriter, request *http.Request, name string, limit int) {
+	userID, ok := contextUserID(response, request)
 	if !ok {
-		log.Println("UserID not found in context")
-		http.Error(response, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-
-	query := `
-		SELECT t.id, t.title, t.musician_id, m.name AS artist_name, a.cover_path,
-		t.file_path, t.duration, t.stream_count, t.visibility
-		FROM liked_tracks lt
-		JOIN track t ON lt.track_id = t.id
-		JOIN album a ON t.album_id = a.id
-		JOIN musician m ON t.musician_id = m.id
-		WHERE lt.user_id = ? and t.visibility = 'public'
-		LIMIT 8;
-	`
-
-	rows, err := handler.DB.Query(query, userID)
+	albums, err := handler.Albums.ListRecommended(request.Context(), userID, limit)
 	if err != nil {
-		log.Println("GetHomeTrackedTracks:", err)
+		log.Println(name+":", err)
 		http.Error(response, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var tracks []models.TrackResponse = make([]models.TrackResponse, 0)
-	for rows.Next() {
-		var tr models.TrackResponse
-		if err := rows.Scan(
-			&tr.ID, &tr.Title, &tr.ArtistID, &tr.ArtistName, &tr.ImageURL, &tr.AudioURL,
-			&tr.Duration, &tr.Plays, &tr.Visibility,
-		); err != nil {
-			log.Println("GetHomeTrackedTracks:", err)
-			http.Error(response, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		baseURL := "http://37.46.130.29:8080"
-		tr.AudioURL = fmt.Sprintf("%s/media/audio/%s", baseURL, tr.ID)
-		tr.ImageURL = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(tr.ImageURL))
-		tracks = append(tracks, tr)
+	for i := range albums {
+		albums[i].CoverUrl = handler.Media.Image(albums[i].CoverUrl)
 	}
 
 	response.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(response).Encode(tracks)
+	json.NewEncoder(response).Encode(albums)
 }
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Edafi/MusicVibe/audit"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// Хэш случайного пароля с той же стоимостью, что и у настоящих
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+		if err != nil {
+			log.Println("dummyPasswordHash - hash error:", err)
+		}
+		dummyHash = hash
+	})
+	return string(dummyHash)
+}
+
+func writeTooManyAttempts(response http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	response.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(response, "Too many login attempts, try again later", http.StatusTooManyRequests)
+}
+
+func (handler *AuthHandler) recordLoginFailure(ctx context.Context, account, userID, ip string) {
+	verdict, err := handler.Guard.Failure(ctx, account, ip)
+	if err != nil {
+		log.Println("recordLoginFailure - guard error:", err)
+		return
+	}
+
+	handler.Audit.Log(ctx, audit.Event{Type: audit.EventLoginFailed, UserID: userID, IP: ip,
+		Details: map[string]interface{}{"account": account}})
+
+	if verdict.Locked {
+		eventType := audit.EventAccountLocked
+		if verdict.Reason == "ip" {
+			eventType = audit.EventIPLocked
+		}
+		handler.Audit.Log(ctx, audit.Event{Type: eventType, UserID: userID, IP: ip,
+			Details: map[string]interface{}{"account": account, "lockedFor": verdict.RetryAfter.String()}})
+	}
+}
+
+func (handler *AuthHandler) recordLoginSuccess(ctx context.Context, account, userID, ip string) {
+	failures, err := handler.Guard.AccountFailures(ctx, account)
+	if err == nil && failures > 0 {
+		handler.Audit.Log(ctx, audit.Event{Type: audit.EventLoginAfterFails, UserID: userID, IP: ip,
+			Details: map[string]interface{}{"failures": failures}})
+	}
+
+	if err := handler.Guard.Success(ctx, account); err != nil {
+		log.Println("recordLoginSuccess - guard error:", err)
+	}
+}
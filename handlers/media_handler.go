@@ -1,24 +1,29 @@
 package handlers
 
 import (
-	"context"
-	"database/sql"
-	"fmt"
-	"io"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
-
+	"time"
+
+	"github.com/Edafi/MusicVibe/imageproc"
+	"github.com/Edafi/MusicVibe/mediasign"
+	"github.com/Edafi/MusicVibe/metrics"
+	"github.com/Edafi/MusicVibe/repository"
+	"github.com/Edafi/MusicVibe/storage"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/minio/minio-go/v7"
 )
 
 type MediaHandler struct {
-	MinioClient *minio.Client
-	BucketName  string
-	DB          *sql.DB
+	Store  storage.BlobStore
+	Tracks repository.TrackRepo
+	Albums repository.AlbumRepo
+	Signer *mediasign.Signer
 }
 
+// GET /media/audio/{trackId}?token=... - токен выдаётся вместе с TrackResponse
 func (h *MediaHandler) ServeAudio(w http.ResponseWriter, r *http.Request) {
 	trackID := mux.Vars(r)["trackId"]
 	if trackID == "" {
@@ -26,44 +31,98 @@ func (h *MediaHandler) ServeAudio(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 1. Получаем musician_id из БД
-	var musicianID string
-	log.Println("Trying to fetch musicianID for track:", trackID)
-	err := h.DB.QueryRow("SELECT musician_id FROM track WHERE id = ?", trackID).Scan(&musicianID)
-	if err != nil {
-		log.Println("ServeAudio: failed to get musician_id:", err)
+	// 1. Проверяем подписанный токен: без него каталог можно было бы выкачать перебором ID
+	claims, err := h.Signer.VerifyAudio(r.URL.Query().Get("token"))
+	if errors.Is(err, mediasign.ErrExpired) {
+		http.Error(w, "Link expired", http.StatusForbidden)
+		return
+	} else if err != nil || claims.TrackID != trackID {
+		http.Error(w, "Invalid media token", http.StatusForbidden)
+		return
+	}
+
+	// 2. Получаем musician_id из БД, учитывая видимость трека для владельца токена
+	viewer := repository.Viewer{UserID: claims.UserID, ShareToken: shareTokenFrom(r)}
+	musicianID, err := h.Tracks.MusicianID(r.Context(), trackID, viewer)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "Track not found", http.StatusNotFound)
 		return
+	} else if err != nil {
+		log.Println("ServeAudio: failed to get musician_id:", err)
+		http.Error(w, "Failed to fetch audio", http.StatusInternalServerError)
+		return
 	}
-	log.Println("Found musicianID:", musicianID)
 
-	// 2. Увеличиваем счетчик прослушиваний
-	_, err = h.DB.Exec("UPDATE track SET stream_count = stream_count + 1 WHERE id = ?", trackID)
-	if err != nil {
-		log.Println("ServeAudio: failed to increment stream count:", err)
-		// Не прерываем выполнение, просто логируем ошибку
+	objectName := storage.TrackAudioKey(musicianID, trackID)
+
+	// 3. Можно отдать файл напрямую из хранилища, не гоняя трафик через сервер.
+	// Presign не проверяет, что объект существует, поэтому сначала Stat
+	if h.Signer.PresignTTL > 0 {
+		if _, err := h.Store.Stat(r.Context(), objectName); errors.Is(err, storage.ErrNotFound) {
+			log.Println("ServeAudio: object not found:", objectName)
+			http.Error(w, "Audio not found", http.StatusNotFound)
+			return
+		}
+		presigned, err := h.Store.Presign(r.Context(), objectName, h.Signer.PresignTTL)
+		if err == nil {
+			h.recordStream(r, trackID, claims.UserID)
+			w.Header().Set("Cache-Control", "no-store")
+			http.Redirect(w, r, presigned, http.StatusFound)
+			return
+		}
+		if !errors.Is(err, storage.ErrPresignUnsupported) {
+			log.Println("ServeAudio: presign failed, streaming instead:", err)
+		}
 	}
 
-	// 3. Достаём аудио из MinIO
-	objectName := fmt.Sprintf("musician_%s/tracks/track_%s.mp3", musicianID, trackID)
-	obj, err := h.MinioClient.GetObject(context.Background(), h.BucketName, objectName, minio.GetObjectOptions{})
-	if err != nil {
+	// 4. Достаём аудио из хранилища; Range-запросы обслуживает ServeContent
+	obj, err := h.Store.Open(r.Context(), objectName)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Println("ServeAudio: object not found:", objectName)
+		http.Error(w, "Audio not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		log.Println("ServeAudio: error getting object:", err)
 		http.Error(w, "Failed to fetch audio", http.StatusInternalServerError)
 		return
 	}
 	defer obj.Close()
 
-	stat, err := obj.Stat()
-	if err != nil {
-		log.Println("ServeAudio: object stat failed:", err)
-		http.Error(w, "Audio not found", http.StatusNotFound)
+	// 5. Прослушивание засчитывается, только если файл действительно есть
+	h.recordStream(r, trackID, claims.UserID)
+
+	metrics.ActiveStreams.Inc()
+	defer metrics.ActiveStreams.Dec()
+
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, "", obj.Info().LastModified, obj)
+}
+
+// recordStream увеличивает счетчик прослушиваний. Плеер догружает файл Range-запросами,
+// поэтому считаем только запрос с начала файла
+func (h *MediaHandler) recordStream(r *http.Request, trackID, userID string) {
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && rangeHeader != "bytes=0-" {
 		return
 	}
+	if err := h.Tracks.RecordStream(r.Context(), trackID, userID, time.Now()); err != nil {
+		// Не прерываем выполнение, просто логируем ошибку
+		log.Println("ServeAudio: failed to record stream:", err)
+	}
+}
 
-	w.Header().Set("Content-Type", "audio/mpeg")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size))
-	io.Copy(w, obj)
+// Ссылки на изображения подписаны надолго, чтобы браузеры и CDN могли их кэшировать
+func (h *MediaHandler) verifyImageSignature(w http.ResponseWriter, r *http.Request) bool {
+	query := r.URL.Query()
+	err := h.Signer.VerifyImage(r.URL.Path, query.Get("exp"), query.Get("sig"))
+	if errors.Is(err, mediasign.ErrExpired) {
+		http.Error(w, "Link expired", http.StatusForbidden)
+		return false
+	} else if err != nil {
+		http.Error(w, "Invalid image signature", http.StatusForbidden)
+		return false
+	}
+	return true
 }
 
 func (h *MediaHandler) ServeImage(w http.ResponseWriter, r *http.Request) {
@@ -72,45 +131,121 @@ func (h *MediaHandler) ServeImage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing filename", http.StatusBadRequest)
 		return
 	}
-
-	if !strings.HasPrefix(filename, "album_") {
-		http.Error(w, "Invalid filename format", http.StatusBadRequest)
+	if !h.verifyImageSignature(w, r) {
 		return
 	}
 
-	if !strings.HasSuffix(filename, ".jpg") {
-		filename += ".jpg"
+	name := strings.TrimSuffix(filename, ".jpg")
+	switch {
+	case strings.HasPrefix(name, "album_"):
+		albumID := strings.TrimPrefix(name, "album_")
+
+		musicianID, err := h.Albums.MusicianID(r.Context(), albumID)
+		if err != nil {
+			log.Println("ServeImage: failed to get musician_id for album", albumID, "error:", err)
+			http.Error(w, "Album not found", http.StatusNotFound)
+			return
+		}
+		h.serveImageVariant(w, r, storage.MusicianDir(musicianID), storage.KindCover, albumID)
+
+	case strings.HasPrefix(name, "avatar_"):
+		// Аватар музыканта: musician_{id}/avatar/avatar_{id}.jpg
+		musicianID := strings.TrimPrefix(name, "avatar_")
+		if _, err := uuid.Parse(musicianID); err != nil {
+			http.Error(w, "Invalid filename format", http.StatusBadRequest)
+			return
+		}
+		h.serveImageVariant(w, r, storage.MusicianDir(musicianID), storage.KindAvatar, musicianID)
+
+	default:
+		http.Error(w, "Invalid filename format", http.StatusBadRequest)
 	}
+}
 
-	albumID := strings.TrimPrefix(strings.TrimSuffix(filename, ".jpg"), "album_")
-
-	var musicianID string
-	log.Println("Trying to fetch albumID:", albumID)
-	err := h.DB.QueryRow("SELECT musician_id FROM album WHERE id = ?", albumID).Scan(&musicianID)
-	if err != nil {
-		log.Println("ServeImage: failed to get musician_id for album", albumID, "error:", err)
-		http.Error(w, "Album not found", http.StatusNotFound)
+// GET /media/image/{kind}/{id}?size=thumb|small|medium|large
+func (h *MediaHandler) ServeImageByKind(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kind, id := vars["kind"], vars["id"]
+	if !h.verifyImageSignature(w, r) {
+		return
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Invalid image id", http.StatusBadRequest)
 		return
 	}
-	log.Println("Found musicianID:", musicianID)
 
-	objectPath := fmt.Sprintf("musician_%s/cover/%s", musicianID, filename)
+	switch kind {
+	case "avatar", "background":
+		h.serveImageVariant(w, r, storage.MusicianDir(id), kind, id)
+	case "user-avatar", "user-background":
+		h.serveImageVariant(w, r, storage.UserDir(id), strings.TrimPrefix(kind, "user-"), id)
+	case "cover":
+		musicianID, err := h.Albums.MusicianID(r.Context(), id)
+		if err != nil {
+			log.Println("ServeImageByKind: failed to get musician_id for album", id, "error:", err)
+			http.Error(w, "Album not found", http.StatusNotFound)
+			return
+		}
+		h.serveImageVariant(w, r, storage.MusicianDir(musicianID), storage.KindCover, id)
+	default:
+		http.Error(w, "Unknown image kind", http.StatusNotFound)
+	}
+}
 
-	obj, err := h.MinioClient.GetObject(r.Context(), h.BucketName, objectPath, minio.GetObjectOptions{})
-	if err != nil {
-		log.Println("ServeImage: error getting object:", err)
-		http.Error(w, "Image not found", http.StatusNotFound)
+// Выбирает вариант по ?size= и заголовку Accept. Если нужного размера или WebP нет
+// (изображение загружено до появления вариантов) - отдаёт оригинал
+func (h *MediaHandler) serveImageVariant(w http.ResponseWriter, r *http.Request, dir, kind, id string) {
+	size := r.URL.Query().Get("size")
+	if size != "" && !imageproc.IsVariantName(size) {
+		http.Error(w, "Invalid size", http.StatusBadRequest)
 		return
 	}
-	defer obj.Close()
 
-	// Проверяем, что объект существует
-	if _, err := obj.Stat(); err != nil {
-		log.Println("ServeImage: object stat failed:", err)
-		http.Error(w, "Image not found", http.StatusNotFound)
+	var candidates []string
+	for _, variant := range []string{size, ""} {
+		name := storage.ImageKey(dir, kind, id, variant)
+		if acceptsWebP(r) {
+			candidates = append(candidates, storage.WebPKey(name))
+		}
+		candidates = append(candidates, name)
+		if variant == "" {
+			break
+		}
+	}
+
+	for _, objectPath := range candidates {
+		obj, err := h.Store.Open(r.Context(), objectPath)
+		if err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				log.Println("ServeImage: open error:", objectPath, err)
+			}
+			continue
+		}
+		stat := obj.Info()
+
+		contentType := "image/jpeg"
+		if strings.HasPrefix(stat.ContentType, "image/") {
+			contentType = stat.ContentType
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Vary", "Accept")
+		w.Header().Set("ETag", `"`+stat.ETag+`"`)
+		// Обложки меняются редко, но владелец может их заменить - после истечения срока
+		// клиент перепроверяет ETag и получает 304, если изображение то же
+		if kind == storage.KindCover {
+			w.Header().Set("Cache-Control", "public, max-age=86400, stale-while-revalidate=604800")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+		}
+		http.ServeContent(w, r, "", stat.LastModified, obj)
+		obj.Close()
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
-	io.Copy(w, obj)
+	log.Println("ServeImage: no object found for", dir, kind, id)
+	http.Error(w, "Image not found", http.StatusNotFound)
+}
+
+func acceptsWebP(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "image/webp")
 }
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Edafi/MusicVibe/mediaurl"
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/models"
+	"github.com/Edafi/MusicVibe/repository"
+)
+
+// Ссылки на аудио подписываются для пользователя, от имени которого выполняется запрос
+func requestUserID(request *http.Request) string {
+	userID, _ := request.Context().Value(middleware.ContextUserIDKey).(string)
+	return userID
+}
+
+// Пути из БД -> ссылки для клиента. Треки по ссылке (unlisted) проигрываются
+// с тем же share-токеном, с которым открыт список, как и в GetTrack
+func presentTracks(media *mediaurl.Builder, viewer repository.Viewer, tracks []models.TrackResponse) []models.TrackResponse {
+	for i := range tracks {
+		shareToken := ""
+		if tracks[i].Visibility == VisibilityUnlisted {
+			shareToken = viewer.ShareToken
+		}
+		tracks[i].AudioURL = media.Audio(viewer.UserID, tracks[i].ID, shareToken)
+		tracks[i].ImageURL = media.Image(tracks[i].ImageURL)
+	}
+	return tracks
+}
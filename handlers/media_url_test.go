@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Edafi/MusicVibe/mediasign"
+	"github.com/Edafi/MusicVibe/mediaurl"
+	"github.com/Edafi/MusicVibe/models"
+	"github.com/Edafi/MusicVibe/repository"
+)
+
+func TestPresentTracksCarriesShareTokenForUnlisted(t *testing.T) {
+	media := mediaurl.New("https://api.example.com", "", "music", mediasign.NewEphemeralSigner())
+	tracks := presentTracks(media, repository.Viewer{UserID: "user-1", ShareToken: "secret"}, []models.TrackResponse{
+		{ID: "unlisted", Visibility: VisibilityUnlisted},
+		{ID: "public", Visibility: VisibilityPublic},
+	})
+
+	for _, tc := range []struct {
+		track models.TrackResponse
+		want  string
+	}{
+		{tracks[0], "secret"},
+		{tracks[1], ""},
+	} {
+		parsed, err := url.Parse(tc.track.AudioURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := parsed.Query().Get("share"); got != tc.want {
+			t.Errorf("%s: share = %q, want %q", tc.track.ID, got, tc.want)
+		}
+	}
+}
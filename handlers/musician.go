@@ -1,22 +1,47 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
-	"path/filepath"
-	"time"
-
-	"github.com/gorilla/mux"
 
+	"github.com/Edafi/MusicVibe/mediaurl"
 	"github.com/Edafi/MusicVibe/middleware"
 	"github.com/Edafi/MusicVibe/models"
+	"github.com/Edafi/MusicVibe/repository"
+	"github.com/gorilla/mux"
 )
 
 type MusicianHandler struct {
-	DB *sql.DB
+	Musicians repository.MusicianRepo
+	Albums    repository.AlbumRepo
+	Tracks    repository.TrackRepo
+	Library   repository.LibraryRepo
+	Media     *mediaurl.Builder
+}
+
+const popularTracksLimit = 10
+
+// Дополняет музыканта жанрами, соцсетями и альбомами и переводит пути в ссылки
+func (handler *MusicianHandler) fillMusician(ctx context.Context, viewer repository.Viewer, musician *models.Musician) error {
+	var err error
+	if musician.Genres, err = handler.Musicians.Genres(ctx, musician.ID); err != nil {
+		return err
+	}
+	if musician.SocialLinks, err = handler.Musicians.SocialLinks(ctx, musician.UserID); err != nil {
+		return err
+	}
+	if musician.Albums, err = handler.Albums.ListByMusician(ctx, musician.ID, viewer); err != nil {
+		return err
+	}
+	for i := range musician.Albums {
+		musician.Albums[i].CoverUrl = handler.Media.Image(musician.Albums[i].CoverUrl)
+	}
+	musician.AvatarPath = handler.Media.Image(musician.AvatarPath)
+	musician.BackgroundPath = handler.Media.Image(musician.BackgroundPath)
+	return nil
 }
 
 // --------------------- GET /musicians --------------------- //
@@ -27,91 +52,19 @@ func (handler *MusicianHandler) GetMusicians(response http.ResponseWriter, reque
 		return
 	}
 
-	// Получение ID музыкантов, которых должен видеть пользователь
-	musicianQuery := `
-	SELECT DISTINCT m.id, m.user_id, m.name, u.email, u.avatar_path, u.background_path, 
-	       u.description, u.has_complete_setup
-	FROM musician m
-	JOIN musician_genre mg ON m.id = mg.musician_id
-	JOIN user_genre ug ON mg.genre_id = ug.genre_id
-	JOIN user u ON m.user_id = u.id
-	WHERE ug.user_id = ?
-	`
-
-	rows, err := handler.DB.Query(musicianQuery, userID)
+	// Музыканты, которых должен видеть пользователь
+	musicians, err := handler.Musicians.ListRecommended(request.Context(), userID)
 	if err != nil {
+		log.Println("GetMusicians - Error getting musicians: ", err)
 		http.Error(response, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var musicians []models.Musician = make([]models.Musician, 0)
-
-	for rows.Next() {
-		var m models.Musician
-		err := rows.Scan(&m.ID, &m.UserID, &m.Name, &m.Email, &m.AvatarPath, &m.BackgroundPath, &m.Description, &m.HasCompleteSetup)
-		if err != nil {
+	for i := range musicians {
+		if err := handler.fillMusician(request.Context(), viewerFrom(request), &musicians[i]); err != nil {
+			log.Println("GetMusicians - Error getting musician details: ", err)
 			http.Error(response, err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		// Получаем жанры
-		genreRows, _ := handler.DB.Query(`
-			SELECT g.name
-			FROM genre g
-			JOIN musician_genre mg ON mg.genre_id = g.id
-			WHERE mg.musician_id = ?`, m.ID)
-		for genreRows.Next() {
-			var genre string
-			genreRows.Scan(&genre)
-			m.Genres = append(m.Genres, genre)
-		}
-		genreRows.Close()
-
-		// Получаем соцсети
-		socialRows, _ := handler.DB.Query(`
-			SELECT sn.name, usn.profile_url
-			FROM social_network sn
-			JOIN user_social_network usn ON usn.social_network_id = sn.id
-			WHERE usn.user_id = ?`, m.UserID)
-		for socialRows.Next() {
-			var sl models.SocialLink
-			socialRows.Scan(&sl.Name, &sl.URL)
-			m.SocialLinks = append(m.SocialLinks, sl)
-		}
-		socialRows.Close()
-
-		// Получаем альбомы
-		albumRows, _ := handler.DB.Query(`
-			SELECT a.id, a.title, a.release_date, a.cover_path, a.description
-			FROM album a
-			WHERE a.musician_id = ?`, m.ID)
-		for albumRows.Next() {
-			var album models.AlbumPreview
-			var releaseDate string
-			albumRows.Scan(&album.ID, &album.Title, &releaseDate, &album.CoverUrl, &album.Description)
-
-			// Год релиза
-			if t, err := time.Parse("2006-01-02", releaseDate); err == nil {
-				album.Year = t.Year()
-			}
-
-			// Получаем треки
-			trackRows, _ := handler.DB.Query(`
-				SELECT id FROM track WHERE album_id = ?`, album.ID)
-			for trackRows.Next() {
-				var trackID string
-				trackRows.Scan(&trackID)
-				album.Tracks = append(album.Tracks, trackID)
-			}
-			trackRows.Close()
-			baseURL := "http://37.46.130.29:8080"
-			album.CoverUrl = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(album.CoverUrl))
-			m.Albums = append(m.Albums, album)
-		}
-		albumRows.Close()
-
-		musicians = append(musicians, m)
 	}
 
 	response.Header().Set("Content-Type", "application/json")
@@ -141,49 +94,9 @@ func (handler *MusicianHandler) PostUserFollowing(response http.ResponseWriter,
 		return
 	}
 
-	tx, err := handler.DB.Begin()
-	if err != nil {
-		log.Println("Failed to begin transaction:", err)
-		http.Error(response, "Failed to begin transaction", http.StatusInternalServerError)
-		return
-	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare("INSERT INTO user_following (user_id, musician_id) VALUES (?, ?)")
-	if err != nil {
-		log.Println("Failed to prepare insert:", err)
-		http.Error(response, "Failed to prepare insert", http.StatusInternalServerError)
-		return
-	}
-	defer stmt.Close()
-
-	for _, musicianID := range payload.MusicianIDs {
-		log.Println("Following musicianID:", musicianID)
-		if _, err := stmt.Exec(userID, musicianID); err != nil {
-			log.Println("Failed to insert follow:", err)
-			http.Error(response, "Failed to insert follow", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	updateStmt, err := tx.Prepare("UPDATE user SET has_complete_setup = 1 WHERE id = ?")
-
-	if err != nil {
-		log.Println("Failed to prepare update:", err)
-		http.Error(response, "Failed to prepare update", http.StatusInternalServerError)
-		return
-	}
-	defer updateStmt.Close()
-
-	if _, err := updateStmt.Exec(userID); err != nil {
-		log.Println("Failed to update user setup:", err)
-		http.Error(response, "Failed to update user setup", http.StatusInternalServerError)
-		return
-	}
-
-	if err := tx.Commit(); err != nil {
-		log.Println("Failed to commit transaction:", err)
-		http.Error(response, "Failed to commit transaction", http.StatusInternalServerError)
+	if err := handler.Library.CompleteSetupFollowing(request.Context(), userID, payload.MusicianIDs); err != nil {
+		log.Println("Failed to save following:", err)
+		http.Error(response, "Failed to save following", http.StatusInternalServerError)
 		return
 	}
 
@@ -194,170 +107,42 @@ func (handler *MusicianHandler) PostUserFollowing(response http.ResponseWriter,
 func (handler *MusicianHandler) GetMusician(response http.ResponseWriter, request *http.Request) {
 	musicianID := mux.Vars(request)["id"]
 
-	var musician models.Musician
-
-	// Получаем данные из musician и user
-	err := handler.DB.QueryRow(`
-		SELECT m.id, m.user_id, m.name, u.email, u.avatar_path, u.background_path, u.description, u.has_complete_setup
-		FROM musician m
-		JOIN user u ON m.user_id = u.id
-		WHERE m.id = ?
-	`, musicianID).Scan(
-		&musician.ID, &musician.UserID, &musician.Name, &musician.Email,
-		&musician.AvatarPath, &musician.BackgroundPath, &musician.Description, &musician.HasCompleteSetup,
-	)
-	if err != nil {
-		log.Println("GetMusician - Musician not found: ", err)
+	musician, err := handler.Musicians.Get(request.Context(), musicianID)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(response, "Musician not found", http.StatusNotFound)
 		return
 	}
-
-	// Получаем жанры
-	var genres []string = make([]string, 0)
-	rows, err := handler.DB.Query(`
-		SELECT g.name
-		FROM genre g
-		JOIN musician_genre mg ON g.id = mg.genre_id
-		WHERE mg.musician_id = ?
-	`, musicianID)
 	if err != nil {
-		log.Println("GetMusician - Error getting genres: ", err)
-		http.Error(response, "Error getting genres", http.StatusInternalServerError)
+		log.Println("GetMusician - Error getting musician: ", err)
+		http.Error(response, "Error getting musician", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var genre string
-		rows.Scan(&genre)
-		genres = append(genres, genre)
-	}
-	musician.Genres = genres
-
-	// Получаем социальные сети пользователя
-	var socialLinks []models.SocialLink = make([]models.SocialLink, 0)
-	rows, err = handler.DB.Query(`
-		SELECT sn.name, usn.profile_url
-		FROM user_social_network usn
-		JOIN social_network sn ON usn.social_network_id = sn.id
-		WHERE usn.user_id = ?
-	`, musician.UserID)
-	if err != nil {
-		log.Println("GetMusician - Error getting social links: ", err)
-		http.Error(response, "Error getting social links", http.StatusInternalServerError)
+	if err := handler.fillMusician(request.Context(), viewerFrom(request), &musician); err != nil {
+		log.Println("GetMusician - Error getting musician details: ", err)
+		http.Error(response, "Error getting musician details", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var link models.SocialLink
-		rows.Scan(&link.Name, &link.URL)
-		socialLinks = append(socialLinks, link)
-	}
-	musician.SocialLinks = socialLinks
-
-	// Получаем количество прослушиваний
-	err = handler.DB.QueryRow(`
-		SELECT COALESCE(SUM(stream_count), 0)
-		FROM track
-		WHERE musician_id = ? AND track.visibility = 'public'
-	`, musicianID).Scan(&musician.Auditions)
-	if err != nil {
+	if musician.Auditions, err = handler.Musicians.Auditions(request.Context(), musicianID); err != nil {
 		log.Println("GetMusician - Error getting auditions: ", err)
 		http.Error(response, "Error getting auditions", http.StatusInternalServerError)
 		return
 	}
 
-	// Получаем альбомы
-	albumRows, err := handler.DB.Query(`
-		SELECT id, title, YEAR(release_date), cover_path, description
-		FROM album
-		WHERE musician_id = ?
-	`, musicianID)
-	if err != nil {
-		log.Println("GetMusician - Error getting albums: ", err)
-		http.Error(response, "Error getting albums", http.StatusInternalServerError)
-		return
-	}
-	defer albumRows.Close()
-
-	var albums []models.AlbumPreview = make([]models.AlbumPreview, 0)
-	for albumRows.Next() {
-		var album models.AlbumPreview
-		var albumID string
-		err := albumRows.Scan(&albumID, &album.Title, &album.Year, &album.CoverUrl, &album.Description)
-		if err != nil {
-			log.Println("GetMusician - Error scanning album: ", err)
-			http.Error(response, "Error scanning album", http.StatusInternalServerError)
-			return
-		}
-		album.ID = albumID
-
-		// Получаем ID треков альбома
-		trackIDs := []string{}
-		trackRows, err := handler.DB.Query(`
-			SELECT id FROM track WHERE album_id = ? AND track.visibility = 'public'
-		`, albumID)
-		if err != nil {
-			log.Println("GetMusician - Error getting tracks: ", err)
-			http.Error(response, "Error getting tracks", http.StatusInternalServerError)
-			return
-		}
-		for trackRows.Next() {
-			var trackID string
-			trackRows.Scan(&trackID)
-			trackIDs = append(trackIDs, trackID)
-		}
-		trackRows.Close()
-		baseURL := "http://37.46.130.29:8080"
-		album.CoverUrl = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(album.CoverUrl))
-		album.Tracks = trackIDs
-		albums = append(albums, album)
-	}
-	musician.Albums = albums
-
-	// Возвращаем JSON
 	response.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(response).Encode(musician)
 }
 
 // GET /musician/{id}/popular-tracks
 func (handler *MusicianHandler) GetPopularTracks(response http.ResponseWriter, request *http.Request) {
-	_ = request.Context().Value(middleware.ContextUserIDKey).(string)
-
 	musicianID := mux.Vars(request)["id"]
 
-	query := `
-	SELECT track.id, track.musician_id, track.title, track.duration, track.file_path, track.stream_count, m.name, a.cover_path, track.visibility
-	FROM track
-	JOIN musician m ON track.musician_id = m.id
-	JOIN album a ON track.album_id = a.id
-	WHERE track.musician_id = ? AND track.visibility = 'public'
-	ORDER BY stream_count DESC
-	LIMIT 10;
-	`
-	rows, err := handler.DB.Query(query, musicianID)
+	tracks, err := handler.Tracks.ListPopularByMusician(request.Context(), musicianID, popularTracksLimit)
 	if err != nil {
 		log.Println("GetPopularTracks - Error fetching popular tracks: ", err)
 		http.Error(response, "Error fetching popular tracks", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var tracks []models.TrackResponse = make([]models.TrackResponse, 0)
-	for rows.Next() {
-		var t models.TrackResponse
-		err := rows.Scan(&t.ID, &t.ArtistID, &t.Title, &t.Duration, &t.AudioURL,
-			&t.Plays, &t.ArtistName, &t.ImageURL, &t.Visibility)
-		if err != nil {
-			log.Println("GetPopularTracks - Error scanning track: ", err)
-			http.Error(response, "Error scanning track", http.StatusInternalServerError)
-			return
-		}
-		baseURL := "http://37.46.130.29:8080"
-		t.AudioURL = fmt.Sprintf("%s/media/audio/%s", baseURL, t.ID)
-		t.ImageURL = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(t.ImageURL))
-		tracks = append(tracks, t)
-	}
 
 	response.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(response).Encode(tracks)
+	json.NewEncoder(response).Encode(presentTracks(handler.Media, viewerFrom(request), tracks))
 }
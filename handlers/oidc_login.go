@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Edafi/MusicVibe/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	oidcFlowCookie  = "oidc_flow"
+	oidcFlowPurpose = "oidc_flow"
+	oidcFlowTTL     = 10 * time.Minute
+)
+
+var (
+	errOIDCEmailMissing     = errors.New("provider did not return an email")
+	errOIDCEmailNotVerified = errors.New("email is registered but not verified by provider")
+)
+
+// Состояние входа хранится в подписанной cookie, а не на сервере
+type oidcFlowClaims struct {
+	Purpose    string `json:"purpose"`
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	DeviceName string `json:"device_name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GET /auth/oidc/providers
+func (handler *AuthHandler) GetOIDCProviders(response http.ResponseWriter, request *http.Request) {
+	names := handler.OIDC.Names()
+	sort.Strings(names)
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(names)
+}
+
+// GET /auth/oidc/{provider}/login - редирект на страницу входа провайдера
+func (handler *AuthHandler) OIDCLogin(response http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)["provider"]
+	provider, found, err := handler.OIDC.Provider(request.Context(), name)
+	if !found {
+		http.Error(response, "Unknown provider", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("OIDCLogin - discovery error:", err)
+		http.Error(response, "Provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	var state, nonce, verifier string
+	if state, err = oidc.RandomString(); err == nil {
+		if nonce, err = oidc.RandomString(); err == nil {
+			verifier, err = oidc.RandomString()
+		}
+	}
+	if err != nil {
+		log.Println("OIDCLogin - random error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
+		return
+	}
+
+	flow, err := handler.Keys.Sign(&oidcFlowClaims{
+		Purpose:    oidcFlowPurpose,
+		Provider:   name,
+		State:      state,
+		Nonce:      nonce,
+		Verifier:   verifier,
+		DeviceName: deviceName(request, request.URL.Query().Get("deviceName")),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcFlowTTL)),
+		},
+	})
+	if err != nil {
+		log.Println("OIDCLogin - sign error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(response, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    flow,
+		Path:     "/auth/oidc/",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(handler.AppURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(response, request, provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// Результат входа уходит на фронтенд во фрагменте URL, чтобы токены не попадали в логи серверов
+func (handler *AuthHandler) oidcRedirect(response http.ResponseWriter, request *http.Request, values url.Values) {
+	http.SetCookie(response, &http.Cookie{Name: oidcFlowCookie, Path: "/auth/oidc/", MaxAge: -1})
+	http.Redirect(response, request, handler.AppURL+"/auth/callback#"+values.Encode(), http.StatusFound)
+}
+
+func (handler *AuthHandler) oidcError(response http.ResponseWriter, request *http.Request, code string) {
+	handler.oidcRedirect(response, request, url.Values{"error": {code}})
+}
+
+// GET /auth/oidc/{provider}/callback
+func (handler *AuthHandler) OIDCCallback(response http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)["provider"]
+	query := request.URL.Query()
+
+	if providerError := query.Get("error"); providerError != "" {
+		log.Println("OIDCCallback - provider error:", providerError)
+		handler.oidcError(response, request, "access_denied")
+		return
+	}
+
+	cookie, err := request.Cookie(oidcFlowCookie)
+	if err != nil {
+		handler.oidcError(response, request, "invalid_state")
+		return
+	}
+	flow := &oidcFlowClaims{}
+	token, err := handler.Keys.Parse(cookie.Value, flow)
+	if err != nil || !token.Valid || flow.Purpose != oidcFlowPurpose || flow.Provider != name ||
+		subtle.ConstantTimeCompare([]byte(flow.State), []byte(query.Get("state"))) != 1 {
+		log.Println("OIDCCallback - state mismatch")
+		handler.oidcError(response, request, "invalid_state")
+		return
+	}
+
+	provider, found, err := handler.OIDC.Provider(request.Context(), name)
+	if !found || err != nil {
+		log.Println("OIDCCallback - provider error:", err)
+		handler.oidcError(response, request, "provider_unavailable")
+		return
+	}
+
+	claims, err := provider.Exchange(request.Context(), query.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Println("OIDCCallback - exchange error:", err)
+		handler.oidcError(response, request, "invalid_grant")
+		return
+	}
+
+	userID, err := handler.findOrCreateOIDCUser(name, claims)
+	if errors.Is(err, errOIDCEmailNotVerified) {
+		handler.oidcError(response, request, "email_not_verified")
+		return
+	} else if errors.Is(err, errOIDCEmailMissing) {
+		handler.oidcError(response, request, "email_required")
+		return
+	} else if err != nil {
+		log.Println("OIDCCallback - user error:", err)
+		handler.oidcError(response, request, "server_error")
+		return
+	}
+
+	// 2FA действует и для входа через провайдера
+	twoFactor, err := handler.twoFactorEnabled(userID)
+	if err != nil {
+		log.Println("OIDCCallback - 2FA status error:", err)
+		handler.oidcError(response, request, "server_error")
+		return
+	}
+	if twoFactor {
+		challenge, err := handler.issueMFAChallenge(userID, flow.DeviceName)
+		if err != nil {
+			log.Println("OIDCCallback - challenge error:", err)
+			handler.oidcError(response, request, "server_error")
+			return
+		}
+		handler.oidcRedirect(response, request, url.Values{"mfaRequired": {"true"}, "challengeToken": {challenge}})
+		return
+	}
+
+	var role string
+	if err := handler.DB.QueryRow(`SELECT role FROM user WHERE id = ?`, userID).Scan(&role); err != nil {
+		log.Println("OIDCCallback - role error:", err)
+		handler.oidcError(response, request, "server_error")
+		return
+	}
+	tokens, err := handler.createSession(request, userID, role, flow.DeviceName)
+	if err != nil {
+		log.Println("OIDCCallback - session error:", err)
+		handler.oidcError(response, request, "server_error")
+		return
+	}
+
+	handler.oidcRedirect(response, request, url.Values{
+		"token":        {tokens.AccessToken},
+		"refreshToken": {tokens.RefreshToken},
+	})
+}
+
+// Ищет пользователя по привязке провайдера; при её отсутствии привязывает к аккаунту
+// с тем же email (подтверждённым провайдером) или создаёт нового слушателя
+func (handler *AuthHandler) findOrCreateOIDCUser(provider string, claims *oidc.IDTokenClaims) (string, error) {
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(`SELECT user_id FROM user_identity WHERE provider = ? AND subject = ?`, provider, claims.Subject).Scan(&userID)
+	if err == nil {
+		return userID, tx.Commit()
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	email := normalizeEmail(claims.Email)
+	if email == "" {
+		return "", errOIDCEmailMissing
+	}
+
+	var emailVerified bool
+	err = tx.QueryRow(`SELECT id, email_verified FROM user WHERE email = ? FOR UPDATE`, email).Scan(&userID, &emailVerified)
+	switch {
+	case err == nil:
+		// Без подтверждения почты провайдером привязка позволила бы захватить чужой аккаунт
+		if !claims.EmailVerified {
+			return "", errOIDCEmailNotVerified
+		}
+		if !emailVerified {
+			// Аккаунт с неподтверждённой почтой мог зарегистрировать кто угодно заранее:
+			// владелец почты забирает его, а прежние учётные данные перестают работать
+			if err := reclaimUnverifiedAccount(tx, userID); err != nil {
+				return "", err
+			}
+		}
+
+	case err == sql.ErrNoRows:
+		userID, err = createOIDCUser(tx, email, claims)
+		if err != nil {
+			return "", err
+		}
+
+	default:
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_identity (provider, subject, user_id, email, created_at)
+		VALUES (?, ?, ?, ?, ?)`, provider, claims.Subject, userID, email, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
+}
+
+// Хэш случайного пароля, который неизвестен никому; задать свой можно через сброс пароля
+func unusablePasswordHash() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return bcrypt.GenerateFromPassword([]byte(base64.RawURLEncoding.EncodeToString(secret)), bcrypt.DefaultCost)
+}
+
+// reclaimUnverifiedAccount подтверждает почту и отзывает всё, чем мог пользоваться тот,
+// кто зарегистрировал аккаунт до владельца почты: пароль, сессии, токены доступа, 2FA
+func reclaimUnverifiedAccount(tx *sql.Tx, userID string) error {
+	hashedPassword, err := unusablePasswordHash()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, statement := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE user SET email_verified = 1, passwd_hash = ? WHERE id = ?`, []interface{}{hashedPassword, userID}},
+		{`UPDATE user_session SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, []interface{}{now, userID}},
+		{`UPDATE api_token SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, []interface{}{now, userID}},
+		{`UPDATE user_token SET used_at = ? WHERE user_id = ? AND used_at IS NULL`, []interface{}{now, userID}},
+		{`DELETE FROM user_totp WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM user_recovery_code WHERE user_id = ?`, []interface{}{userID}},
+	} {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createOIDCUser(tx *sql.Tx, email string, claims *oidc.IDTokenClaims) (string, error) {
+	username, err := uniqueUsername(tx, usernameCandidate(claims.Name, email))
+	if err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := unusablePasswordHash()
+	if err != nil {
+		return "", err
+	}
+
+	id := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO user (id, username, email, passwd_hash, role, has_complete_setup, email_verified, avatar_path, background_path, description)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, username, email, hashedPassword, "user", false, claims.EmailVerified, defaultArtistAvatarPath, "", " ")
+	return id, err
+}
+
+func usernameCandidate(name, email string) string {
+	clean := func(value string) string {
+		var builder strings.Builder
+		for _, r := range strings.TrimSpace(value) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' {
+				builder.WriteRune(r)
+			} else if r == ' ' {
+				builder.WriteRune('_')
+			}
+		}
+		runes := []rune(builder.String())
+		if len(runes) > maxUsernameLength-5 {
+			runes = runes[:maxUsernameLength-5]
+		}
+		return string(runes)
+	}
+
+	candidate := clean(name)
+	if validateUsername(candidate) != "" {
+		candidate = clean(strings.SplitN(email, "@", 2)[0])
+	}
+	if validateUsername(candidate) != "" {
+		candidate = "listener"
+	}
+	return candidate
+}
+
+func uniqueUsername(tx *sql.Tx, candidate string) (string, error) {
+	username := candidate
+	for attempt := 0; attempt < 5; attempt++ {
+		var taken bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM user WHERE LOWER(username) = ?)`, strings.ToLower(username)).Scan(&taken); err != nil {
+			return "", err
+		}
+		if !taken {
+			return username, nil
+		}
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		username = fmt.Sprintf("%s_%04d", candidate, suffix.Int64())
+	}
+	return "", errors.New("could not pick a unique username")
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Edafi/MusicVibe/jwtkeys"
+	"github.com/Edafi/MusicVibe/oidc"
+	"github.com/Edafi/MusicVibe/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	oidcTestProvider = "mock"
+	oidcTestAppURL   = "http://app.test"
+)
+
+type oidcTest struct {
+	t        *testing.T
+	handler  *AuthHandler
+	db       sqlmock.Sqlmock
+	provider *oidctest.Provider
+	router   *mux.Router
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	provider, err := oidctest.NewProvider("musicvibe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+
+	registry, err := oidc.NewRegistry([]oidc.ProviderConfig{
+		provider.Config(oidcTestProvider, "http://api.test/auth/oidc/"+oidcTestProvider+"/callback"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := jwtkeys.NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	handler := &AuthHandler{DB: db, Keys: keys, OIDC: registry, AppURL: oidcTestAppURL}
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/oidc/{provider}/login", handler.OIDCLogin)
+	router.HandleFunc("/auth/oidc/{provider}/callback", handler.OIDCCallback)
+	return &oidcTest{t: t, handler: handler, db: mock, provider: provider, router: router}
+}
+
+// login проходит OIDCLogin и страницу провайдера; возвращает cookie потока
+// и query, с которым провайдер вернул пользователя на callback
+func (test *oidcTest) login() (*http.Cookie, url.Values) {
+	test.t.Helper()
+	recorder := httptest.NewRecorder()
+	test.router.ServeHTTP(recorder, httptest.NewRequest("GET", "/auth/oidc/"+oidcTestProvider+"/login", nil))
+	if recorder.Code != http.StatusFound {
+		test.t.Fatalf("login status = %d, body %q", recorder.Code, recorder.Body.String())
+	}
+	var flow *http.Cookie
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == oidcFlowCookie {
+			flow = cookie
+		}
+	}
+	if flow == nil {
+		test.t.Fatal("login did not set the flow cookie")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(recorder.Header().Get("Location"))
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		test.t.Fatalf("authorize status = %d", response.StatusCode)
+	}
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	return flow, location.Query()
+}
+
+// callback возвращает параметры из фрагмента редиректа на фронтенд
+func (test *oidcTest) callback(flow *http.Cookie, query url.Values) url.Values {
+	test.t.Helper()
+	request := httptest.NewRequest("GET", "/auth/oidc/"+oidcTestProvider+"/callback?"+query.Encode(), nil)
+	if flow != nil {
+		request.AddCookie(flow)
+	}
+	recorder := httptest.NewRecorder()
+	test.router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusFound {
+		test.t.Fatalf("callback status = %d, body %q", recorder.Code, recorder.Body.String())
+	}
+	location := recorder.Header().Get("Location")
+	fragment, found := strings.CutPrefix(location, oidcTestAppURL+"/auth/callback#")
+	if !found {
+		test.t.Fatalf("callback redirected to %q", location)
+	}
+	values, err := url.ParseQuery(fragment)
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	return values
+}
+
+// resign подписывает cookie потока с изменёнными claims, как мог бы сделать сервер
+func (test *oidcTest) resign(flow *http.Cookie, change func(claims *oidcFlowClaims)) *http.Cookie {
+	test.t.Helper()
+	claims := &oidcFlowClaims{}
+	if _, err := test.handler.Keys.Parse(flow.Value, claims); err != nil {
+		test.t.Fatal(err)
+	}
+	change(claims)
+	value, err := test.handler.Keys.Sign(claims)
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	return &http.Cookie{Name: oidcFlowCookie, Value: value}
+}
+
+func (test *oidcTest) expectSession(userID driver.Value) {
+	test.db.ExpectQuery(regexp.QuoteMeta(`FROM user_totp WHERE user_id = ?`)).
+		WithArgs(userID).WillReturnError(sql.ErrNoRows)
+	test.db.ExpectQuery(regexp.QuoteMeta(`SELECT role FROM user WHERE id = ?`)).
+		WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("user"))
+	test.db.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_session`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func (test *oidcTest) expectNoIdentity() {
+	test.db.ExpectBegin()
+	test.db.ExpectQuery(regexp.QuoteMeta(`SELECT user_id FROM user_identity`)).
+		WithArgs(oidcTestProvider, test.provider.Subject).WillReturnError(sql.ErrNoRows)
+}
+
+func (test *oidcTest) assertSignedIn(values url.Values) {
+	test.t.Helper()
+	if values.Get("error") != "" || values.Get("token") == "" || values.Get("refreshToken") == "" {
+		test.t.Fatalf("expected tokens, got %v", values)
+	}
+	if err := test.db.ExpectationsWereMet(); err != nil {
+		test.t.Fatal(err)
+	}
+}
+
+func (test *oidcTest) assertError(values url.Values, code string) {
+	test.t.Helper()
+	if values.Get("error") != code || values.Get("token") != "" {
+		test.t.Fatalf("expected error %q, got %v", code, values)
+	}
+	if err := test.db.ExpectationsWereMet(); err != nil {
+		test.t.Fatal(err)
+	}
+}
+
+func TestOIDCCallbackCreatesUser(t *testing.T) {
+	test := newOIDCTest(t)
+	flow, query := test.login()
+
+	test.expectNoIdentity()
+	test.db.ExpectQuery(regexp.QuoteMeta(`SELECT id, email_verified FROM user WHERE email = ?`)).
+		WithArgs(test.provider.Email).WillReturnError(sql.ErrNoRows)
+	test.db.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM user WHERE LOWER(username) = ?)`)).
+		WithArgs("test_user").WillReturnRows(sqlmock.NewRows([]string{"taken"}).AddRow(false))
+	test.db.ExpectExec(regexp.QuoteMeta(`INSERT INTO user (`)).
+		WithArgs(sqlmock.AnyArg(), "Test_User", test.provider.Email, sqlmock.AnyArg(), "user", false, true,
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	test.db.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_identity`)).
+		WithArgs(oidcTestProvider, test.provider.Subject, sqlmock.AnyArg(), test.provider.Email, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	test.db.ExpectCommit()
+	test.expectSession(sqlmock.AnyArg())
+
+	test.assertSignedIn(test.callback(flow, query))
+}
+
+func TestOIDCCallbackKnownIdentity(t *testing.T) {
+	test := newOIDCTest(t)
+	flow, query := test.login()
+
+	test.db.ExpectBegin()
+	test.db.ExpectQuery(regexp.QuoteMeta(`SELECT user_id FROM user_identity`)).
+		WithArgs(oidcTestProvider, test.provider.Subject).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("user-42"))
+	test.db.ExpectCommit()
+	test.expectSession("user-42")
+
+	test.assertSignedIn(test.callback(flow, query))
+}
+
+func TestOIDCCallbackLinksVerifiedAccount(t *testing.T) {
+	test := newOIDCTest(t)
+	flow, query := test.login()
+
+	test.expectNoIdentity()
+	test.db.ExpectQuery(regexp.QuoteMeta(`SELECT id, email_verified FROM user WHERE email = ?`)).
+		WithArgs(test.provider.Email).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email_verified"}).AddRow("user-42", true))
+	test.db.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_identity`)).
+		WithArgs(oidcTestProvider, test.provider.Subject, "user-42", test.provider.Email, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	test.db.ExpectCommit()
+	test.expectSession("user-42")
+
+	test.assertSignedIn(test.callback(flow, query))
+}
+
+// Аккаунт, зарегистрированный на чужую почту до владельца, теряет пароль, сессии, токены и 2FA
+func TestOIDCCallbackReclaimsUnverifiedAccount(t *testing.T) {
+	test := newOIDCTest(t)
+	flow, query := test.login()
+
+	test.expectNoIdentity()
+	test.db.ExpectQuery(regexp.QuoteMeta(`SELECT id, email_verified FROM user WHERE email = ?`)).
+		WithArgs(test.provider.Email).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email_verified"}).AddRow("user-42", false))
+	for _, query := range []string{
+		`UPDATE user SET email_verified = 1, passwd_hash = ?`,
+		`UPDATE user_session SET revoked_at = ?`,
+		`UPDATE api_token SET revoked_at = ?`,
+		`UPDATE user_token SET used_at = ?`,
+		`DELETE FROM user_totp`,
+		`DELETE FROM user_recovery_code`,
+	} {
+		test.db.ExpectExec(regexp.QuoteMeta(query)).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	test.db.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_identity`)).
+		WithArgs(oidcTestProvider, test.provider.Subject, "user-42", test.provider.Email, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	test.db.ExpectCommit()
+	test.expectSession("user-42")
+
+	test.assertSignedIn(test.callback(flow, query))
+}
+
+func TestOIDCCallbackRefusesUnverifiedProviderEmail(t *testing.T) {
+	test := newOIDCTest(t)
+	test.provider.EmailVerified = false
+	flow, query := test.login()
+
+	test.expectNoIdentity()
+	test.db.ExpectQuery(regexp.QuoteMeta(`SELECT id, email_verified FROM user WHERE email = ?`)).
+		WithArgs(test.provider.Email).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email_verified"}).AddRow("user-42", true))
+	test.db.ExpectRollback()
+
+	test.assertError(test.callback(flow, query), "email_not_verified")
+}
+
+func TestOIDCCallbackRejectsBadFlow(t *testing.T) {
+	cases := []struct {
+		name string
+		// Портит cookie или query после настоящего входа
+		tamper func(test *oidcTest, flow *http.Cookie, query url.Values) *http.Cookie
+		error  string
+	}{
+		{"missing cookie", func(test *oidcTest, flow *http.Cookie, query url.Values) *http.Cookie {
+			return nil
+		}, "invalid_state"},
+		{"state mismatch", func(test *oidcTest, flow *http.Cookie, query url.Values) *http.Cookie {
+			query.Set("state", "forged")
+			return flow
+		}, "invalid_state"},
+		{"tampered cookie", func(test *oidcTest, flow *http.Cookie, query url.Values) *http.Cookie {
+			header, rest, _ := strings.Cut(flow.Value, ".")
+			payload, signature, _ := strings.Cut(rest, ".")
+			return &http.Cookie{Name: oidcFlowCookie, Value: header + "." + payload + "x." + signature}
+		}, "invalid_state"},
+		{"expired cookie", func(test *oidcTest, flow *http.Cookie, query url.Values) *http.Cookie {
+			return test.resign(flow, func(claims *oidcFlowClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			})
+		}, "invalid_state"},
+		{"other provider", func(test *oidcTest, flow *http.Cookie, query url.Values) *http.Cookie {
+			return test.resign(flow, func(claims *oidcFlowClaims) { claims.Provider = "other" })
+		}, "invalid_state"},
+		{"nonce mismatch", func(test *oidcTest, flow *http.Cookie, query url.Values) *http.Cookie {
+			return test.resign(flow, func(claims *oidcFlowClaims) { claims.Nonce = "forged" })
+		}, "invalid_grant"},
+		{"PKCE verifier mismatch", func(test *oidcTest, flow *http.Cookie, query url.Values) *http.Cookie {
+			return test.resign(flow, func(claims *oidcFlowClaims) { claims.Verifier = "forged" })
+		}, "invalid_grant"},
+		{"provider error", func(test *oidcTest, flow *http.Cookie, query url.Values) *http.Cookie {
+			query.Set("error", "access_denied")
+			return flow
+		}, "access_denied"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			test := newOIDCTest(t)
+			flow, query := test.login()
+			flow = tc.tamper(test, flow, query)
+			// Ни одного обращения к БД: поток отклоняется до поиска пользователя
+			test.assertError(test.callback(flow, query), tc.error)
+		})
+	}
+}
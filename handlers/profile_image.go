@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"image"
+	"log"
+	"net/http"
+
+	"github.com/Edafi/MusicVibe/imageproc"
+	"github.com/Edafi/MusicVibe/mediaurl"
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/storage"
+	"github.com/gorilla/mux"
+)
+
+// Загрузка аватаров и фонов пользователя и профилей музыканта
+type ProfileImageHandler struct {
+	DB            *sql.DB
+	Store         storage.BlobStore
+	Bucket        string
+	MaxImageBytes int64
+	Media         *mediaurl.Builder
+}
+
+// Запас сверх размера изображения на остальные поля формы и заголовки частей
+const formOverheadBytes = 1 << 20
+
+// Разбирает multipart-форму, ограничив тело запроса limit байтами. Сам maxMemory
+// ParseMultipartForm тело не ограничивает: всё сверх него уходит во временные файлы
+func parseMultipartForm(response http.ResponseWriter, request *http.Request, limit int64) error {
+	request.Body = http.MaxBytesReader(response, request.Body, limit)
+	return request.ParseMultipartForm(limit)
+}
+
+// Отвечает 413, если тело больше лимита, иначе 400
+func writeFormError(response http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(response, "Request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(response, "Cannot parse multipart form", http.StatusBadRequest)
+}
+
+// Читает файл из поля уже разобранной формы и проверяет, что это изображение
+func readImageUpload(request *http.Request, field string, maxBytes int64) (image.Image, string) {
+	file, _, err := request.FormFile(field)
+	if err != nil {
+		return nil, "Image file is required"
+	}
+	defer file.Close()
+
+	img, err := imageproc.Decode(file, maxBytes)
+	switch {
+	case errors.Is(err, imageproc.ErrTooLarge):
+		return nil, "Image is too large"
+	case err != nil:
+		return nil, "Image must be a JPEG or PNG file"
+	}
+	return img, ""
+}
+
+// StoreImageVariants сохраняет все размеры изображения в хранилище и возвращает путь
+// основного объекта. Им же пользуется команда seed
+func StoreImageVariants(ctx context.Context, store storage.BlobStore, bucket, dir, kind, id string, img image.Image, variants []imageproc.Variant) (string, error) {
+	rendered, err := imageproc.Render(img, variants)
+	if err != nil {
+		return "", err
+	}
+
+	put := func(key string, data []byte, contentType string) error {
+		return store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType)
+	}
+
+	for _, variant := range variants {
+		if err := put(storage.ImageKey(dir, kind, id, variant.Name), rendered[variant.Name], "image/jpeg"); err != nil {
+			return "", err
+		}
+	}
+	// Основной объект - копия самого крупного варианта, чтобы работали старые ссылки
+	mainName := storage.ImageKey(dir, kind, id, "")
+	if err := put(mainName, rendered[variants[0].Name], "image/jpeg"); err != nil {
+		return "", err
+	}
+
+	// WebP необязателен: без ffmpeg клиенты получат JPEG. Но если новых WebP нет,
+	// прежние удаляются - иначе при замене клиентам отдавалось бы старое изображение
+	webpKeys := []string{storage.WebPKey(mainName)}
+	for _, variant := range variants {
+		webpKeys = append(webpKeys, storage.WebPKey(storage.ImageKey(dir, kind, id, variant.Name)))
+	}
+	webpStored := imageproc.WebPAvailable()
+	if webpStored {
+		for _, variant := range variants {
+			webp, err := imageproc.EncodeWebP(ctx, rendered[variant.Name])
+			if err == nil {
+				err = put(storage.WebPKey(storage.ImageKey(dir, kind, id, variant.Name)), webp, "image/webp")
+			}
+			if err == nil && variant.Name == variants[0].Name {
+				err = put(storage.WebPKey(mainName), webp, "image/webp")
+			}
+			if err != nil {
+				log.Println("WebP variant error:", err)
+				webpStored = false
+				break
+			}
+		}
+	}
+	if !webpStored {
+		for _, key := range webpKeys {
+			if err := store.Delete(ctx, key); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return storage.StoredPath(bucket, mainName), nil
+}
+
+func (handler *ProfileImageHandler) upload(response http.ResponseWriter, request *http.Request, dir, kind, id string, variants []imageproc.Variant, update string) {
+	if err := parseMultipartForm(response, request, handler.MaxImageBytes+formOverheadBytes); err != nil {
+		log.Println("Image upload - parse form error:", err)
+		writeFormError(response, err)
+		return
+	}
+
+	img, problem := readImageUpload(request, "image", handler.MaxImageBytes)
+	if problem != "" {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"image": problem})
+		return
+	}
+
+	path, err := StoreImageVariants(request.Context(), handler.Store, handler.Bucket, dir, kind, id, img, variants)
+	if err != nil {
+		log.Println("Image upload error:", err)
+		http.Error(response, "Failed to upload image", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := handler.DB.Exec(update, path, id); err != nil {
+		log.Println("Image path update error:", err)
+		http.Error(response, "Failed to save image", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(map[string]interface{}{
+		"url": handler.Media.Image(path),
+	})
+}
+
+// PUT /user/avatar
+func (handler *ProfileImageHandler) UploadUserAvatar(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	handler.upload(response, request, storage.UserDir(userID), storage.KindAvatar, userID, imageproc.AvatarVariants,
+		`UPDATE user SET avatar_path = ? WHERE id = ?`)
+}
+
+// PUT /user/background
+func (handler *ProfileImageHandler) UploadUserBackground(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	handler.upload(response, request, storage.UserDir(userID), storage.KindBackground, userID, imageproc.BackgroundVariants,
+		`UPDATE user SET background_path = ? WHERE id = ?`)
+}
+
+// PUT /artists/{id}/avatar
+func (handler *ProfileImageHandler) UploadArtistAvatar(response http.ResponseWriter, request *http.Request) {
+	musicianID, ok := handler.ownedArtist(response, request)
+	if !ok {
+		return
+	}
+	handler.upload(response, request, storage.MusicianDir(musicianID), storage.KindAvatar, musicianID, imageproc.AvatarVariants,
+		`UPDATE musician SET avatar_path = ? WHERE id = ?`)
+}
+
+// PUT /artists/{id}/background
+func (handler *ProfileImageHandler) UploadArtistBackground(response http.ResponseWriter, request *http.Request) {
+	musicianID, ok := handler.ownedArtist(response, request)
+	if !ok {
+		return
+	}
+	handler.upload(response, request, storage.MusicianDir(musicianID), storage.KindBackground, musicianID, imageproc.BackgroundVariants,
+		`UPDATE musician SET background_path = ? WHERE id = ?`)
+}
+
+func (handler *ProfileImageHandler) ownedArtist(response http.ResponseWriter, request *http.Request) (string, bool) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	musicianID, err := ownedMusicianID(handler.DB, userID, mux.Vars(request)["id"])
+	if errors.Is(err, errNoArtistProfile) {
+		http.Error(response, "Artist not found", http.StatusNotFound)
+		return "", false
+	} else if err != nil {
+		log.Println("Image upload - owner check error:", err)
+		http.Error(response, "Failed to upload image", http.StatusInternalServerError)
+		return "", false
+	}
+	return musicianID, true
+}
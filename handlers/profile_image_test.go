@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Edafi/MusicVibe/imageproc"
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/storage"
+)
+
+func multipartRequest(t *testing.T, field string, size int) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(field, "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte{0}, size))
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPut, "/user/avatar", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return request.WithContext(context.WithValue(request.Context(), middleware.ContextUserIDKey, "user-1"))
+}
+
+func TestUploadRejectsOversizedBody(t *testing.T) {
+	handler := &ProfileImageHandler{MaxImageBytes: 1 << 10}
+	recorder := httptest.NewRecorder()
+	handler.UploadUserAvatar(recorder, multipartRequest(t, "image", 2*formOverheadBytes))
+
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", recorder.Code)
+	}
+}
+
+func TestUploadWithinLimitReachesValidation(t *testing.T) {
+	handler := &ProfileImageHandler{MaxImageBytes: 1 << 10}
+	recorder := httptest.NewRecorder()
+	handler.UploadUserAvatar(recorder, multipartRequest(t, "image", 512))
+
+	// Нули - не изображение, но тело в пределах лимита и доходит до проверки формата
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", recorder.Code)
+	}
+}
+
+// Без новых WebP при замене обложки старые не должны отдаваться вместо новой JPEG
+func TestStoreImageVariantsReplacesStaleWebP(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	dir := storage.MusicianDir("musician-1")
+
+	var stale []string
+	for _, name := range []string{"", imageproc.CoverVariants[0].Name} {
+		key := storage.WebPKey(storage.ImageKey(dir, storage.KindCover, "album-1", name))
+		if err := store.Put(ctx, key, strings.NewReader("old"), 3, "image/webp"); err != nil {
+			t.Fatal(err)
+		}
+		stale = append(stale, key)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, imageproc.MinCoverSide, imageproc.MinCoverSide))
+	if _, err := StoreImageVariants(ctx, store, "music", dir, storage.KindCover, "album-1", img, imageproc.CoverVariants); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range stale {
+		info, err := store.Stat(ctx, key)
+		if err == nil && info.Size == 3 {
+			t.Errorf("stale WebP %s survived the replacement", key)
+		} else if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"deviceName"`
+	IPAddress  string    `json:"ipAddress"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	Current    bool      `json:"current"`
+}
+
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// Refresh-токен имеет вид "<session_id>.<случайная строка>", в БД хранится только sha256
+func newRefreshToken(sessionID string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return sessionID + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+func deviceName(request *http.Request, requested string) string {
+	name := strings.TrimSpace(requested)
+	if name == "" {
+		name = request.UserAgent()
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
+
+func (handler *AuthHandler) signAccessToken(userID, role, sessionID string) (string, error) {
+	claims := &Claims{
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
+		},
+	}
+	return handler.Keys.Sign(claims)
+}
+
+// Создаёт серверную сессию и выдаёт пару access/refresh токенов
+func (handler *AuthHandler) createSession(request *http.Request, userID, role, device string) (tokenPair, error) {
+	sessionID := uuid.New().String()
+	refreshToken, err := newRefreshToken(sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	now := time.Now()
+	_, err = handler.DB.Exec(`
+		INSERT INTO user_session (id, user_id, refresh_token_hash, device_name, ip_address, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		sessionID, userID, hashToken(refreshToken), deviceName(request, device), clientIP(request),
+		now, now, now.Add(refreshTokenTTL))
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	accessToken, err := handler.signAccessToken(userID, role, sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// Ротация refresh-токена. Повторное использование старого токена отзывает всю сессию
+func (handler *AuthHandler) rotateSession(request *http.Request, refreshToken string) (tokenPair, error) {
+	sessionID, _, found := strings.Cut(refreshToken, ".")
+	if !found || sessionID == "" {
+		return tokenPair{}, errInvalidRefreshToken
+	}
+
+	var (
+		userID, role, storedHash string
+		expiresAt                time.Time
+		revokedAt                sql.NullTime
+	)
+	err := handler.DB.QueryRow(`
+		SELECT s.user_id, u.role, s.refresh_token_hash, s.expires_at, s.revoked_at
+		FROM user_session s
+		JOIN user u ON u.id = s.user_id
+		WHERE s.id = ?`, sessionID).Scan(&userID, &role, &storedHash, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return tokenPair{}, errInvalidRefreshToken
+	} else if err != nil {
+		return tokenPair{}, err
+	}
+
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return tokenPair{}, errInvalidRefreshToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(storedHash), []byte(hashToken(refreshToken))) != 1 {
+		log.Println("rotateSession - refresh token reuse detected, revoking session", sessionID)
+		if _, err := handler.DB.Exec(`UPDATE user_session SET revoked_at = ? WHERE id = ?`, time.Now(), sessionID); err != nil {
+			log.Println("rotateSession - revoke error:", err)
+		}
+		return tokenPair{}, errInvalidRefreshToken
+	}
+
+	newToken, err := newRefreshToken(sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	// Условие по старому хэшу защищает от гонки двух одновременных refresh
+	result, err := handler.DB.Exec(`
+		UPDATE user_session SET refresh_token_hash = ?, last_used_at = ?, ip_address = ?
+		WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL`,
+		hashToken(newToken), time.Now(), clientIP(request), sessionID, storedHash)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return tokenPair{}, errInvalidRefreshToken
+	}
+
+	accessToken, err := handler.signAccessToken(userID, role, sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{AccessToken: accessToken, RefreshToken: newToken}, nil
+}
+
+func sessionFromContext(request *http.Request) (userID, sessionID string, ok bool) {
+	userID, ok = request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		return "", "", false
+	}
+	sessionID, _ = request.Context().Value(middleware.ContextSessionIDKey).(string)
+	return userID, sessionID, true
+}
+
+// POST /auth/refresh
+func (handler *AuthHandler) Refresh(response http.ResponseWriter, request *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := handler.rotateSession(request, req.RefreshToken)
+	if errors.Is(err, errInvalidRefreshToken) {
+		http.Error(response, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Println("Refresh - session error:", err)
+		http.Error(response, "Failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(map[string]interface{}{
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+	})
+}
+
+// POST /auth/logout - отзывает текущую сессию
+func (handler *AuthHandler) Logout(response http.ResponseWriter, request *http.Request) {
+	userID, sessionID, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	_, err := handler.DB.Exec(`UPDATE user_session SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		time.Now(), sessionID, userID)
+	if err != nil {
+		log.Println("Logout - revoke error:", err)
+		http.Error(response, "Failed to logout", http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// GET /auth/sessions
+func (handler *AuthHandler) GetSessions(response http.ResponseWriter, request *http.Request) {
+	userID, sessionID, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := handler.DB.Query(`
+		SELECT id, device_name, ip_address, created_at, last_used_at
+		FROM user_session
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_used_at DESC`, userID, time.Now())
+	if err != nil {
+		log.Println("GetSessions - DB Query error:", err)
+		http.Error(response, "Failed to load sessions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var sessions []SessionResponse = make([]SessionResponse, 0)
+	for rows.Next() {
+		var s SessionResponse
+		if err := rows.Scan(&s.ID, &s.DeviceName, &s.IPAddress, &s.CreatedAt, &s.LastUsedAt); err != nil {
+			log.Println("GetSessions - Row Scan error:", err)
+			http.Error(response, "Failed to load sessions", http.StatusInternalServerError)
+			return
+		}
+		s.Current = s.ID == sessionID
+		sessions = append(sessions, s)
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(sessions)
+}
+
+// DELETE /auth/sessions/{id}
+func (handler *AuthHandler) RevokeSession(response http.ResponseWriter, request *http.Request) {
+	userID, _, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetID := mux.Vars(request)["id"]
+	result, err := handler.DB.Exec(`UPDATE user_session SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		time.Now(), targetID, userID)
+	if err != nil {
+		log.Println("RevokeSession - revoke error:", err)
+		http.Error(response, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(response, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /auth/sessions - выход на всех устройствах, кроме текущего
+func (handler *AuthHandler) RevokeOtherSessions(response http.ResponseWriter, request *http.Request) {
+	userID, sessionID, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	_, err := handler.DB.Exec(`UPDATE user_session SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL`,
+		time.Now(), userID, sessionID)
+	if err != nil {
+		log.Println("RevokeOtherSessions - revoke error:", err)
+		http.Error(response, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/models"
+	"github.com/gorilla/mux"
+)
+
+const maxProfileURLLength = 255
+
+// Ссылки на соцсети принадлежат пользователю и показываются во всех его профилях музыканта
+type SocialLinkHandler struct {
+	DB *sql.DB
+}
+
+// GET /social-networks - поддерживаемые соцсети
+func (handler *SocialLinkHandler) GetSocialNetworks(response http.ResponseWriter, request *http.Request) {
+	rows, err := handler.DB.Query(`SELECT name FROM social_network ORDER BY name`)
+	if err != nil {
+		log.Println("GetSocialNetworks - DB Query error:", err)
+		http.Error(response, "Failed to load social networks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var networks []string = make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Println("GetSocialNetworks - Row Scan error:", err)
+			http.Error(response, "Failed to load social networks", http.StatusInternalServerError)
+			return
+		}
+		networks = append(networks, name)
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(networks)
+}
+
+// GET /user/social-links
+func (handler *SocialLinkHandler) GetSocialLinks(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := handler.DB.Query(`
+		SELECT sn.name, usn.profile_url
+		FROM user_social_network usn
+		JOIN social_network sn ON usn.social_network_id = sn.id
+		WHERE usn.user_id = ?
+		ORDER BY sn.name`, userID)
+	if err != nil {
+		log.Println("GetSocialLinks - DB Query error:", err)
+		http.Error(response, "Failed to load social links", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var links []models.SocialLink = make([]models.SocialLink, 0)
+	for rows.Next() {
+		var link models.SocialLink
+		if err := rows.Scan(&link.Name, &link.URL); err != nil {
+			log.Println("GetSocialLinks - Row Scan error:", err)
+			http.Error(response, "Failed to load social links", http.StatusInternalServerError)
+			return
+		}
+		links = append(links, link)
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(links)
+}
+
+// PUT /user/social-links/{network} - добавляет или заменяет ссылку
+func (handler *SocialLinkHandler) PutSocialLink(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		http.Error(response, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if msg := validateProfileURL(req.URL); msg != "" {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"url": msg})
+		return
+	}
+
+	networkID, networkName, err := handler.findSocialNetwork(mux.Vars(request)["network"])
+	if err == sql.ErrNoRows {
+		http.Error(response, "Unknown social network", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("PutSocialLink - network lookup error:", err)
+		http.Error(response, "Failed to save social link", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("PutSocialLink - begin error:", err)
+		http.Error(response, "Failed to save social link", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM user_social_network WHERE user_id = ? AND social_network_id = ?`, userID, networkID)
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO user_social_network (user_id, social_network_id, profile_url) VALUES (?, ?, ?)`,
+			userID, networkID, req.URL)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("PutSocialLink - save error:", err)
+		http.Error(response, "Failed to save social link", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(models.SocialLink{Name: networkName, URL: req.URL})
+}
+
+// DELETE /user/social-links/{network}
+func (handler *SocialLinkHandler) DeleteSocialLink(response http.ResponseWriter, request *http.Request) {
+	userID, ok := request.Context().Value(middleware.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	networkID, _, err := handler.findSocialNetwork(mux.Vars(request)["network"])
+	if err == sql.ErrNoRows {
+		http.Error(response, "Unknown social network", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("DeleteSocialLink - network lookup error:", err)
+		http.Error(response, "Failed to delete social link", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := handler.DB.Exec(`DELETE FROM user_social_network WHERE user_id = ? AND social_network_id = ?`, userID, networkID)
+	if err != nil {
+		log.Println("DeleteSocialLink - delete error:", err)
+		http.Error(response, "Failed to delete social link", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(response, "Social link not found", http.StatusNotFound)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// Соцсеть ищется по имени без учёта регистра
+func (handler *SocialLinkHandler) findSocialNetwork(name string) (id int, canonical string, err error) {
+	err = handler.DB.QueryRow(`SELECT id, name FROM social_network WHERE LOWER(name) = ?`,
+		strings.ToLower(strings.TrimSpace(name))).Scan(&id, &canonical)
+	return id, canonical, err
+}
+
+func validateProfileURL(raw string) string {
+	if raw == "" {
+		return "URL is required"
+	}
+	if len(raw) > maxProfileURLLength {
+		return "URL is too long"
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "URL must be an absolute http(s) link"
+	}
+	return ""
+}
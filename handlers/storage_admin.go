@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Edafi/MusicVibe/reconcile"
+	"github.com/Edafi/MusicVibe/storage"
+)
+
+// StorageAdminHandler показывает результаты сверки хранилища с БД и запускает её вручную
+type StorageAdminHandler struct {
+	Reconciler *reconcile.Reconciler
+}
+
+type storageObjectResponse struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+type missingObjectResponse struct {
+	Table string `json:"table"`
+	ID    string `json:"id"`
+	Key   string `json:"key"`
+}
+
+type reconcileResponse struct {
+	StartedAt   time.Time               `json:"startedAt"`
+	FinishedAt  time.Time               `json:"finishedAt"`
+	Error       string                  `json:"error,omitempty"`
+	Objects     int                     `json:"objects"`
+	Orphans     []storageObjectResponse `json:"orphans"`
+	Unknown     []storageObjectResponse `json:"unknown"`
+	Missing     []missingObjectResponse `json:"missing"`
+	Quarantined []string                `json:"quarantined"`
+}
+
+func presentObjects(objects []storage.ObjectInfo) []storageObjectResponse {
+	presented := make([]storageObjectResponse, 0, len(objects))
+	for _, object := range objects {
+		presented = append(presented, storageObjectResponse{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+	}
+	return presented
+}
+
+func writeReconcileResult(response http.ResponseWriter, result reconcile.Result) {
+	body := reconcileResponse{
+		StartedAt:   result.StartedAt,
+		FinishedAt:  result.FinishedAt,
+		Objects:     result.Objects,
+		Orphans:     presentObjects(result.Orphans),
+		Unknown:     presentObjects(result.Unknown),
+		Missing:     make([]missingObjectResponse, 0, len(result.Missing)),
+		Quarantined: append(make([]string, 0, len(result.Quarantined)), result.Quarantined...),
+	}
+	if result.Err != nil {
+		body.Error = result.Err.Error()
+	}
+	for _, missing := range result.Missing {
+		body.Missing = append(body.Missing, missingObjectResponse{Table: missing.Table, ID: missing.ID, Key: missing.Key})
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(body)
+}
+
+// GetStorageReport отдаёт результат последней сверки
+func (handler *StorageAdminHandler) GetStorageReport(response http.ResponseWriter, request *http.Request) {
+	result, ok := handler.Reconciler.Last()
+	if !ok {
+		http.Error(response, "Storage has not been reconciled yet", http.StatusNotFound)
+		return
+	}
+	writeReconcileResult(response, result)
+}
+
+// ReconcileStorage запускает сверку сейчас и ждёт её завершения
+func (handler *StorageAdminHandler) ReconcileStorage(response http.ResponseWriter, request *http.Request) {
+	result := handler.Reconciler.RunOnce(request.Context())
+	if result.Err != nil {
+		log.Println("ReconcileStorage - reconcile error:", result.Err)
+		http.Error(response, "Failed to reconcile storage", http.StatusInternalServerError)
+		return
+	}
+	writeReconcileResult(response, result)
+}
@@ -1,48 +1,49 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
-	"path/filepath"
 
-	"github.com/Edafi/MusicVibe/models"
+	"github.com/Edafi/MusicVibe/mediaurl"
+	"github.com/Edafi/MusicVibe/repository"
 	"github.com/gorilla/mux"
 )
 
 type TrackHandler struct {
-	DB *sql.DB
+	Tracks repository.TrackRepo
+	Media  *mediaurl.Builder
 }
 
 func (handler *TrackHandler) GetTrack(response http.ResponseWriter, request *http.Request) {
 	trackID := mux.Vars(request)["id"]
+	viewer := viewerFrom(request)
 
-	var track models.TrackResponse
-
-	query := `
-		SELECT 
-		t.id, t.title, t.musician_id, m.name, a.cover_path, t.file_path, t.duration,
-		t.stream_count, t.visibility
-		FROM track t
-		JOIN musician m ON t.musician_id = m.id
-		JOIN album a ON t.album_id = a.id
-		WHERE t.id = ?
-	`
-
-	err := handler.DB.QueryRow(query, trackID).Scan(&track.ID, &track.Title, &track.ArtistID,
-		&track.ArtistName, &track.ImageURL, &track.AudioURL, &track.Duration, &track.Plays,
-		&track.Visibility,
-	)
+	details, err := handler.Tracks.Get(request.Context(), trackID, viewer)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(response, "Track not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Println("GetTrack - Error fetching track: ", err)
-		http.Error(response, "Track not found", http.StatusNotFound)
+		http.Error(response, "Failed to load track", http.StatusInternalServerError)
 		return
 	}
-	baseURL := "http://37.46.130.29:8080"
-	track.AudioURL = fmt.Sprintf("%s/media/audio/%s", baseURL, track.ID)
-	track.ImageURL = fmt.Sprintf("%s/media/image/%s", baseURL, filepath.Base(track.ImageURL))
+	track := details.TrackResponse
+
+	// Трек по ссылке проигрывается с тем же секретом, с которым его открыли
+	audioShareToken := ""
+	if track.Visibility == VisibilityUnlisted {
+		audioShareToken = details.ShareToken
+	}
+	track.AudioURL = handler.Media.Audio(viewer.UserID, track.ID, audioShareToken)
+	track.ImageURL = handler.Media.Image(track.ImageURL)
+
+	if details.OwnerUserID == viewer.UserID {
+		track.ReleaseAt = details.ReleaseAt
+		track.ShareToken = details.ShareToken
+	}
 
 	response.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(response).Encode(track)
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Edafi/MusicVibe/totp"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer            = "MusicVibe"
+	mfaChallengePurpose   = "mfa_challenge"
+	mfaChallengeTTL       = 5 * time.Minute
+	recoveryCodesCount    = 10
+	recoveryCodeByteCount = 5
+)
+
+var errInvalidSecondFactor = errors.New("invalid two-factor code")
+
+// Промежуточный токен между проверкой пароля и вводом кода 2FA.
+// Не содержит sid, поэтому JWTMiddleware его не примет
+type ChallengeClaims struct {
+	UserID     string `json:"user_id"`
+	Purpose    string `json:"purpose"`
+	DeviceName string `json:"device_name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// Коды вида abcd-efgh; пользователю отдаём открыто один раз, в БД - sha256
+func generateRecoveryCodes() ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		raw := make([]byte, recoveryCodeByteCount)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(raw))
+		codes = append(codes, code[:4]+"-"+code[4:])
+	}
+	return codes, nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID string) ([]string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_recovery_code WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		_, err := tx.Exec(`INSERT INTO user_recovery_code (user_id, code_hash, created_at) VALUES (?, ?, ?)`,
+			userID, hashToken(normalizeRecoveryCode(code)), time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func (handler *AuthHandler) twoFactorEnabled(userID string) (bool, error) {
+	var enabled bool
+	err := handler.DB.QueryRow(`SELECT confirmed_at IS NOT NULL FROM user_totp WHERE user_id = ?`, userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return enabled, err
+}
+
+// Проверяет TOTP-код или одноразовый код восстановления подтверждённой 2FA
+func (handler *AuthHandler) verifySecondFactor(tx *sql.Tx, userID, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		result, err := tx.Exec(`
+			UPDATE user_recovery_code SET used_at = ?
+			WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+			time.Now(), userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return errInvalidSecondFactor
+		}
+		return nil
+	}
+
+	var secret string
+	var lastUsedStep int64
+	err := tx.QueryRow(`
+		SELECT secret, last_used_step FROM user_totp
+		WHERE user_id = ? AND confirmed_at IS NOT NULL
+		FOR UPDATE`, userID).Scan(&secret, &lastUsedStep)
+	if err == sql.ErrNoRows {
+		return errInvalidSecondFactor
+	} else if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), lastUsedStep)
+	if !ok {
+		return errInvalidSecondFactor
+	}
+	_, err = tx.Exec(`UPDATE user_totp SET last_used_step = ? WHERE user_id = ?`, step, userID)
+	return err
+}
+
+func (handler *AuthHandler) issueMFAChallenge(userID, device string) (string, error) {
+	claims := &ChallengeClaims{
+		UserID:     userID,
+		Purpose:    mfaChallengePurpose,
+		DeviceName: device,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaChallengeTTL)),
+		},
+	}
+	return handler.Keys.Sign(claims)
+}
+
+// POST /auth/2fa/enroll - создаёт новый (ещё не подтверждённый) секрет
+func (handler *AuthHandler) EnrollTwoFactor(response http.ResponseWriter, request *http.Request) {
+	userID, _, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := handler.twoFactorEnabled(userID)
+	if err != nil {
+		log.Println("EnrollTwoFactor - status error:", err)
+		http.Error(response, "Failed to enroll", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(response, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	var email string
+	if err := handler.DB.QueryRow(`SELECT email FROM user WHERE id = ?`, userID).Scan(&email); err != nil {
+		log.Println("EnrollTwoFactor - user error:", err)
+		http.Error(response, "User not found", http.StatusNotFound)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Println("EnrollTwoFactor - secret error:", err)
+		http.Error(response, "Failed to enroll", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = handler.DB.Exec(`
+		INSERT INTO user_totp (user_id, secret, last_used_step, created_at) VALUES (?, ?, 0, ?)
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), last_used_step = 0, created_at = VALUES(created_at), confirmed_at = NULL`,
+		userID, secret, time.Now())
+	if err != nil {
+		log.Println("EnrollTwoFactor - insert error:", err)
+		http.Error(response, "Failed to enroll", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(map[string]interface{}{
+		"secret":          secret,
+		"provisioningUri": totp.ProvisioningURI(totpIssuer, email, secret),
+	})
+}
+
+// POST /auth/2fa/confirm - первый корректный код включает 2FA и выдаёт коды восстановления
+func (handler *AuthHandler) ConfirmTwoFactor(response http.ResponseWriter, request *http.Request) {
+	userID, _, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("ConfirmTwoFactor - begin error:", err)
+		http.Error(response, "Failed to confirm", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var secret string
+	err = tx.QueryRow(`SELECT secret FROM user_totp WHERE user_id = ? AND confirmed_at IS NULL FOR UPDATE`, userID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		http.Error(response, "No pending enrollment", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Println("ConfirmTwoFactor - select error:", err)
+		http.Error(response, "Failed to confirm", http.StatusInternalServerError)
+		return
+	}
+
+	step, valid := totp.Validate(secret, req.Code, time.Now(), 0)
+	if !valid {
+		http.Error(response, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE user_totp SET confirmed_at = ?, last_used_step = ? WHERE user_id = ?`, time.Now(), step, userID); err != nil {
+		log.Println("ConfirmTwoFactor - update error:", err)
+		http.Error(response, "Failed to confirm", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		log.Println("ConfirmTwoFactor - recovery codes error:", err)
+		http.Error(response, "Failed to confirm", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("ConfirmTwoFactor - commit error:", err)
+		http.Error(response, "Failed to confirm", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(map[string]interface{}{"recoveryCodes": codes})
+}
+
+// POST /auth/2fa/disable - требует пароль и действующий код
+func (handler *AuthHandler) DisableTwoFactor(response http.ResponseWriter, request *http.Request) {
+	userID, _, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash string
+	if err := handler.DB.QueryRow(`SELECT passwd_hash FROM user WHERE id = ?`, userID).Scan(&passwordHash); err != nil {
+		log.Println("DisableTwoFactor - user error:", err)
+		http.Error(response, "User not found", http.StatusNotFound)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		http.Error(response, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("DisableTwoFactor - begin error:", err)
+		http.Error(response, "Failed to disable", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = handler.verifySecondFactor(tx, userID, req.Code, req.RecoveryCode)
+	if errors.Is(err, errInvalidSecondFactor) {
+		http.Error(response, "Invalid code", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Println("DisableTwoFactor - verify error:", err)
+		http.Error(response, "Failed to disable", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID); err == nil {
+		_, err = tx.Exec(`DELETE FROM user_recovery_code WHERE user_id = ?`, userID)
+	}
+	if err != nil {
+		log.Println("DisableTwoFactor - delete error:", err)
+		http.Error(response, "Failed to disable", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("DisableTwoFactor - commit error:", err)
+		http.Error(response, "Failed to disable", http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// POST /auth/2fa/recovery-codes - выдаёт новый набор, старые коды перестают действовать
+func (handler *AuthHandler) RegenerateRecoveryCodes(response http.ResponseWriter, request *http.Request) {
+	userID, _, ok := sessionFromContext(request)
+	if !ok {
+		http.Error(response, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("RegenerateRecoveryCodes - begin error:", err)
+		http.Error(response, "Failed to regenerate codes", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = handler.verifySecondFactor(tx, userID, req.Code, "")
+	if errors.Is(err, errInvalidSecondFactor) {
+		http.Error(response, "Invalid code", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Println("RegenerateRecoveryCodes - verify error:", err)
+		http.Error(response, "Failed to regenerate codes", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		log.Println("RegenerateRecoveryCodes - codes error:", err)
+		http.Error(response, "Failed to regenerate codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("RegenerateRecoveryCodes - commit error:", err)
+		http.Error(response, "Failed to regenerate codes", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(map[string]interface{}{"recoveryCodes": codes})
+}
+
+// POST /auth/2fa/verify - второй шаг логина: challenge-токен + код, в ответ настоящие токены
+func (handler *AuthHandler) VerifyTwoFactor(response http.ResponseWriter, request *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		http.Error(response, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	claims := &ChallengeClaims{}
+	token, err := handler.Keys.Parse(req.ChallengeToken, claims)
+	if err != nil || !token.Valid || claims.Purpose != mfaChallengePurpose || claims.UserID == "" {
+		http.Error(response, "Invalid challenge", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := request.Context()
+	ip := clientIP(request)
+	// Перебор кодов ограничиваем так же, как перебор паролей
+	guardKey := "2fa:" + claims.UserID
+	verdict, err := handler.Guard.Check(ctx, guardKey, ip)
+	if err != nil {
+		log.Println("VerifyTwoFactor - guard error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	if verdict.Blocked() {
+		writeTooManyAttempts(response, verdict.RetryAfter)
+		return
+	}
+
+	tx, err := handler.DB.Begin()
+	if err != nil {
+		log.Println("VerifyTwoFactor - begin error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = handler.verifySecondFactor(tx, claims.UserID, req.Code, req.RecoveryCode)
+	if errors.Is(err, errInvalidSecondFactor) {
+		handler.recordLoginFailure(ctx, guardKey, claims.UserID, ip)
+		http.Error(response, "Invalid code", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Println("VerifyTwoFactor - verify error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("VerifyTwoFactor - commit error:", err)
+		http.Error(response, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	handler.recordLoginSuccess(ctx, guardKey, claims.UserID, ip)
+
+	handler.completeLogin(response, request, claims.UserID, claims.DeviceName)
+}
@@ -15,14 +15,20 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Edafi/MusicVibe/imageproc"
+	"github.com/Edafi/MusicVibe/metrics"
 	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/repository"
+	"github.com/Edafi/MusicVibe/storage"
 	"github.com/google/uuid"
-	"github.com/minio/minio-go/v7"
 )
 
 type UploadHandler struct {
-	DB          *sql.DB
-	MinioClient *minio.Client
+	DB             *sql.DB
+	Store          storage.BlobStore
+	Bucket         string
+	MaxUploadBytes int64
+	MaxImageBytes  int64
 }
 
 func saveTempFile(file multipart.File, filename string) (string, error) {
@@ -42,7 +48,9 @@ func saveTempFile(file multipart.File, filename string) (string, error) {
 
 func getAudioDuration(filePath string) (int, error) {
 	cmd := exec.Command("ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", filePath)
+	started := time.Now()
 	out, err := cmd.Output()
+	metrics.ObserveCommand("ffprobe", started, err)
 	if err != nil {
 		return 0, err
 	}
@@ -58,15 +66,12 @@ func getAudioDuration(filePath string) (int, error) {
 	return int(seconds), nil
 }
 
-func uploadToMinIO(client *minio.Client, bucketName, objectName string, file multipart.File, fileSize int64, contentType string) (string, error) {
-	_, err := client.PutObject(context.Background(), bucketName, objectName, file, fileSize, minio.PutObjectOptions{
-		ContentType: contentType,
-	})
-	if err != nil {
-		log.Fatal("uploadToMinIO: ", err)
-		return "", err
+// Ошибка загрузки одного файла не должна останавливать сервер - её обрабатывает вызывающий
+func uploadObject(ctx context.Context, store storage.BlobStore, bucketName, key string, file multipart.File, fileSize int64, contentType string) (string, error) {
+	if err := store.Put(ctx, key, file, fileSize, contentType); err != nil {
+		return "", fmt.Errorf("upload %s: %w", key, err)
 	}
-	return fmt.Sprintf("/%s/%s", bucketName, objectName), nil
+	return storage.StoredPath(bucketName, key), nil
 }
 
 func (handler *UploadHandler) UploadAlbum(response http.ResponseWriter, request *http.Request) {
@@ -76,34 +81,63 @@ func (handler *UploadHandler) UploadAlbum(response http.ResponseWriter, request
 		return
 	}
 
-	err := request.ParseMultipartForm(50 << 20) // 50MB
+	metrics.UploadsInProgress.Inc()
+	defer metrics.UploadsInProgress.Dec()
+
+	err := parseMultipartForm(response, request, handler.MaxUploadBytes)
 	if err != nil {
 		log.Println("UploadAlbum: ", err)
-		http.Error(response, "Cannot parse multipart form", http.StatusBadRequest)
+		writeFormError(response, err)
 		return
 	}
 
-	fmt.Println("Content-Type:", request.Header.Get("Content-Type"))
-
 	// Парсим поля
 	albumTitle := request.FormValue("albumTitle")
 	albumDescription := request.FormValue("albumDescription")
 	genreName := request.FormValue("genre")
 
 	// Обложка
-	coverFile, coverHeader, err := request.FormFile("cover")
+	coverFile, _, err := request.FormFile("cover")
 	if err != nil {
 		log.Println("UploadAlbum: ", err)
-		log.Println("Content-Type:", request.Header.Get("Content-Type"))
 		http.Error(response, "Missing cover file", http.StatusBadRequest)
 		return
 	}
-	defer coverFile.Close()
+	coverFile.Close()
 
-	log.Println("Album:", albumTitle)
-	log.Println("Genre:", genreName)
-	log.Println("Cover filename:", coverHeader.Filename)
-	log.Println("user_id:", userID)
+	// Обложка декодируется и перекодируется целиком: исходный файл в хранилище не попадает
+	cover, problem := readImageUpload(request, "cover", handler.MaxImageBytes)
+	if problem != "" {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"cover": problem})
+		return
+	}
+	if bounds := cover.Bounds(); bounds.Dx() < imageproc.MinCoverSide || bounds.Dy() < imageproc.MinCoverSide {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"cover": "Cover must be at least 300x300 pixels"})
+		return
+	}
+
+	// Видимость задаётся сразу для всех треков альбома
+	visibility := request.FormValue("visibility")
+	if visibility == "" {
+		visibility = VisibilityPublic
+	}
+	var releaseAt *time.Time
+	if raw := request.FormValue("releaseAt"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{"releaseAt": "Release time must be in RFC 3339 format"})
+			return
+		}
+		releaseAt = &parsed
+	}
+	if field, message := validateVisibility(visibility, releaseAt); message != "" {
+		writeFieldErrors(response, http.StatusBadRequest, "Validation failed", FieldErrors{field: message})
+		return
+	}
+	var trackReleaseAt interface{}
+	if visibility == VisibilityScheduled {
+		trackReleaseAt = *releaseAt
+	}
 
 	// Genre
 	var genreID int
@@ -114,12 +148,15 @@ func (handler *UploadHandler) UploadAlbum(response http.ResponseWriter, request
 		return
 	}
 
-	// Musician
-	var musicianID string
-	err = handler.DB.QueryRow(`SELECT id FROM musician WHERE user_id = ?`, userID).Scan(&musicianID)
-	if err != nil {
+	// Музыкант, от имени которого загружается альбом, должен принадлежать пользователю
+	musicianID, err := ownedMusicianID(handler.DB, userID, request.FormValue("musicianId"))
+	if err == errNoArtistProfile {
 		log.Println("UploadAlbum: ", err)
-		http.Error(response, "Musician not found", http.StatusBadRequest)
+		http.Error(response, "Artist profile not found", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Println("UploadAlbum: ", err)
+		http.Error(response, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -130,11 +167,10 @@ func (handler *UploadHandler) UploadAlbum(response http.ResponseWriter, request
 	}
 
 	albumID := uuid.New().String()
-	bucketName := "music"
+	bucketName := handler.Bucket
 
-	// Путь к обложке: musician_{id}/cover/album_{id}.jpg
-	coverObject := fmt.Sprintf("musician_%s/cover/album_%s.jpg", musicianID, albumID)
-	coverPath, err := uploadToMinIO(handler.MinioClient, bucketName, coverObject, coverFile, coverHeader.Size, coverHeader.Header.Get("Content-Type"))
+	// Путь к обложке: musician_{id}/cover/album_{id}.jpg и варианты album_{id}_{size}.jpg/.webp
+	coverPath, err := StoreImageVariants(request.Context(), handler.Store, bucketName, storage.MusicianDir(musicianID), storage.KindCover, albumID, cover, imageproc.CoverVariants)
 	if err != nil {
 		log.Println("UploadAlbum: ", err)
 		http.Error(response, "Failed to upload cover", http.StatusInternalServerError)
@@ -160,9 +196,6 @@ func (handler *UploadHandler) UploadAlbum(response http.ResponseWriter, request
 	trackTitles := form.Value["trackTitles[]"]
 	trackFiles := form.File["trackFiles[]"]
 
-	log.Println("trackTitles:", trackTitles)
-	log.Println("trackFiles:", trackFiles)
-
 	if len(trackTitles) != len(trackFiles) {
 		log.Println("Количество названий треков не совпадает с количеством файлов")
 		http.Error(response, "Invalid track data", http.StatusBadRequest)
@@ -182,8 +215,8 @@ func (handler *UploadHandler) UploadAlbum(response http.ResponseWriter, request
 
 		trackID := uuid.New().String()
 
-		objectName := fmt.Sprintf("musician_%s/tracks/track_%s.mp3", musicianID, trackID)
-		audioPath, err := uploadToMinIO(handler.MinioClient, bucketName, objectName, audioFile, audioFileHeader.Size, audioFileHeader.Header.Get("Content-Type"))
+		objectName := storage.TrackAudioKey(musicianID, trackID)
+		audioPath, err := uploadObject(request.Context(), handler.Store, bucketName, objectName, audioFile, audioFileHeader.Size, audioFileHeader.Header.Get("Content-Type"))
 		if err != nil {
 			log.Println("Failed to upload audio:", err)
 			continue
@@ -203,11 +236,21 @@ func (handler *UploadHandler) UploadAlbum(response http.ResponseWriter, request
 			continue
 		}
 
+		var shareToken interface{}
+		if visibility == VisibilityUnlisted {
+			token, err := repository.NewShareToken()
+			if err != nil {
+				log.Println("Failed to create share token:", err)
+				continue
+			}
+			shareToken = token
+		}
+
 		titleLower := strings.ToLower(title)
 		_, err = handler.DB.Exec(`
-			INSERT INTO track (id, title, album_id, musician_id, file_path, genre_id, duration, stream_count, visibility, title_lower)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			trackID, title, albumID, musicianID, audioPath, genreID, duration, 0, "public", titleLower,
+			INSERT INTO track (id, title, album_id, musician_id, file_path, genre_id, duration, stream_count, visibility, title_lower, release_at, share_token)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			trackID, title, albumID, musicianID, audioPath, genreID, duration, 0, visibility, titleLower, trackReleaseAt, shareToken,
 		)
 		if err != nil {
 			log.Println("Failed to insert track:", err)
@@ -1,35 +1,26 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/Edafi/MusicVibe/middleware"
 	"github.com/Edafi/MusicVibe/models"
+	"github.com/Edafi/MusicVibe/repository"
 	"github.com/gorilla/mux"
 )
 
 type UserHandler struct {
-	DB *sql.DB
+	Users repository.UserRepo
 }
 
 func (handler *UserHandler) GetUsers(response http.ResponseWriter, request *http.Request) {
-	rows, err := handler.DB.Query("SELECT id, email, passwd_hash, role, display_name, avatar_path, creation_date FROM user")
+	users, err := handler.Users.List(request.Context())
 	if err != nil {
 		http.Error(response, "Database error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var users []models.User
-	for rows.Next() {
-		var u models.User
-		if err := rows.Scan(&u.ID, &u.Email, &u.PasswdHash, &u.Role, &u.Username, &u.AvatarPath, &u.CreationDate); err != nil {
-			http.Error(response, "Scan error", http.StatusInternalServerError)
-			return
-		}
-		users = append(users, u)
-	}
 
 	response.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(response).Encode(users)
@@ -39,10 +30,8 @@ func (handler *UserHandler) GetUser(response http.ResponseWriter, request *http.
 	params := mux.Vars(request)
 	id := params["id"]
 
-	var user models.User
-	err := handler.DB.QueryRow("SELECT id, email, passwd_hash, role, display_name, avatar_path, creation_date FROM user WHERE id = ?", id).
-		Scan(&user.ID, &user.Email, &user.PasswdHash, &user.Role, &user.Username, &user.AvatarPath, &user.CreationDate)
-	if err == sql.ErrNoRows {
+	user, err := handler.Users.Get(request.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.NotFound(response, request)
 		return
 	} else if err != nil {
@@ -60,10 +49,12 @@ func (handler *UserHandler) CreateUser(response http.ResponseWriter, request *ht
 		http.Error(response, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if !middleware.IsValidRole(u.Role) {
+		http.Error(response, "Invalid role", http.StatusBadRequest)
+		return
+	}
 
-	_, err := handler.DB.Exec("INSERT INTO user (id, email, passwd_hash, role, display_name, avatar_path) VALUES (?, ?, ?, ?, ?, ?)",
-		u.ID, u.Email, u.PasswdHash, u.Role, u.Username, u.AvatarPath)
-	if err != nil {
+	if err := handler.Users.Create(request.Context(), u); err != nil {
 		http.Error(response, "Database insert error", http.StatusInternalServerError)
 		return
 	}
@@ -74,8 +65,7 @@ func (handler *UserHandler) CreateUser(response http.ResponseWriter, request *ht
 
 func (handler *UserHandler) DeleteUser(response http.ResponseWriter, request *http.Request) {
 	id := mux.Vars(request)["id"]
-	_, err := handler.DB.Exec("DELETE FROM user WHERE id = ?", id)
-	if err != nil {
+	if err := handler.Users.Delete(request.Context(), id); err != nil {
 		http.Error(response, "Failed to delete user", http.StatusInternalServerError)
 		return
 	}
@@ -89,8 +79,15 @@ func (handler *UserHandler) UpdateUser(response http.ResponseWriter, request *ht
 		http.Error(response, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	_, err := handler.DB.Exec("UPDATE user SET email=?, passwd_hash=?, role=?, display_name=?, avatar_path=? WHERE id=?",
-		user.Email, user.PasswdHash, user.Role, user.Username, user.AvatarPath, id)
+	if !middleware.IsValidRole(user.Role) {
+		http.Error(response, "Invalid role", http.StatusBadRequest)
+		return
+	}
+	err := handler.Users.Update(request.Context(), id, user)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.NotFound(response, request)
+		return
+	}
 	if err != nil {
 		http.Error(response, "Failed to update user", http.StatusInternalServerError)
 		return
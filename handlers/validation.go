@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 32
+	maxEmailLength    = 254
+	minPasswordLength = 8
+	// bcrypt учитывает только первые 72 байта пароля
+	maxPasswordBytes = 72
+)
+
+// FieldErrors - ошибки валидации по полям запроса
+type FieldErrors map[string]string
+
+func (fields FieldErrors) Add(field, message string) {
+	if message != "" {
+		fields[field] = message
+	}
+}
+
+func writeFieldErrors(response http.ResponseWriter, status int, message string, fields FieldErrors) {
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	json.NewEncoder(response).Encode(map[string]interface{}{
+		"error":  message,
+		"fields": fields,
+	})
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func validateEmail(email string) string {
+	if email == "" {
+		return "Email is required"
+	}
+	if len(email) > maxEmailLength {
+		return "Email is too long"
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "Invalid email format"
+	}
+	return ""
+}
+
+func validateUsername(username string) string {
+	length := utf8.RuneCountInString(username)
+	if length == 0 {
+		return "Username is required"
+	}
+	if length < minUsernameLength || length > maxUsernameLength {
+		return "Username must be between 3 and 32 characters"
+	}
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '.' && r != ' ' {
+			return "Username may contain only letters, digits, spaces and _ - ."
+		}
+	}
+	if strings.TrimSpace(username) != username {
+		return "Username must not start or end with a space"
+	}
+	return ""
+}
+
+func validatePassword(password string) string {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return "Password must be at least 8 characters"
+	}
+	if len(password) > maxPasswordBytes {
+		return "Password is too long"
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return "Password must contain letters and digits"
+	}
+	return ""
+}
+
+// ValidateAccount проверяет данные новой учётной записи так же, как регистрация.
+// Email должен быть уже нормализован
+func ValidateAccount(username, email, password string) FieldErrors {
+	fields := FieldErrors{}
+	fields.Add("username", validateUsername(username))
+	fields.Add("email", validateEmail(email))
+	fields.Add("password", validatePassword(password))
+	return fields
+}
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Edafi/MusicVibe/repository"
+)
+
+// Режимы видимости трека:
+//   - public    - виден всем, попадает в поиск, чарты и рекомендации
+//   - unlisted  - доступен по ссылке с share-токеном, но нигде не показывается
+//   - private   - только владельцу
+//   - scheduled - как private до release_at, затем планировщик делает трек public
+const (
+	VisibilityPublic    = "public"
+	VisibilityUnlisted  = "unlisted"
+	VisibilityPrivate   = "private"
+	VisibilityScheduled = "scheduled"
+)
+
+func isValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate, VisibilityScheduled:
+		return true
+	}
+	return false
+}
+
+// Share-токен передаётся в параметре ?share=
+func shareTokenFrom(request *http.Request) string {
+	return request.URL.Query().Get("share")
+}
+
+func viewerFrom(request *http.Request) repository.Viewer {
+	return repository.Viewer{UserID: requestUserID(request), ShareToken: shareTokenFrom(request)}
+}
+
+// Проверяет новые значения видимости и возвращает сообщение об ошибке для поля
+func validateVisibility(visibility string, releaseAt *time.Time) (field, message string) {
+	if !isValidVisibility(visibility) {
+		return "visibility", "Visibility must be one of public, unlisted, private, scheduled"
+	}
+	if visibility == VisibilityScheduled {
+		if releaseAt == nil {
+			return "releaseAt", "Release time is required for scheduled tracks"
+		}
+		if !releaseAt.After(time.Now()) {
+			return "releaseAt", "Release time must be in the future"
+		}
+	}
+	return "", ""
+}
+
+// То же для PATCH, где оба поля необязательны. releaseAt без visibility = scheduled
+// отклоняется, а не теряется молча: время релиза действует только для scheduled
+func validateVisibilityChange(visibility *string, releaseAt *time.Time) (field, message string) {
+	if releaseAt != nil && (visibility == nil || *visibility != VisibilityScheduled) {
+		return "releaseAt", "Release time can only be set together with visibility scheduled"
+	}
+	if visibility == nil {
+		return "", ""
+	}
+	return validateVisibility(*visibility, releaseAt)
+}
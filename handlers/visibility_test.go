@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateVisibilityChange(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	scheduled, private := VisibilityScheduled, VisibilityPrivate
+
+	for _, tc := range []struct {
+		name       string
+		visibility *string
+		releaseAt  *time.Time
+		wantField  string
+	}{
+		{"nothing", nil, nil, ""},
+		{"visibility only", &private, nil, ""},
+		{"scheduled with release", &scheduled, &future, ""},
+		{"scheduled without release", &scheduled, nil, "releaseAt"},
+		{"release without visibility", nil, &future, "releaseAt"},
+		{"release with other visibility", &private, &future, "releaseAt"},
+	} {
+		field, message := validateVisibilityChange(tc.visibility, tc.releaseAt)
+		if field != tc.wantField || (tc.wantField != "") != (message != "") {
+			t.Errorf("%s: got (%q, %q), want field %q", tc.name, field, message, tc.wantField)
+		}
+	}
+}
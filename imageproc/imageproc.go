@@ -0,0 +1,155 @@
+// Package imageproc проверяет загружаемые изображения, убирает метаданные
+// и готовит уменьшенные копии для аватаров, фонов и обложек.
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// Защита от "бомб": маленький файл с огромным разрешением
+	MaxPixels   = 40_000_000
+	jpegQuality = 85
+)
+
+var (
+	ErrTooLarge          = errors.New("image is too large")
+	ErrUnsupportedFormat = errors.New("image must be a JPEG or PNG")
+)
+
+// Variant - размер, в котором хранится изображение. Height == 0 сохраняет пропорции,
+// иначе изображение обрезается по центру до нужного соотношения сторон
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+var (
+	AvatarVariants = []Variant{
+		{Name: "large", Width: 512, Height: 512},
+		{Name: "medium", Width: 256, Height: 256},
+		{Name: "small", Width: 64, Height: 64},
+	}
+	CoverVariants = []Variant{
+		{Name: "large", Width: 1200, Height: 1200},
+		{Name: "medium", Width: 600, Height: 600},
+		{Name: "small", Width: 300, Height: 300},
+		{Name: "thumb", Width: 64, Height: 64},
+	}
+	BackgroundVariants = []Variant{
+		{Name: "large", Width: 1920},
+		{Name: "medium", Width: 1280},
+		{Name: "small", Width: 640},
+	}
+)
+
+// Минимальная сторона обложки, чтобы крупный вариант не был мыльным
+const MinCoverSide = 300
+
+// IsVariantName - допустимое значение параметра ?size=
+func IsVariantName(name string) bool {
+	for _, variants := range [][]Variant{AvatarVariants, CoverVariants, BackgroundVariants} {
+		for _, variant := range variants {
+			if variant.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Decode читает не больше maxBytes байт и декодирует JPEG или PNG
+// с учётом EXIF-ориентации. Сами метаданные дальше не используются
+func Decode(r io.Reader, maxBytes int64) (image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// Resize уменьшает изображение под вариант. Увеличение не делается
+func Resize(src image.Image, variant Variant) image.Image {
+	bounds := src.Bounds()
+	if variant.Height > 0 {
+		bounds = cropToAspect(bounds, variant.Width, variant.Height)
+	}
+
+	width, height := variant.Width, variant.Height
+	if height == 0 {
+		height = bounds.Dy() * width / bounds.Dx()
+	}
+	if width >= bounds.Dx() {
+		width, height = bounds.Dx(), bounds.Dy()
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// EncodeJPEG перекодирует изображение; стандартный кодировщик не пишет EXIF,
+// поэтому геолокация и данные камеры из оригинала не сохраняются
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Render готовит JPEG для каждого варианта
+func Render(img image.Image, variants []Variant) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(variants))
+	for _, variant := range variants {
+		data, err := EncodeJPEG(Resize(img, variant))
+		if err != nil {
+			return nil, fmt.Errorf("encode %s: %w", variant.Name, err)
+		}
+		result[variant.Name] = data
+	}
+	return result, nil
+}
+
+func cropToAspect(bounds image.Rectangle, width, height int) image.Rectangle {
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW*height > srcH*width {
+		cropW := srcH * width / height
+		x := bounds.Min.X + (srcW-cropW)/2
+		return image.Rect(x, bounds.Min.Y, x+cropW, bounds.Max.Y)
+	}
+	cropH := srcW * height / width
+	y := bounds.Min.Y + (srcH-cropH)/2
+	return image.Rect(bounds.Min.X, y, bounds.Max.X, y+cropH)
+}
@@ -0,0 +1,46 @@
+package imageproc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/Edafi/MusicVibe/metrics"
+)
+
+// В стандартной библиотеке и x/image нет WebP-кодировщика, поэтому используем ffmpeg,
+// который уже нужен серверу для обработки аудио
+var ErrWebPUnavailable = errors.New("ffmpeg with libwebp is not available")
+
+func WebPAvailable() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil
+}
+
+// EncodeWebP перекодирует готовый JPEG-вариант в WebP
+func EncodeWebP(ctx context.Context, jpegData []byte) ([]byte, error) {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, ErrWebPUnavailable
+	}
+
+	cmd := exec.CommandContext(ctx, path,
+		"-v", "error",
+		"-f", "image2pipe", "-i", "pipe:0",
+		"-c:v", "libwebp", "-quality", "80",
+		"-f", "webp", "pipe:1")
+	cmd.Stdin = bytes.NewReader(jpegData)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	started := time.Now()
+	err = cmd.Run()
+	metrics.ObserveCommand("ffmpeg", started, err)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg webp: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,198 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Минимальная длина секрета для HS256
+const minHMACSecretLength = 32
+
+var (
+	ErrUnknownKey        = errors.New("jwtkeys: unknown key id")
+	ErrAlgorithmMismatch = errors.New("jwtkeys: signing method does not match key")
+)
+
+// Key - один ключ подписи. Ключи только для проверки не имеют signKey
+type Key struct {
+	ID        string
+	Algorithm string
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func (key *Key) CanSign() bool {
+	return key.signKey != nil
+}
+
+func (key *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(key.Algorithm)
+}
+
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < minHMACSecretLength {
+		return nil, fmt.Errorf("jwtkeys: HS256 secret for key %q must be at least %d bytes", id, minHMACSecretLength)
+	}
+	return &Key{ID: id, Algorithm: AlgHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+func NewRSAKey(id string, private *rsa.PrivateKey, public *rsa.PublicKey) (*Key, error) {
+	if private != nil {
+		public = &private.PublicKey
+	}
+	if public == nil {
+		return nil, fmt.Errorf("jwtkeys: RS256 key %q has no key material", id)
+	}
+	if public.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("jwtkeys: RS256 key %q must be at least 2048 bits", id)
+	}
+	key := &Key{ID: id, Algorithm: AlgRS256, verifyKey: public}
+	if private != nil {
+		key.signKey = private
+	}
+	return key, nil
+}
+
+func NewEd25519Key(id string, private ed25519.PrivateKey, public ed25519.PublicKey) (*Key, error) {
+	if private != nil {
+		public = private.Public().(ed25519.PublicKey)
+	}
+	if public == nil {
+		return nil, fmt.Errorf("jwtkeys: EdDSA key %q has no key material", id)
+	}
+	key := &Key{ID: id, Algorithm: AlgEdDSA, verifyKey: public}
+	if private != nil {
+		key.signKey = private
+	}
+	return key, nil
+}
+
+// KeySet хранит все активные ключи. Подписываем одним ключом, проверяем любым
+// из набора - так можно ротировать ключи без разлогинивания пользователей
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+func NewKeySet(signingKeyID string, keys ...*Key) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("jwtkeys: key without id")
+		}
+		if _, exists := set.keys[key.ID]; exists {
+			return nil, fmt.Errorf("jwtkeys: duplicate key id %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+
+	signing, ok := set.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwtkeys: signing key %q not found", signingKeyID)
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("jwtkeys: signing key %q has no private part", signingKeyID)
+	}
+	set.signing = signing
+	return set, nil
+}
+
+// NewEphemeralKeySet создаёт случайный HS256 ключ. Только для локальной разработки:
+// после перезапуска все выданные токены становятся недействительными
+func NewEphemeralKeySet() (*KeySet, error) {
+	secret := make([]byte, 64)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key, err := NewHMACKey("ephemeral", secret)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(key.ID, key)
+}
+
+func (set *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(set.signing.method(), claims)
+	token.Header["kid"] = set.signing.ID
+	return token.SignedString(set.signing.signKey)
+}
+
+// Parse проверяет подпись ключом из заголовка kid. Алгоритм токена обязан
+// совпадать с алгоритмом ключа, "none" и подмена RS256 на HS256 отклоняются
+func (set *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := set.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, ErrAlgorithmMismatch
+		}
+		return key.verifyKey, nil
+	}, jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}), jwt.WithExpirationRequired())
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает публичные ключи. Симметричные ключи никогда не публикуются
+func (set *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(set.keys))}
+	for _, key := range set.keys {
+		if jwk, ok := publicJWK(key); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+func publicJWK(key *Key) (JWK, bool) {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch public := key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: key.Algorithm,
+			KeyID:     key.ID,
+			N:         encode(public.N.Bytes()),
+			E:         encode(big.NewInt(int64(public.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			Use:       "sig",
+			Algorithm: key.Algorithm,
+			KeyID:     key.ID,
+			Curve:     "Ed25519",
+			X:         encode(public),
+		}, true
+	}
+	return JWK{}, false
+}
@@ -0,0 +1,215 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   "user-1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func newRSAKey(t *testing.T, id string) (*Key, *rsa.PrivateKey) {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewRSAKey(id, private, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, private
+}
+
+func newEd25519Key(t *testing.T, id string) *Key {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewEd25519Key(id, private, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newHMACKey(t *testing.T, id string) *Key {
+	t.Helper()
+	key, err := NewHMACKey(id, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, signKey interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, testClaims())
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestSignAndParse(t *testing.T) {
+	for _, key := range []*Key{newHMACKey(t, "hs"), newEd25519Key(t, "ed")} {
+		set, err := NewKeySet(key.ID, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := set.Sign(testClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var claims jwt.RegisteredClaims
+		if _, err := set.Parse(signed, &claims); err != nil {
+			t.Errorf("%s: %v", key.Algorithm, err)
+		}
+		if claims.Subject != "user-1" {
+			t.Errorf("%s: subject = %q", key.Algorithm, claims.Subject)
+		}
+	}
+}
+
+// Классическая подмена: HS256-подпись, где секретом служит публичный ключ RSA
+func TestRejectsHS256SignedWithRSAPublicKey(t *testing.T) {
+	key, private := newRSAKey(t, "rsa")
+	set, err := NewKeySet(key.ID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, secret := range map[string][]byte{
+		"PKIX":  mustMarshalPKIX(t, &private.PublicKey),
+		"PKCS1": x509.MarshalPKCS1PublicKey(&private.PublicKey),
+	} {
+		forged := signWith(t, jwt.SigningMethodHS256, key.ID, secret)
+		if _, err := set.Parse(forged, &jwt.RegisteredClaims{}); !errors.Is(err, ErrAlgorithmMismatch) {
+			t.Errorf("%s: err = %v, want ErrAlgorithmMismatch", name, err)
+		}
+	}
+}
+
+func mustMarshalPKIX(t *testing.T, public *rsa.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestRejectsUnknownOrMissingKid(t *testing.T) {
+	key := newHMACKey(t, "current")
+	set, err := NewKeySet(key.ID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kid := range []string{"", "other"} {
+		token := signWith(t, jwt.SigningMethodHS256, kid, key.signKey)
+		if _, err := set.Parse(token, &jwt.RegisteredClaims{}); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("kid %q: err = %v, want ErrUnknownKey", kid, err)
+		}
+	}
+}
+
+// Ключ выведен из подписи, но его публичная часть ещё в наборе: старые токены действуют
+func TestAcceptsRetiredPublishedKey(t *testing.T) {
+	current := newEd25519Key(t, "2025-06")
+	_, retiredPrivate := newRSAKey(t, "2025-01")
+	retired, err := NewRSAKey("2025-01", nil, &retiredPrivate.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := NewKeySet(current.ID, current, retired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := signWith(t, jwt.SigningMethodRS256, retired.ID, retiredPrivate)
+	if _, err := set.Parse(old, &jwt.RegisteredClaims{}); err != nil {
+		t.Fatalf("token from retired key rejected: %v", err)
+	}
+
+	if _, err := NewKeySet(retired.ID, current, retired); err == nil {
+		t.Error("public-only key accepted as signing key")
+	}
+}
+
+func TestJWKSExportsOnlyPublicKeys(t *testing.T) {
+	rsaKey, private := newRSAKey(t, "rsa")
+	edKey := newEd25519Key(t, "ed")
+	set, err := NewKeySet(edKey.ID, edKey, rsaKey, newHMACKey(t, "hs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := set.JWKS()
+	found := map[string]JWK{}
+	for _, jwk := range jwks.Keys {
+		found[jwk.KeyID] = jwk
+	}
+	if _, ok := found["hs"]; ok {
+		t.Error("HS256 secret published in JWKS")
+	}
+	if len(found) != 2 {
+		t.Fatalf("JWKS has %d keys, want rsa and ed", len(found))
+	}
+	if found["rsa"].KeyType != "RSA" || found["ed"].KeyType != "OKP" {
+		t.Errorf("unexpected key types: %+v", found)
+	}
+
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, jwk := range raw.Keys {
+		for _, field := range []string{"d", "p", "q", "dp", "dq", "qi", "k"} {
+			if _, ok := jwk[field]; ok {
+				t.Errorf("key %v exposes private field %q", jwk["kid"], field)
+			}
+		}
+	}
+
+	// Опубликованный ключ проверяет подпись, значит это именно публичная часть
+	published, err := NewRSAKey("rsa", nil, &private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := publicJWKOrFail(t, published); found["rsa"] != want {
+		t.Errorf("rsa JWK = %+v, want %+v", found["rsa"], want)
+	}
+}
+
+func publicJWKOrFail(t *testing.T, key *Key) JWK {
+	t.Helper()
+	jwk, ok := publicJWK(key)
+	if !ok {
+		t.Fatalf("key %q has no public JWK", key.ID)
+	}
+	return jwk
+}
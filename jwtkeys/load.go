@@ -0,0 +1,175 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Формат файла с ключами:
+//
+//	{
+//	  "signingKey": "2025-06",
+//	  "keys": [
+//	    {"kid": "2025-06", "alg": "EdDSA", "privateKeyFile": "/etc/musicvibe/jwt-2025-06.pem"},
+//	    {"kid": "2025-01", "alg": "RS256", "publicKeyFile": "/etc/musicvibe/jwt-2025-01.pub.pem"},
+//	    {"kid": "legacy", "alg": "HS256", "secret": "..."}
+//	  ]
+//	}
+//
+// Ключи без приватной части используются только для проверки старых токенов.
+type fileConfig struct {
+	SigningKey string      `json:"signingKey"`
+	Keys       []keyConfig `json:"keys"`
+}
+
+type keyConfig struct {
+	ID             string `json:"kid"`
+	Algorithm      string `json:"alg"`
+	Secret         string `json:"secret"`
+	PrivateKeyFile string `json:"privateKeyFile"`
+	PublicKeyFile  string `json:"publicKeyFile"`
+}
+
+// Load читает ключи из файла keysFile, либо использует один HS256 ключ secret.
+// Если не задано ни то, ни другое - генерируется временный ключ; вне development
+// до этого не доходит: config.Validate требует ключ
+func Load(keysFile, secret string) (*KeySet, error) {
+	if keysFile != "" {
+		return LoadFile(keysFile)
+	}
+	if secret != "" {
+		key, err := NewHMACKey("default", []byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySet(key.ID, key)
+	}
+	log.Println("jwtkeys: no keys file or secret configured, using ephemeral key (development only)")
+	return NewEphemeralKeySet()
+}
+
+func LoadFile(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwtkeys: read %s: %w", path, err)
+	}
+
+	var config fileConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("jwtkeys: parse %s: %w", path, err)
+	}
+	if len(config.Keys) == 0 {
+		return nil, errors.New("jwtkeys: no keys configured")
+	}
+
+	keys := make([]*Key, 0, len(config.Keys))
+	for _, kc := range config.Keys {
+		key, err := loadKey(kc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(config.SigningKey, keys...)
+}
+
+func loadKey(kc keyConfig) (*Key, error) {
+	switch kc.Algorithm {
+	case AlgHS256:
+		return NewHMACKey(kc.ID, []byte(kc.Secret))
+
+	case AlgRS256:
+		var private *rsa.PrivateKey
+		var public *rsa.PublicKey
+		if kc.PrivateKeyFile != "" {
+			parsed, err := readPrivateKey(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			rsaKey, ok := parsed.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("jwtkeys: key %q is not an RSA private key", kc.ID)
+			}
+			private = rsaKey
+		} else if kc.PublicKeyFile != "" {
+			parsed, err := readPublicKey(kc.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			rsaKey, ok := parsed.(*rsa.PublicKey)
+			if !ok {
+				return nil, fmt.Errorf("jwtkeys: key %q is not an RSA public key", kc.ID)
+			}
+			public = rsaKey
+		}
+		return NewRSAKey(kc.ID, private, public)
+
+	case AlgEdDSA:
+		var private ed25519.PrivateKey
+		var public ed25519.PublicKey
+		if kc.PrivateKeyFile != "" {
+			parsed, err := readPrivateKey(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			edKey, ok := parsed.(ed25519.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("jwtkeys: key %q is not an Ed25519 private key", kc.ID)
+			}
+			private = edKey
+		} else if kc.PublicKeyFile != "" {
+			parsed, err := readPublicKey(kc.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			edKey, ok := parsed.(ed25519.PublicKey)
+			if !ok {
+				return nil, fmt.Errorf("jwtkeys: key %q is not an Ed25519 public key", kc.ID)
+			}
+			public = edKey
+		}
+		return NewEd25519Key(kc.ID, private, public)
+	}
+	return nil, fmt.Errorf("jwtkeys: key %q has unsupported algorithm %q", kc.ID, kc.Algorithm)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwtkeys: read %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwtkeys: %s is not a PEM file", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+func readPublicKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
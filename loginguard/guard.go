@@ -0,0 +1,193 @@
+package loginguard
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Attempt - состояние неудачных попыток входа по одному ключу (аккаунт или IP)
+type Attempt struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+type AttemptStore interface {
+	Get(ctx context.Context, key string) (Attempt, error)
+	// RecordFailure увеличивает счётчик, lockFor по новому состоянию решает,
+	// до какого момента ключ заблокирован
+	RecordFailure(ctx context.Context, key string, at time.Time, lockFor func(Attempt) time.Time) (Attempt, error)
+	Reset(ctx context.Context, key string) error
+}
+
+type Limits struct {
+	// Сколько ошибок допускается без задержки
+	FreeAttempts int
+	// Задержка растёт как BackoffBase * 2^(n-1), но не больше MaxBackoff
+	BackoffBase time.Duration
+	MaxBackoff  time.Duration
+	// После LockoutThreshold ошибок ключ блокируется на LockoutDuration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+var (
+	DefaultAccountLimits = Limits{
+		FreeAttempts:     3,
+		BackoffBase:      time.Second,
+		MaxBackoff:       time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+	}
+	// Для IP порог выше: за NAT может сидеть много пользователей
+	DefaultIPLimits = Limits{
+		FreeAttempts:     10,
+		BackoffBase:      time.Second,
+		MaxBackoff:       time.Minute,
+		LockoutThreshold: 50,
+		LockoutDuration:  30 * time.Minute,
+	}
+)
+
+// Guard отслеживает неудачные входы по аккаунту и по IP
+type Guard struct {
+	Store         AttemptStore
+	AccountLimits Limits
+	IPLimits      Limits
+	Now           func() time.Time
+}
+
+// Блокировка по результату проверки
+type Verdict struct {
+	RetryAfter time.Duration
+	Locked     bool
+	// Какой ключ сработал: "account" или "ip"
+	Reason string
+}
+
+func (v Verdict) Blocked() bool {
+	return v.RetryAfter > 0
+}
+
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (guard *Guard) now() time.Time {
+	if guard.Now != nil {
+		return guard.Now()
+	}
+	return time.Now()
+}
+
+func (guard *Guard) accountLimits() Limits {
+	if guard.AccountLimits.LockoutThreshold == 0 {
+		return DefaultAccountLimits
+	}
+	return guard.AccountLimits
+}
+
+func (guard *Guard) ipLimits() Limits {
+	if guard.IPLimits.LockoutThreshold == 0 {
+		return DefaultIPLimits
+	}
+	return guard.IPLimits
+}
+
+func (limits Limits) backoff(failures int) time.Duration {
+	if failures <= limits.FreeAttempts {
+		return 0
+	}
+	delay := limits.BackoffBase
+	for i := limits.FreeAttempts + 1; i < failures && delay < limits.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > limits.MaxBackoff {
+		delay = limits.MaxBackoff
+	}
+	return delay
+}
+
+func (limits Limits) retryAfter(attempt Attempt, now time.Time) (time.Duration, bool) {
+	if now.Before(attempt.LockedUntil) {
+		return attempt.LockedUntil.Sub(now), true
+	}
+	if until := attempt.LastFailure.Add(limits.backoff(attempt.Failures)); now.Before(until) {
+		return until.Sub(now), false
+	}
+	return 0, false
+}
+
+// Check вызывается до проверки пароля
+func (guard *Guard) Check(ctx context.Context, account, ip string) (Verdict, error) {
+	now := guard.now()
+
+	accountAttempt, err := guard.Store.Get(ctx, accountKey(account))
+	if err != nil {
+		return Verdict{}, err
+	}
+	if wait, locked := guard.accountLimits().retryAfter(accountAttempt, now); wait > 0 {
+		return Verdict{RetryAfter: wait, Locked: locked, Reason: "account"}, nil
+	}
+
+	ipAttempt, err := guard.Store.Get(ctx, ipKey(ip))
+	if err != nil {
+		return Verdict{}, err
+	}
+	if wait, locked := guard.ipLimits().retryAfter(ipAttempt, now); wait > 0 {
+		return Verdict{RetryAfter: wait, Locked: locked, Reason: "ip"}, nil
+	}
+
+	return Verdict{}, nil
+}
+
+// Failure фиксирует неудачный вход. Возвращает вердикт, если попытка привела к блокировке
+func (guard *Guard) Failure(ctx context.Context, account, ip string) (Verdict, error) {
+	now := guard.now()
+
+	lockFor := func(limits Limits) func(Attempt) time.Time {
+		return func(attempt Attempt) time.Time {
+			if attempt.Failures >= limits.LockoutThreshold {
+				return now.Add(limits.LockoutDuration)
+			}
+			return attempt.LockedUntil
+		}
+	}
+
+	accountLimits := guard.accountLimits()
+	accountAttempt, err := guard.Store.RecordFailure(ctx, accountKey(account), now, lockFor(accountLimits))
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	ipLimits := guard.ipLimits()
+	ipAttempt, err := guard.Store.RecordFailure(ctx, ipKey(ip), now, lockFor(ipLimits))
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	if accountAttempt.Failures == accountLimits.LockoutThreshold {
+		return Verdict{RetryAfter: accountLimits.LockoutDuration, Locked: true, Reason: "account"}, nil
+	}
+	if ipAttempt.Failures == ipLimits.LockoutThreshold {
+		return Verdict{RetryAfter: ipLimits.LockoutDuration, Locked: true, Reason: "ip"}, nil
+	}
+	return Verdict{}, nil
+}
+
+// Success сбрасывает счётчик аккаунта. Счётчик IP не сбрасываем: иначе перебор
+// можно маскировать входами в собственный аккаунт
+func (guard *Guard) Success(ctx context.Context, account string) error {
+	return guard.Store.Reset(ctx, accountKey(account))
+}
+
+// AccountFailures - число неудачных попыток по аккаунту с последнего успешного входа
+func (guard *Guard) AccountFailures(ctx context.Context, account string) (int, error) {
+	attempt, err := guard.Store.Get(ctx, accountKey(account))
+	return attempt.Failures, err
+}
@@ -0,0 +1,160 @@
+package loginguard
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testLimits = Limits{
+	FreeAttempts:     2,
+	BackoffBase:      time.Second,
+	MaxBackoff:       8 * time.Second,
+	LockoutThreshold: 6,
+	LockoutDuration:  time.Hour,
+}
+
+// Часы теста двигаются вручную
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestGuard() (*Guard, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	guard := &Guard{
+		Store:         &MemoryStore{},
+		AccountLimits: testLimits,
+		IPLimits:      Limits{FreeAttempts: 100, BackoffBase: time.Second, MaxBackoff: time.Second, LockoutThreshold: 100, LockoutDuration: time.Hour},
+		Now:           c.Now,
+	}
+	return guard, c
+}
+
+func fail(t *testing.T, guard *Guard, account, ip string, times int) Verdict {
+	t.Helper()
+	var verdict Verdict
+	for i := 0; i < times; i++ {
+		var err error
+		if verdict, err = guard.Failure(context.Background(), account, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return verdict
+}
+
+func check(t *testing.T, guard *Guard, account, ip string) Verdict {
+	t.Helper()
+	verdict, err := guard.Check(context.Background(), account, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verdict
+}
+
+func TestBackoffGrowth(t *testing.T) {
+	for _, tc := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{9, 8 * time.Second},
+	} {
+		if got := testLimits.backoff(tc.failures); got != tc.want {
+			t.Errorf("backoff(%d) = %v, want %v", tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestCheckWaitsForBackoff(t *testing.T) {
+	guard, c := newTestGuard()
+
+	fail(t, guard, "alice", "10.0.0.1", 2)
+	if verdict := check(t, guard, "alice", "10.0.0.1"); verdict.Blocked() {
+		t.Fatalf("blocked within free attempts: %+v", verdict)
+	}
+
+	fail(t, guard, "alice", "10.0.0.1", 2)
+	verdict := check(t, guard, "alice", "10.0.0.1")
+	if verdict.RetryAfter != 2*time.Second || verdict.Locked || verdict.Reason != "account" {
+		t.Fatalf("verdict = %+v, want 2s backoff on account", verdict)
+	}
+
+	c.now = c.now.Add(2 * time.Second)
+	if verdict := check(t, guard, "alice", "10.0.0.1"); verdict.Blocked() {
+		t.Fatalf("still blocked after backoff: %+v", verdict)
+	}
+}
+
+func TestLockoutAtThreshold(t *testing.T) {
+	guard, c := newTestGuard()
+
+	if verdict := fail(t, guard, "alice", "10.0.0.1", testLimits.LockoutThreshold-1); verdict.Locked {
+		t.Fatalf("locked before threshold: %+v", verdict)
+	}
+	verdict := fail(t, guard, "alice", "10.0.0.1", 1)
+	if !verdict.Locked || verdict.RetryAfter != testLimits.LockoutDuration || verdict.Reason != "account" {
+		t.Fatalf("verdict = %+v, want account lockout", verdict)
+	}
+
+	c.now = c.now.Add(testLimits.LockoutDuration - time.Minute)
+	verdict = check(t, guard, "alice", "10.0.0.1")
+	if !verdict.Locked || verdict.RetryAfter != time.Minute {
+		t.Fatalf("verdict = %+v, want a minute of lockout left", verdict)
+	}
+}
+
+func TestLockoutExpires(t *testing.T) {
+	guard, c := newTestGuard()
+
+	fail(t, guard, "alice", "10.0.0.1", testLimits.LockoutThreshold)
+	c.now = c.now.Add(testLimits.LockoutDuration)
+	if verdict := check(t, guard, "alice", "10.0.0.1"); verdict.Blocked() {
+		t.Fatalf("still blocked after lockout expired: %+v", verdict)
+	}
+}
+
+func TestAccountAndIPKeyedIndependently(t *testing.T) {
+	guard, _ := newTestGuard()
+	guard.IPLimits = testLimits
+
+	fail(t, guard, "alice", "10.0.0.1", testLimits.LockoutThreshold)
+
+	if verdict := check(t, guard, "bob", "10.0.0.2"); verdict.Blocked() {
+		t.Fatalf("other account and IP blocked: %+v", verdict)
+	}
+	if verdict := check(t, guard, "bob", "10.0.0.1"); !verdict.Locked || verdict.Reason != "ip" {
+		t.Fatalf("verdict = %+v, want IP lockout", verdict)
+	}
+	if verdict := check(t, guard, " Alice ", "10.0.0.2"); !verdict.Locked || verdict.Reason != "account" {
+		t.Fatalf("verdict = %+v, want account lockout regardless of case and spaces", verdict)
+	}
+}
+
+func TestSuccessResetsAccountOnly(t *testing.T) {
+	guard, _ := newTestGuard()
+	guard.IPLimits = testLimits
+
+	fail(t, guard, "alice", "10.0.0.1", 4)
+	if err := guard.Success(context.Background(), "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err := guard.AccountFailures(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != 0 {
+		t.Errorf("account failures = %d after success, want 0", failures)
+	}
+	if verdict := check(t, guard, "alice", "10.0.0.2"); verdict.Blocked() {
+		t.Errorf("account still blocked after success: %+v", verdict)
+	}
+	if verdict := check(t, guard, "bob", "10.0.0.1"); verdict.Reason != "ip" {
+		t.Errorf("verdict = %+v, want IP backoff to survive success", verdict)
+	}
+}
@@ -0,0 +1,41 @@
+package loginguard
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore хранит попытки в памяти процесса. Подходит для тестов и одного инстанса
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempt
+}
+
+func (store *MemoryStore) Get(ctx context.Context, key string) (Attempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.attempts[key], nil
+}
+
+func (store *MemoryStore) RecordFailure(ctx context.Context, key string, at time.Time, lockFor func(Attempt) time.Time) (Attempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.attempts == nil {
+		store.attempts = make(map[string]Attempt)
+	}
+	attempt := store.attempts[key]
+	attempt.Failures++
+	attempt.LastFailure = at
+	attempt.LockedUntil = lockFor(attempt)
+	store.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (store *MemoryStore) Reset(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.attempts, key)
+	return nil
+}
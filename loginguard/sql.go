@@ -0,0 +1,70 @@
+package loginguard
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SQLStore хранит попытки в таблице login_attempt, общей для всех инстансов
+type SQLStore struct {
+	DB *sql.DB
+}
+
+func (store *SQLStore) Get(ctx context.Context, key string) (Attempt, error) {
+	var attempt Attempt
+	var lockedUntil sql.NullTime
+	err := store.DB.QueryRowContext(ctx, `
+		SELECT failures, last_failure_at, locked_until
+		FROM login_attempt
+		WHERE attempt_key = ?`, key).Scan(&attempt.Failures, &attempt.LastFailure, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return Attempt{}, nil
+	} else if err != nil {
+		return Attempt{}, err
+	}
+	attempt.LockedUntil = lockedUntil.Time
+	return attempt, nil
+}
+
+func (store *SQLStore) RecordFailure(ctx context.Context, key string, at time.Time, lockFor func(Attempt) time.Time) (Attempt, error) {
+	tx, err := store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Attempt{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO login_attempt (attempt_key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON DUPLICATE KEY UPDATE failures = failures + 1, last_failure_at = VALUES(last_failure_at)`, key, at)
+	if err != nil {
+		return Attempt{}, err
+	}
+
+	var attempt Attempt
+	var lockedUntil sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT failures, last_failure_at, locked_until
+		FROM login_attempt
+		WHERE attempt_key = ?
+		FOR UPDATE`, key).Scan(&attempt.Failures, &attempt.LastFailure, &lockedUntil)
+	if err != nil {
+		return Attempt{}, err
+	}
+	attempt.LockedUntil = lockedUntil.Time
+
+	if locked := lockFor(attempt); !locked.Equal(attempt.LockedUntil) {
+		attempt.LockedUntil = locked
+		if _, err := tx.ExecContext(ctx, `UPDATE login_attempt SET locked_until = ? WHERE attempt_key = ?`, locked, key); err != nil {
+			return Attempt{}, err
+		}
+	}
+
+	return attempt, tx.Commit()
+}
+
+func (store *SQLStore) Reset(ctx context.Context, key string) error {
+	_, err := store.DB.ExecContext(ctx, `DELETE FROM login_attempt WHERE attempt_key = ?`, key)
+	return err
+}
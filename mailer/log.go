@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LogMailer ничего не отправляет: пишет письмо в лог и в Dir (если задан).
+// Отправленные письма также доступны через Sent()
+type LogMailer struct {
+	Dir string
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	log.Printf("mailer: to=%s subject=%q\n%s", message.To, message.Subject, message.Body)
+
+	m.mu.Lock()
+	m.sent = append(m.sent, message)
+	m.mu.Unlock()
+
+	if m.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), filepath.Base(message.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), buildMessage("noreply@localhost", message), 0o644)
+}
+
+func (m *LogMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
@@ -0,0 +1,24 @@
+package mailer
+
+import "context"
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer отправляет письма пользователям (подтверждение почты, сброс пароля)
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// New возвращает SMTP-отправку, если задан host, иначе письма пишутся в лог
+// и, при заданном dir, в файлы - для локальной разработки. Вне development
+// config.Validate не пропускает пустой host
+func New(smtp SMTPMailer, dir string) Mailer {
+	if smtp.Host == "" {
+		return &LogMailer{Dir: dir}
+	}
+	return &smtp
+}
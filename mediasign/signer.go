@@ -0,0 +1,153 @@
+// Package mediasign подписывает ссылки на медиафайлы: короткоживущие токены
+// для аудио и долгоживущие подписи для изображений, чтобы их можно было кэшировать.
+package mediasign
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minKeyLength = 32
+	// Подпись изображения меняется раз в окно, поэтому ссылка стабильна и кэшируется
+	imageSignatureWindow = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid media token")
+	ErrExpired      = errors.New("media token expired")
+)
+
+type Signer struct {
+	key []byte
+	// Если больше нуля, аудио отдаётся редиректом на presigned-ссылку MinIO с таким сроком
+	PresignTTL time.Duration
+	Now        func() time.Time
+}
+
+func NewSigner(key []byte) (*Signer, error) {
+	if len(key) < minKeyLength {
+		return nil, fmt.Errorf("mediasign: key must be at least %d bytes", minKeyLength)
+	}
+	return &Signer{key: key}, nil
+}
+
+// Ключ живёт до перезапуска процесса, после чего все выданные ссылки станут недействительны
+func NewEphemeralSigner() *Signer {
+	key := make([]byte, minKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		panic("mediasign: " + err.Error())
+	}
+	return &Signer{key: key}
+}
+
+// Load создаёт подписчик с ключом key; без ключа (только в development,
+// см. config.Validate) используется временный.
+// presignTTL > 0 включает редирект аудио на presigned-ссылки MinIO
+func Load(key string, presignTTL time.Duration) (*Signer, error) {
+	var signer *Signer
+	if key != "" {
+		s, err := NewSigner([]byte(key))
+		if err != nil {
+			return nil, err
+		}
+		signer = s
+	} else {
+		log.Println("mediasign: no signing key configured, using ephemeral key (development only)")
+		signer = NewEphemeralSigner()
+	}
+	signer.PresignTTL = presignTTL
+	return signer, nil
+}
+
+func (s *Signer) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func (s *Signer) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// AudioClaims - кому и на что выдана ссылка на аудио
+type AudioClaims struct {
+	UserID    string
+	TrackID   string
+	Rendition string
+	ExpiresAt time.Time
+}
+
+// SignAudio возвращает токен вида <payload>.<подпись> в base64url
+func (s *Signer) SignAudio(claims AudioClaims) string {
+	payload := strings.Join([]string{"audio", claims.UserID, claims.TrackID, claims.Rendition,
+		strconv.FormatInt(claims.ExpiresAt.Unix(), 10)}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+func (s *Signer) VerifyAudio(token string) (AudioClaims, error) {
+	encodedPayload, encodedMAC, found := strings.Cut(token, ".")
+	if !found {
+		return AudioClaims{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return AudioClaims{}, ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.mac(string(payload))) {
+		return AudioClaims{}, ErrInvalidToken
+	}
+
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 5 || parts[0] != "audio" {
+		return AudioClaims{}, ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(parts[4], 10, 64)
+	if err != nil {
+		return AudioClaims{}, ErrInvalidToken
+	}
+	claims := AudioClaims{UserID: parts[1], TrackID: parts[2], Rendition: parts[3], ExpiresAt: time.Unix(expires, 0)}
+	if !s.now().Before(claims.ExpiresAt) {
+		return claims, ErrExpired
+	}
+	return claims, nil
+}
+
+// SignImage подписывает путь изображения. Срок округляется до окна,
+// так что в течение окна для одного пути выдаётся одна и та же ссылка
+func (s *Signer) SignImage(path string) (expires int64, signature string) {
+	window := int64(imageSignatureWindow / time.Second)
+	expires = (s.now().Unix()/window + 2) * window
+	return expires, s.imageSignature(path, expires)
+}
+
+func (s *Signer) VerifyImage(path, expires, signature string) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.imageSignature(path, exp))) {
+		return ErrInvalidToken
+	}
+	if s.now().Unix() >= exp {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (s *Signer) imageSignature(path string, expires int64) string {
+	return base64.RawURLEncoding.EncodeToString(s.mac("image|" + path + "|" + strconv.FormatInt(expires, 10)))
+}
@@ -0,0 +1,123 @@
+// Package mediaurl превращает пути, сохранённые в БД (обложки, аватары, фоны, аудио),
+// в абсолютные ссылки, которые получают клиенты
+package mediaurl
+
+import (
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Edafi/MusicVibe/mediasign"
+	"github.com/Edafi/MusicVibe/storage"
+)
+
+// Ссылка на аудио действует час: плеер запрашивает трек заново при следующем воспроизведении
+const DefaultAudioTTL = time.Hour
+
+// Единственный формат аудио, который сейчас хранится
+const RenditionMP3 = "mp3"
+
+type Builder struct {
+	baseURL string
+	// Хост CDN для изображений и статики; аудио всегда идёт через API,
+	// потому что ссылка привязана к пользователю и считает прослушивания
+	cdnURL   string
+	bucket   string
+	signer   *mediasign.Signer
+	AudioTTL time.Duration
+	Now      func() time.Time
+}
+
+// cdnURL может быть пустым - тогда изображения тоже отдаются с baseURL
+func New(baseURL, cdnURL, bucket string, signer *mediasign.Signer) *Builder {
+	return &Builder{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		cdnURL:   strings.TrimRight(cdnURL, "/"),
+		bucket:   bucket,
+		signer:   signer,
+		AudioTTL: DefaultAudioTTL,
+	}
+}
+
+func (b *Builder) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
+
+func (b *Builder) imageHost() string {
+	if b.cdnURL != "" {
+		return b.cdnURL
+	}
+	return b.baseURL
+}
+
+// Image принимает любой сохранённый путь к изображению:
+//   - /music/musician_x/cover/album_y.jpg -> подписанная ссылка на /media/image/cover/y
+//   - /avatarUser/defaultAvatar.png (статика) -> хост + путь
+//   - внешняя http(s)-ссылка возвращается как есть
+func (b *Builder) Image(storedPath string) string {
+	switch {
+	case storedPath == "":
+		return ""
+	case strings.HasPrefix(storedPath, "http://"), strings.HasPrefix(storedPath, "https://"):
+		return storedPath
+	case strings.HasPrefix(storedPath, "/"+b.bucket+"/"):
+		if kind, id, ok := b.imageRoute(storedPath); ok {
+			return b.signedImage("/media/image/" + kind + "/" + id)
+		}
+		// Объекты со старой раскладкой ключей отдаются по имени файла
+		return b.signedImage("/media/image/" + path.Base(storedPath))
+	case strings.HasPrefix(storedPath, "/"):
+		return b.imageHost() + storedPath
+	}
+	return b.imageHost() + "/" + storedPath
+}
+
+func (b *Builder) signedImage(routePath string) string {
+	expires, signature := b.signer.SignImage(routePath)
+	query := url.Values{}
+	query.Set("exp", strconv.FormatInt(expires, 10))
+	query.Set("sig", signature)
+	return b.imageHost() + routePath + "?" + query.Encode()
+}
+
+// Audio - ссылка на основной формат трека для пользователя userID.
+// shareToken нужен для треков по ссылке и добавляется, только если не пуст
+func (b *Builder) Audio(userID, trackID, shareToken string) string {
+	return b.AudioRendition(userID, trackID, RenditionMP3, shareToken)
+}
+
+func (b *Builder) AudioRendition(userID, trackID, rendition, shareToken string) string {
+	token := b.signer.SignAudio(mediasign.AudioClaims{
+		UserID:    userID,
+		TrackID:   trackID,
+		Rendition: rendition,
+		ExpiresAt: b.now().Add(b.AudioTTL),
+	})
+	query := url.Values{}
+	query.Set("token", token)
+	if shareToken != "" {
+		query.Set("share", shareToken)
+	}
+	return b.baseURL + "/media/audio/" + url.PathEscape(trackID) + "?" + query.Encode()
+}
+
+// Путь объекта в бакете -> вид изображения для маршрута /media/image/{kind}/{id}
+func (b *Builder) imageRoute(storedPath string) (kind, id string, ok bool) {
+	key, ok := storage.KeyFromStoredPath(b.bucket, storedPath)
+	if !ok {
+		return "", "", false
+	}
+	owner, kind, id, ok := storage.ParseImageKey(key)
+	if !ok {
+		return "", "", false
+	}
+	if owner == "user" {
+		kind = "user-" + kind
+	}
+	return kind, id, true
+}
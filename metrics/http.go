@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// statusRecorder запоминает код ответа для метрик
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(data []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap нужен http.ResponseController
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// HTTPMiddleware считает запросы и их длительность по шаблону маршрута ("/track/{id}"),
+// а не по пути, чтобы число рядов не росло с каждым id
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(request); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: response}
+		started := time.Now()
+		next.ServeHTTP(recorder, request)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		httpDuration.WithLabelValues(route, request.Method).Observe(time.Since(started).Seconds())
+		httpRequests.WithLabelValues(route, request.Method, strconv.Itoa(recorder.status)).Inc()
+	})
+}
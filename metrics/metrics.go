@@ -0,0 +1,130 @@
+// Package metrics собирает метрики Prometheus: HTTP по шаблонам маршрутов, запросы
+// и пул MySQL, операции хранилища, активные прослушивания, загрузки и вызовы ffmpeg/ffprobe.
+// Метрики регистрируются в собственном Registry и отдаются через Handler
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "musicvibe"
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "MySQL statement latency by statement type, until the first result.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+	dbQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Failed MySQL statements by statement type.",
+	}, []string{"operation"})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Media storage operation latency.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+	storageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_errors_total",
+		Help:      "Failed media storage operations; missing objects are not counted.",
+	}, []string{"operation"})
+	storageReadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_read_bytes_total",
+		Help:      "Bytes read from media storage, most of them served to clients.",
+	})
+	storageWrittenBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_written_bytes_total",
+		Help:      "Bytes written to media storage.",
+	})
+
+	// ActiveStreams - запросы, которые сейчас отдают аудио через сервер (без прямых ссылок)
+	ActiveStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_audio_streams",
+		Help:      "Audio responses currently being streamed by the server.",
+	})
+	// UploadsInProgress - загрузки альбомов в обработке. Отдельной очереди нет:
+	// альбом обрабатывается в запросе, поэтому это и есть глубина очереди загрузок
+	UploadsInProgress = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upload_jobs_in_progress",
+		Help:      "Album uploads currently being processed.",
+	})
+
+	commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "external_command_duration_seconds",
+		Help:      "Duration of ffprobe and ffmpeg runs.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"command", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		dbQueryDuration, dbQueryErrors,
+		storageDuration, storageErrors, storageReadBytes, storageWrittenBytes,
+		ActiveStreams, UploadsInProgress,
+		commandDuration,
+	)
+}
+
+// RegisterDB добавляет статистику пула соединений (sql.DB.Stats) под именем name
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveCommand записывает длительность запуска внешней программы
+func ObserveCommand(command string, started time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	commandDuration.WithLabelValues(command, result).Observe(time.Since(started).Seconds())
+}
+
+// Handler отдаёт метрики; с непустым token требует заголовок "Authorization: Bearer <token>"
+func Handler(token string) http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(request.Header.Get("Authorization")), expected) != 1 {
+			http.Error(response, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(response, request)
+	})
+}
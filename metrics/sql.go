@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// OpenMySQL открывает пул MySQL, в котором каждый запрос попадает в db_query_duration_seconds.
+// Обёртка стоит на уровне драйвера, поэтому учитываются и репозитории, и обработчики,
+// которые обращаются к *sql.DB напрямую
+func OpenMySQL(dsn string) (*sql.DB, error) {
+	cfg, err := mysqlConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(&instrumentedConnector{Connector: connector}), nil
+}
+
+// Сессии, токены, защита от перебора и purge читают DATETIME в time.Time, а время
+// из Go пишется в UTC, поэтому эти настройки не зависят от DSN оператора.
+// Текущее время в запросы всегда передаётся из Go параметром, а не берётся
+// из NOW(): часы сервера БД могут расходиться с часами приложения
+func mysqlConfig(dsn string) (*mysql.Config, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	cfg.Params["time_zone"] = "'+00:00'"
+	return cfg, nil
+}
+
+// operation - тип запроса для метки: select, insert, update, delete или other
+func operation(query string) string {
+	verb := strings.TrimSpace(query)
+	if end := strings.IndexFunc(verb, unicode.IsSpace); end > 0 {
+		verb = verb[:end]
+	}
+	switch verb = strings.ToLower(verb); verb {
+	case "select", "insert", "update", "delete":
+		return verb
+	}
+	return "other"
+}
+
+func observeQuery(query string, started time.Time, err error) {
+	// ErrSkip - драйвер просит database/sql выполнить запрос через Prepare, его учтёт stmt
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	op := operation(query)
+	dbQueryDuration.WithLabelValues(op).Observe(time.Since(started).Seconds())
+	if err != nil {
+		dbQueryErrors.WithLabelValues(op).Inc()
+	}
+}
+
+type instrumentedConnector struct {
+	driver.Connector
+}
+
+func (connector *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := connector.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+// instrumentedConn повторяет необязательные интерфейсы соединения mysql,
+// иначе database/sql перестал бы ими пользоваться
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (conn *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return conn.PrepareContext(context.Background(), query)
+}
+
+func (conn *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := conn.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = conn.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, query: query}, nil
+}
+
+func (conn *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := conn.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return conn.Conn.Begin()
+}
+
+func (conn *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := conn.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	started := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	observeQuery(query, started, err)
+	return result, err
+}
+
+func (conn *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := conn.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	started := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	observeQuery(query, started, err)
+	return rows, err
+}
+
+func (conn *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := conn.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (conn *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := conn.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (conn *instrumentedConn) IsValid() bool {
+	if validator, ok := conn.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// Конвертация аргументов остаётся за драйвером (time.Time, []byte, json.RawMessage...)
+func (conn *instrumentedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := conn.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (stmt *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	started := time.Now()
+	var result driver.Result
+	var err error
+	if execer, ok := stmt.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = stmt.Stmt.Exec(plainValues(args))
+	}
+	observeQuery(stmt.query, started, err)
+	return result, err
+}
+
+func (stmt *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	started := time.Now()
+	var rows driver.Rows
+	var err error
+	if queryer, ok := stmt.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = stmt.Stmt.Query(plainValues(args))
+	}
+	observeQuery(stmt.query, started, err)
+	return rows, err
+}
+
+func plainValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMySQLConfigForcesTimeSettings(t *testing.T) {
+	cfg, err := mysqlConfig("app:secret@tcp(db:3306)/music?loc=Local&wait_timeout=600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.ParseTime {
+		t.Error("parseTime is not enabled")
+	}
+	if cfg.Loc != time.UTC {
+		t.Errorf("loc = %v, want UTC", cfg.Loc)
+	}
+	if cfg.Params["time_zone"] != "'+00:00'" {
+		t.Errorf("time_zone = %q", cfg.Params["time_zone"])
+	}
+	if cfg.Params["wait_timeout"] != "600" {
+		t.Errorf("operator params were dropped: %v", cfg.Params)
+	}
+}
+
+func TestOperation(t *testing.T) {
+	cases := map[string]string{
+		"SELECT 1":                        "select",
+		"\n\t\tselect\n\t\tid FROM track": "select",
+		"INSERT INTO track VALUES (?)":    "insert",
+		"UPDATE track SET x = 1":          "update",
+		"DELETE FROM track":               "delete",
+		"SET time_zone = '+00:00'":        "other",
+	}
+	for query, want := range cases {
+		if got := operation(query); got != want {
+			t.Errorf("operation(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/Edafi/MusicVibe/storage"
+)
+
+// InstrumentStore оборачивает хранилище: длительность и ошибки каждой операции,
+// прочитанные и записанные байты
+func InstrumentStore(store storage.BlobStore) storage.BlobStore {
+	return &instrumentedStore{store: store}
+}
+
+type instrumentedStore struct {
+	store storage.BlobStore
+}
+
+var _ storage.BlobStore = (*instrumentedStore)(nil)
+
+func observeStorage(operation string, started time.Time, err error) {
+	storageDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrPresignUnsupported) {
+		storageErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func (s *instrumentedStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	started := time.Now()
+	counter := &countingReader{Reader: r, counter: storageWrittenBytes.Add}
+	err := s.store.Put(ctx, key, counter, size, contentType)
+	observeStorage("put", started, err)
+	return err
+}
+
+func (s *instrumentedStore) Open(ctx context.Context, key string) (storage.Object, error) {
+	started := time.Now()
+	object, err := s.store.Open(ctx, key)
+	observeStorage("open", started, err)
+	if err != nil {
+		return nil, err
+	}
+	return &countingObject{Object: object}, nil
+}
+
+func (s *instrumentedStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	started := time.Now()
+	reader, err := s.store.GetRange(ctx, key, offset, length)
+	observeStorage("get_range", started, err)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReadCloser{ReadCloser: reader}, nil
+}
+
+func (s *instrumentedStore) Stat(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	started := time.Now()
+	info, err := s.store.Stat(ctx, key)
+	observeStorage("stat", started, err)
+	return info, err
+}
+
+func (s *instrumentedStore) Delete(ctx context.Context, key string) error {
+	started := time.Now()
+	err := s.store.Delete(ctx, key)
+	observeStorage("delete", started, err)
+	return err
+}
+
+func (s *instrumentedStore) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	started := time.Now()
+	objects, err := s.store.List(ctx, prefix)
+	observeStorage("list", started, err)
+	return objects, err
+}
+
+func (s *instrumentedStore) Presign(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	started := time.Now()
+	url, err := s.store.Presign(ctx, key, ttl)
+	observeStorage("presign", started, err)
+	return url, err
+}
+
+func (s *instrumentedStore) Ping(ctx context.Context) error {
+	started := time.Now()
+	err := s.store.Ping(ctx)
+	observeStorage("ping", started, err)
+	return err
+}
+
+type countingReader struct {
+	io.Reader
+	counter func(float64)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.counter(float64(n))
+	return n, err
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	storageReadBytes.Add(float64(n))
+	return n, err
+}
+
+// countingObject сохраняет Seek, чтобы http.ServeContent по-прежнему обслуживал Range
+type countingObject struct {
+	storage.Object
+}
+
+func (o *countingObject) Read(p []byte) (int, error) {
+	n, err := o.Object.Read(p)
+	storageReadBytes.Add(float64(n))
+	return n, err
+}
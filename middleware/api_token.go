@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Личные токены доступа отличаются от JWT префиксом
+const APITokenPrefix = "mvp_"
+
+const (
+	AuthMethodSession  = "session"
+	AuthMethodAPIToken = "api_token"
+)
+
+const (
+	ContextAuthMethodKey contextKey = "authMethod"
+	ContextScopesKey     contextKey = "scopes"
+)
+
+type Scope string
+
+const (
+	ScopeReadCatalog  Scope = "read:catalog"
+	ScopeReadLibrary  Scope = "read:library"
+	ScopeWriteLibrary Scope = "write:library"
+	ScopeWriteUpload  Scope = "write:upload"
+	ScopeReadStats    Scope = "read:stats"
+)
+
+var AllScopes = []Scope{ScopeReadCatalog, ScopeReadLibrary, ScopeWriteLibrary, ScopeWriteUpload, ScopeReadStats}
+
+func IsValidScope(scope Scope) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NewAPIToken возвращает токен для пользователя и sha256, который хранится в БД
+func NewAPIToken() (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = APITokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashAPIToken(token), nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type scopedHandler struct {
+	scope Scope
+	next  http.Handler
+}
+
+func (handler scopedHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	handler.next.ServeHTTP(response, request)
+}
+
+// WithScope разрешает вызов маршрута по личному токену с указанным scope.
+// Маршруты без WithScope доступны только с сессионным JWT
+func WithScope(scope Scope, next http.HandlerFunc) http.Handler {
+	return scopedHandler{scope: scope, next: next}
+}
+
+func (auth *Authenticator) serveAPIToken(next http.Handler, response http.ResponseWriter, request *http.Request, token string) {
+	scoped, ok := next.(scopedHandler)
+	if !ok {
+		log.Println("Middleware: API token used for session-only route", request.URL.Path)
+		http.Error(response, "API tokens are not allowed for this endpoint", http.StatusForbidden)
+		return
+	}
+
+	var tokenID, userID, role, scopeList string
+	err := auth.DB.QueryRowContext(request.Context(), `
+		SELECT t.id, t.user_id, u.role, t.scopes
+		FROM api_token t
+		JOIN user u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND t.revoked_at IS NULL
+		  AND (t.expires_at IS NULL OR t.expires_at > ?)`, hashAPIToken(token), time.Now()).Scan(&tokenID, &userID, &role, &scopeList)
+	if err == sql.ErrNoRows {
+		log.Println("Middleware: Invalid API token")
+		http.Error(response, "Invalid token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Println("Middleware: API token lookup error:", err)
+		http.Error(response, "Failed to check token", http.StatusInternalServerError)
+		return
+	}
+
+	scopes := strings.Split(scopeList, ",")
+	granted := false
+	for _, s := range scopes {
+		if Scope(s) == scoped.scope {
+			granted = true
+			break
+		}
+	}
+	if !granted {
+		log.Printf("Middleware: API token %s lacks scope %q", tokenID, scoped.scope)
+		http.Error(response, "Insufficient scope", http.StatusForbidden)
+		return
+	}
+
+	// Не чаще раза в минуту, чтобы не писать в БД на каждый запрос
+	now := time.Now()
+	_, err = auth.DB.ExecContext(request.Context(), `
+		UPDATE api_token SET last_used_at = ?
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)`, now, tokenID, now.Add(-time.Minute))
+	if err != nil {
+		log.Println("Middleware: API token last_used_at error:", err)
+	}
+
+	ctx := context.WithValue(request.Context(), ContextUserIDKey, userID)
+	ctx = context.WithValue(ctx, ContextRoleKey, role)
+	ctx = context.WithValue(ctx, ContextAuthMethodKey, AuthMethodAPIToken)
+	ctx = context.WithValue(ctx, ContextScopesKey, scopes)
+	next.ServeHTTP(response, request.WithContext(ctx))
+}
@@ -2,21 +2,32 @@ package middleware
 
 import (
 	"context"
+	"database/sql"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/Edafi/MusicVibe/jwtkeys"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type contextKey string
 
 const (
-	ContextUserIDKey contextKey = "userID"
-	JWT_SECRET                  = "1111"
+	ContextUserIDKey    contextKey = "userID"
+	ContextRoleKey      contextKey = "role"
+	ContextSessionIDKey contextKey = "sessionID"
 )
 
-func JWTMiddleware(next http.Handler) http.Handler {
+// Authenticator проверяет access-токен и то, что его сессия не отозвана,
+// либо личный токен доступа (см. api_token.go)
+type Authenticator struct {
+	DB   *sql.DB
+	Keys *jwtkeys.KeySet
+}
+
+func (auth *Authenticator) JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
 		authHeader := request.Header.Get("Authorization")
 		if !strings.HasPrefix(authHeader, "Bearer ") {
@@ -26,9 +37,12 @@ func JWTMiddleware(next http.Handler) http.Handler {
 		}
 
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			return []byte(JWT_SECRET), nil
-		})
+		if strings.HasPrefix(tokenStr, APITokenPrefix) {
+			auth.serveAPIToken(next, response, request, tokenStr)
+			return
+		}
+
+		token, err := auth.Keys.Parse(tokenStr, jwt.MapClaims{})
 		if err != nil || !token.Valid {
 			log.Println("Middleware: Missing or invalid Authorization header")
 			http.Error(response, "Invalid token", http.StatusUnauthorized)
@@ -49,7 +63,44 @@ func JWTMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Токены без роли считаем обычными пользователями
+		role, _ := claims["role"].(string)
+		if role == "" {
+			role = RoleUser
+		}
+		if !IsValidRole(role) {
+			log.Println("Middleware: Invalid role:", role)
+			http.Error(response, "Invalid role", http.StatusUnauthorized)
+			return
+		}
+
+		sessionID, ok := claims["sid"].(string)
+		if !ok || sessionID == "" {
+			log.Println("Middleware: Token without session")
+			http.Error(response, "Invalid session", http.StatusUnauthorized)
+			return
+		}
+
+		var active bool
+		err = auth.DB.QueryRowContext(request.Context(), `
+			SELECT revoked_at IS NULL AND expires_at > ?
+			FROM user_session
+			WHERE id = ? AND user_id = ?`, time.Now(), sessionID, userID).Scan(&active)
+		if err != nil && err != sql.ErrNoRows {
+			log.Println("Middleware: Session lookup error:", err)
+			http.Error(response, "Failed to check session", http.StatusInternalServerError)
+			return
+		}
+		if !active {
+			log.Println("Middleware: Session revoked or expired:", sessionID)
+			http.Error(response, "Session revoked", http.StatusUnauthorized)
+			return
+		}
+
 		ctx := context.WithValue(request.Context(), ContextUserIDKey, userID)
+		ctx = context.WithValue(ctx, ContextRoleKey, role)
+		ctx = context.WithValue(ctx, ContextSessionIDKey, sessionID)
+		ctx = context.WithValue(ctx, ContextAuthMethodKey, AuthMethodSession)
 		next.ServeHTTP(response, request.WithContext(ctx))
 	})
 }
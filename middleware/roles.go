@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+)
+
+// Роли пользователей, хранятся в колонке user.role и в claim "role" токена
+const (
+	RoleUser      = "user"
+	RoleMusician  = "musician"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+type Permission string
+
+const (
+	PermissionManageUsers   Permission = "users:manage"
+	PermissionManageStorage Permission = "storage:manage"
+	// Загрузка альбомов, правка и удаление своих альбомов и треков
+	PermissionPublishCatalog Permission = "catalog:publish"
+	// Удаление чужих комментариев
+	PermissionModerateComments Permission = "comments:moderate"
+)
+
+// Роль musician пользователь получает, создав первый профиль музыканта (POST /artists)
+var rolePermissions = map[string][]Permission{
+	RoleUser:      {},
+	RoleMusician:  {PermissionPublishCatalog},
+	RoleModerator: {PermissionModerateComments},
+	RoleAdmin:     {PermissionManageUsers, PermissionManageStorage, PermissionPublishCatalog, PermissionModerateComments},
+}
+
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func HasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission пропускает запрос дальше только если роль из контекста
+// (её кладёт JWTMiddleware) имеет указанное право. На маршрутах для API-токенов
+// оборачивается в WithScope, а не наоборот: JWTMiddleware ищет scope у самого обработчика
+func RequirePermission(permission Permission, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		role, ok := request.Context().Value(ContextRoleKey).(string)
+		if !ok || role == "" {
+			log.Println("Middleware: role not found in context")
+			http.Error(response, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !HasPermission(role, permission) {
+			log.Printf("Middleware: role %q has no permission %q", role, permission)
+			http.Error(response, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(response, request)
+	})
+}
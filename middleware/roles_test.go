@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRolePermissions(t *testing.T) {
+	for _, tc := range []struct {
+		role       string
+		permission Permission
+		want       bool
+	}{
+		{RoleUser, PermissionPublishCatalog, false},
+		{RoleMusician, PermissionPublishCatalog, true},
+		{RoleMusician, PermissionModerateComments, false},
+		{RoleModerator, PermissionModerateComments, true},
+		{RoleModerator, PermissionPublishCatalog, false},
+		{RoleModerator, PermissionManageUsers, false},
+		{RoleAdmin, PermissionPublishCatalog, true},
+		{RoleAdmin, PermissionModerateComments, true},
+		{"unknown", PermissionPublishCatalog, false},
+	} {
+		if got := HasPermission(tc.role, tc.permission); got != tc.want {
+			t.Errorf("HasPermission(%q, %q) = %v, want %v", tc.role, tc.permission, got, tc.want)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	ok := func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusNoContent)
+	}
+	handler := RequirePermission(PermissionPublishCatalog, ok)
+
+	for _, tc := range []struct {
+		role string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{RoleUser, http.StatusForbidden},
+		{RoleMusician, http.StatusNoContent},
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/upload/album", nil)
+		if tc.role != "" {
+			request = request.WithContext(context.WithValue(request.Context(), ContextRoleKey, tc.role))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != tc.want {
+			t.Errorf("role %q: status = %d, want %d", tc.role, recorder.Code, tc.want)
+		}
+	}
+}
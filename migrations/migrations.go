@@ -0,0 +1,253 @@
+// Package migrations применяет версионированные SQL-миграции из каталога sql/,
+// встроенного в бинарник, и создаёт индексы MongoDB.
+//
+// Файл миграции называется NNNN_описание.sql. Операторы разделяются точкой с запятой
+// в конце строки, строки-комментарии начинаются с "--". DDL в MySQL не откатывается,
+// поэтому операторы пишутся так, чтобы повторный запуск после сбоя был безопасен:
+// IF NOT EXISTS, а где его нет (ALTER TABLE ADD COLUMN) - проверка по information_schema
+// и PREPARE, см. 0004. Все операторы выполняются на одном соединении, так что переменные
+// сессии (@ddl) между ними сохраняются. Применённые версии и контрольные суммы хранятся в schema_migrations
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Одновременно миграции выполняет только один экземпляр сервера
+const lockName = "musicvibe_schema_migrations"
+
+const lockTimeoutSeconds = 60
+
+type Migration struct {
+	Version  int
+	Name     string
+	SQL      string
+	Checksum string
+}
+
+// Statements разбивает текст миграции на отдельные операторы
+func (migration Migration) Statements() []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(migration.SQL, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// Load читает встроенные миграции, упорядоченные по версии
+func Load() ([]Migration, error) {
+	entries, err := files.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrations: bad file name %q, want NNNN_name.sql", entry.Name())
+		}
+		if other, exists := seen[version]; exists {
+			return nil, fmt.Errorf("migrations: version %d is used by both %s and %s", version, other, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		data, err := files.ReadFile(path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     name,
+			SQL:      string(data),
+			Checksum: fmt.Sprintf("%x", sha256.Sum256(data)),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// AppliedMigration - запись из schema_migrations
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// New загружает встроенные миграции
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// Applied возвращает применённые версии. Если schema_migrations ещё нет, список пуст
+func (migrator *Migrator) Applied(ctx context.Context) (map[int]AppliedMigration, error) {
+	return appliedMigrations(ctx, migrator.DB)
+}
+
+// Общее у *sql.DB и *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func appliedMigrations(ctx context.Context, db queryer) (map[int]AppliedMigration, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1146 {
+		return map[int]AppliedMigration{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]AppliedMigration)
+	for rows.Next() {
+		var migration AppliedMigration
+		if err := rows.Scan(&migration.Version, &migration.Name, &migration.Checksum, &migration.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[migration.Version] = migration
+	}
+	return applied, rows.Err()
+}
+
+// pending сверяет применённые миграции с встроенными и возвращает ещё не применённые
+func (migrator *Migrator) pending(applied map[int]AppliedMigration) ([]Migration, error) {
+	var pending []Migration
+	for _, migration := range migrator.Migrations {
+		record, ok := applied[migration.Version]
+		if !ok {
+			pending = append(pending, migration)
+			continue
+		}
+		if record.Checksum != migration.Checksum {
+			return nil, fmt.Errorf("migrations: %s was modified after it was applied; add a new migration instead", migration.Name)
+		}
+	}
+	return pending, nil
+}
+
+// Pending возвращает миграции, которые ещё не применены
+func (migrator *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := migrator.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.pending(applied)
+}
+
+// Up применяет все ожидающие миграции по порядку и возвращает применённые.
+// При dryRun только выводит в лог, что было бы выполнено, и ничего не меняет
+func (migrator *Migrator) Up(ctx context.Context, dryRun bool) ([]Migration, error) {
+	if dryRun {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, migration := range pending {
+			log.Printf("migrations: would apply %s", migration.Name)
+			for _, statement := range migration.Statements() {
+				log.Printf("migrations:   %s;", statement)
+			}
+		}
+		return pending, nil
+	}
+
+	// Блокировка GET_LOCK принадлежит соединению, поэтому всё выполняется на одном conn
+	conn, err := migrator.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, lockName, lockTimeoutSeconds).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return nil, errors.New("migrations: timed out waiting for another instance to finish migrating")
+	}
+	defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, lockName)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INT          NOT NULL,
+			name       VARCHAR(255) NOT NULL,
+			checksum   CHAR(64)     NOT NULL,
+			applied_at DATETIME     NOT NULL,
+			PRIMARY KEY (version)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Список перечитывается под блокировкой: другой экземпляр мог успеть всё применить
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := migrator.pending(applied)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0, len(pending))
+	for _, migration := range pending {
+		for i, statement := range migration.Statements() {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return done, fmt.Errorf("migrations: %s, statement %d: %w", migration.Name, i+1, err)
+			}
+		}
+		_, err := conn.ExecContext(ctx, `
+			INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+			migration.Version, migration.Name, migration.Checksum, time.Now())
+		if err != nil {
+			return done, err
+		}
+		log.Printf("migrations: applied %s", migration.Name)
+		done = append(done, migration)
+	}
+	return done, nil
+}
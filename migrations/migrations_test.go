@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadOrdersMigrations(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Fatalf("migration %d has version %d, want %d", i, migration.Version, i+1)
+		}
+	}
+}
+
+// Проверка по information_schema занимает несколько строк и не должна разрываться
+func TestStatementsKeepGuardedAlterIntact(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var guarded []string
+	for _, statement := range migrations[3].Statements() {
+		if strings.HasPrefix(statement, "SET @ddl") {
+			guarded = append(guarded, statement)
+		}
+	}
+	if len(guarded) != 3 {
+		t.Fatalf("got %d guarded ALTER statements, want 3", len(guarded))
+	}
+	for _, statement := range guarded {
+		if !strings.Contains(statement, "information_schema.COLUMNS") || !strings.HasSuffix(statement, "'DO 0')") {
+			t.Errorf("statement split in the middle:\n%s", statement)
+		}
+	}
+}
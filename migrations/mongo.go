@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoIndex struct {
+	Collection string
+	Model      mongo.IndexModel
+}
+
+// Индексы под запросы обработчиков: комментарии трека от новых к старым и комментарии автора
+var mongoIndexes = []mongoIndex{
+	{
+		Collection: "track_comments",
+		Model: mongo.IndexModel{
+			Keys:    bson.D{{Key: "track_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("track_id_created_at"),
+		},
+	},
+	{
+		Collection: "track_comments",
+		Model: mongo.IndexModel{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("user_id"),
+		},
+	},
+}
+
+// EnsureMongoIndexes создаёт недостающие индексы. Создание существующего индекса
+// с тем же описанием ничего не меняет, поэтому запускать можно при каждом старте
+func EnsureMongoIndexes(ctx context.Context, db *mongo.Database, dryRun bool) error {
+	for _, index := range mongoIndexes {
+		name := *index.Model.Options.Name
+		if dryRun {
+			log.Printf("migrations: would ensure index %s.%s", index.Collection, name)
+			continue
+		}
+		if _, err := db.Collection(index.Collection).Indexes().CreateOne(ctx, index.Model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+-- Пользователи, музыканты, альбомы, треки и справочники.
+-- IF NOT EXISTS позволяет принять эту миграцию на базе, созданной до появления миграций
+
+CREATE TABLE IF NOT EXISTS user (
+    id                 CHAR(36)     NOT NULL,
+    username           VARCHAR(64)  NOT NULL,
+    email              VARCHAR(255) NOT NULL,
+    passwd_hash        VARCHAR(255) NOT NULL,
+    role               VARCHAR(20)  NOT NULL DEFAULT 'user',
+    has_complete_setup BOOLEAN      NOT NULL DEFAULT FALSE,
+    email_verified     BOOLEAN      NOT NULL DEFAULT FALSE,
+    avatar_path        VARCHAR(512) NOT NULL DEFAULT '',
+    background_path    VARCHAR(512) NOT NULL DEFAULT '',
+    description        TEXT,
+    creation_date      DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_user_email (email),
+    UNIQUE KEY uq_user_username (username)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS genre (
+    id   INT         NOT NULL AUTO_INCREMENT,
+    name VARCHAR(64) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_genre_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS user_genre (
+    user_id  CHAR(36) NOT NULL,
+    genre_id INT      NOT NULL,
+    PRIMARY KEY (user_id, genre_id),
+    KEY idx_user_genre_genre (genre_id),
+    CONSTRAINT fk_user_genre_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_genre_genre FOREIGN KEY (genre_id) REFERENCES genre (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS musician (
+    id              CHAR(36)     NOT NULL,
+    user_id         CHAR(36)     NOT NULL,
+    name            VARCHAR(128) NOT NULL,
+    name_lower      VARCHAR(128) NOT NULL,
+    avatar_path     VARCHAR(512) NOT NULL DEFAULT '',
+    background_path VARCHAR(512),
+    description     TEXT,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_musician_user (user_id),
+    UNIQUE KEY uq_musician_name_lower (name_lower),
+    CONSTRAINT fk_musician_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS musician_genre (
+    musician_id CHAR(36) NOT NULL,
+    genre_id    INT      NOT NULL,
+    PRIMARY KEY (musician_id, genre_id),
+    KEY idx_musician_genre_genre (genre_id),
+    CONSTRAINT fk_musician_genre_musician FOREIGN KEY (musician_id) REFERENCES musician (id) ON DELETE CASCADE,
+    CONSTRAINT fk_musician_genre_genre FOREIGN KEY (genre_id) REFERENCES genre (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS album (
+    id           CHAR(36)     NOT NULL,
+    musician_id  CHAR(36)     NOT NULL,
+    genre_id     INT          NOT NULL,
+    title        VARCHAR(255) NOT NULL,
+    title_lower  VARCHAR(255) NOT NULL,
+    release_date DATE         NOT NULL,
+    cover_path   VARCHAR(512) NOT NULL DEFAULT '',
+    description  TEXT,
+    PRIMARY KEY (id),
+    KEY idx_album_musician (musician_id),
+    KEY idx_album_genre (genre_id),
+    KEY idx_album_release_date (release_date),
+    CONSTRAINT fk_album_musician FOREIGN KEY (musician_id) REFERENCES musician (id) ON DELETE CASCADE,
+    CONSTRAINT fk_album_genre FOREIGN KEY (genre_id) REFERENCES genre (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- visibility и release_at описаны в handlers/visibility.go, share_token - секрет ссылки для unlisted
+CREATE TABLE IF NOT EXISTS track (
+    id           CHAR(36)     NOT NULL,
+    album_id     CHAR(36)     NOT NULL,
+    musician_id  CHAR(36)     NOT NULL,
+    genre_id     INT          NOT NULL,
+    title        VARCHAR(255) NOT NULL,
+    title_lower  VARCHAR(255) NOT NULL,
+    file_path    VARCHAR(512) NOT NULL,
+    duration     INT          NOT NULL DEFAULT 0,
+    stream_count INT          NOT NULL DEFAULT 0,
+    visibility   ENUM('public', 'unlisted', 'private', 'scheduled') NOT NULL DEFAULT 'public',
+    release_at   DATETIME,
+    share_token  VARCHAR(64),
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_track_share_token (share_token),
+    KEY idx_track_album (album_id),
+    KEY idx_track_musician (musician_id),
+    KEY idx_track_genre (genre_id),
+    KEY idx_track_visibility_streams (visibility, stream_count),
+    KEY idx_track_scheduled (visibility, release_at),
+    KEY idx_track_title_lower (title_lower),
+    CONSTRAINT fk_track_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE,
+    CONSTRAINT fk_track_musician FOREIGN KEY (musician_id) REFERENCES musician (id) ON DELETE CASCADE,
+    CONSTRAINT fk_track_genre FOREIGN KEY (genre_id) REFERENCES genre (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS liked_tracks (
+    user_id  CHAR(36) NOT NULL,
+    track_id CHAR(36) NOT NULL,
+    PRIMARY KEY (user_id, track_id),
+    KEY idx_liked_tracks_track (track_id),
+    CONSTRAINT fk_liked_tracks_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
+    CONSTRAINT fk_liked_tracks_track FOREIGN KEY (track_id) REFERENCES track (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS liked_albums (
+    user_id  CHAR(36) NOT NULL,
+    album_id CHAR(36) NOT NULL,
+    PRIMARY KEY (user_id, album_id),
+    KEY idx_liked_albums_album (album_id),
+    CONSTRAINT fk_liked_albums_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
+    CONSTRAINT fk_liked_albums_album FOREIGN KEY (album_id) REFERENCES album (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS user_following (
+    user_id     CHAR(36) NOT NULL,
+    musician_id CHAR(36) NOT NULL,
+    PRIMARY KEY (user_id, musician_id),
+    KEY idx_user_following_musician (musician_id),
+    CONSTRAINT fk_user_following_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_following_musician FOREIGN KEY (musician_id) REFERENCES musician (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS social_network (
+    id   INT         NOT NULL AUTO_INCREMENT,
+    name VARCHAR(64) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_social_network_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS user_social_network (
+    user_id           CHAR(36)     NOT NULL,
+    social_network_id INT          NOT NULL,
+    profile_url       VARCHAR(512) NOT NULL,
+    PRIMARY KEY (user_id, social_network_id),
+    CONSTRAINT fk_user_social_network_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_social_network_network FOREIGN KEY (social_network_id) REFERENCES social_network (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS playlist (
+    id         CHAR(36)     NOT NULL,
+    user_id    CHAR(36)     NOT NULL,
+    title      VARCHAR(255) NOT NULL,
+    created_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_playlist_user (user_id),
+    CONSTRAINT fk_playlist_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS track_playlist (
+    playlist_id CHAR(36) NOT NULL,
+    track_id    CHAR(36) NOT NULL,
+    position    INT      NOT NULL DEFAULT 0,
+    PRIMARY KEY (playlist_id, track_id),
+    KEY idx_track_playlist_track (track_id),
+    CONSTRAINT fk_track_playlist_playlist FOREIGN KEY (playlist_id) REFERENCES playlist (id) ON DELETE CASCADE,
+    CONSTRAINT fk_track_playlist_track FOREIGN KEY (track_id) REFERENCES track (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
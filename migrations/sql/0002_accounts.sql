@@ -0,0 +1,60 @@
+-- Сессии, одноразовые токены, двухфакторная аутентификация и вход через OIDC
+
+CREATE TABLE IF NOT EXISTS user_session (
+    id                 CHAR(36)     NOT NULL,
+    user_id            CHAR(36)     NOT NULL,
+    refresh_token_hash CHAR(64)     NOT NULL,
+    device_name        VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address         VARCHAR(64)  NOT NULL DEFAULT '',
+    created_at         DATETIME     NOT NULL,
+    last_used_at       DATETIME     NOT NULL,
+    expires_at         DATETIME     NOT NULL,
+    revoked_at         DATETIME,
+    PRIMARY KEY (id),
+    KEY idx_user_session_user (user_id, revoked_at),
+    CONSTRAINT fk_user_session_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Подтверждение почты и сброс пароля; purpose различает назначение токена
+CREATE TABLE IF NOT EXISTS user_token (
+    token_hash CHAR(64)    NOT NULL,
+    user_id    CHAR(36)    NOT NULL,
+    purpose    VARCHAR(32) NOT NULL,
+    created_at DATETIME    NOT NULL,
+    expires_at DATETIME    NOT NULL,
+    used_at    DATETIME,
+    PRIMARY KEY (token_hash),
+    KEY idx_user_token_user (user_id, purpose),
+    CONSTRAINT fk_user_token_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- confirmed_at пуст, пока пользователь не подтвердил первый код
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id        CHAR(36)    NOT NULL,
+    secret         VARCHAR(64) NOT NULL,
+    last_used_step BIGINT      NOT NULL DEFAULT 0,
+    created_at     DATETIME    NOT NULL,
+    confirmed_at   DATETIME,
+    PRIMARY KEY (user_id),
+    CONSTRAINT fk_user_totp_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS user_recovery_code (
+    user_id    CHAR(36) NOT NULL,
+    code_hash  CHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL,
+    used_at    DATETIME,
+    PRIMARY KEY (user_id, code_hash),
+    CONSTRAINT fk_user_recovery_code_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS user_identity (
+    provider   VARCHAR(64)  NOT NULL,
+    subject    VARCHAR(255) NOT NULL,
+    user_id    CHAR(36)     NOT NULL,
+    email      VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME     NOT NULL,
+    PRIMARY KEY (provider, subject),
+    KEY idx_user_identity_user (user_id),
+    CONSTRAINT fk_user_identity_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,39 @@
+-- Ограничение попыток входа, журнал аудита и личные токены доступа
+
+CREATE TABLE IF NOT EXISTS login_attempt (
+    attempt_key     VARCHAR(255) NOT NULL,
+    failures        INT          NOT NULL DEFAULT 0,
+    last_failure_at DATETIME     NOT NULL,
+    locked_until    DATETIME,
+    PRIMARY KEY (attempt_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Без внешнего ключа на user: записи аудита переживают удаление пользователя
+CREATE TABLE IF NOT EXISTS audit_log (
+    id         BIGINT      NOT NULL AUTO_INCREMENT,
+    event_type VARCHAR(64) NOT NULL,
+    user_id    CHAR(36),
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    details    JSON,
+    created_at DATETIME    NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_audit_log_user (user_id, created_at),
+    KEY idx_audit_log_type (event_type, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- scopes - список через запятую, см. middleware/api_token.go
+CREATE TABLE IF NOT EXISTS api_token (
+    id           CHAR(36)     NOT NULL,
+    user_id      CHAR(36)     NOT NULL,
+    name         VARCHAR(128) NOT NULL,
+    token_hash   CHAR(64)     NOT NULL,
+    scopes       VARCHAR(512) NOT NULL DEFAULT '',
+    created_at   DATETIME     NOT NULL,
+    expires_at   DATETIME,
+    last_used_at DATETIME,
+    revoked_at   DATETIME,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_api_token_hash (token_hash),
+    KEY idx_api_token_user (user_id, revoked_at),
+    CONSTRAINT fk_api_token_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,55 @@
+-- Журнал прослушиваний, недельный чарт и мягкое удаление альбомов и треков
+
+-- Одна строка на прослушивание, засчитанное в /media/audio
+CREATE TABLE IF NOT EXISTS track_stream (
+    id          BIGINT   NOT NULL AUTO_INCREMENT,
+    track_id    CHAR(36) NOT NULL,
+    user_id     CHAR(36),
+    streamed_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_track_stream_track (track_id),
+    KEY idx_track_stream_time (streamed_at, track_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Прослушивания, набранные до появления журнала: stream_count = imported_stream_count + строки журнала.
+-- У ALTER TABLE ADD COLUMN нет IF NOT EXISTS, поэтому колонка добавляется, только если её ещё нет
+SET @ddl = IF(
+    (SELECT COUNT(*) FROM information_schema.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'track' AND COLUMN_NAME = 'imported_stream_count') = 0,
+    'ALTER TABLE track ADD COLUMN imported_stream_count INT NOT NULL DEFAULT 0',
+    'DO 0');
+PREPARE ddl FROM @ddl;
+EXECUTE ddl;
+DEALLOCATE PREPARE ddl;
+
+UPDATE track SET imported_stream_count = stream_count;
+
+-- Пересчитывается командой recompute-charts
+CREATE TABLE IF NOT EXISTS track_chart (
+    position    INT      NOT NULL,
+    track_id    CHAR(36) NOT NULL,
+    plays       INT      NOT NULL,
+    computed_at DATETIME NOT NULL,
+    PRIMARY KEY (position),
+    KEY idx_track_chart_track (track_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Удалённые владельцем альбомы и треки скрыты, а окончательно удаляются через purge.retention.
+-- Колонка и индекс добавляются одним ALTER, поэтому достаточно проверить колонку
+SET @ddl = IF(
+    (SELECT COUNT(*) FROM information_schema.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'album' AND COLUMN_NAME = 'deleted_at') = 0,
+    'ALTER TABLE album ADD COLUMN deleted_at DATETIME, ADD KEY idx_album_deleted_at (deleted_at)',
+    'DO 0');
+PREPARE ddl FROM @ddl;
+EXECUTE ddl;
+DEALLOCATE PREPARE ddl;
+
+SET @ddl = IF(
+    (SELECT COUNT(*) FROM information_schema.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'track' AND COLUMN_NAME = 'deleted_at') = 0,
+    'ALTER TABLE track ADD COLUMN deleted_at DATETIME, ADD KEY idx_track_deleted_at (deleted_at)',
+    'DO 0');
+PREPARE ddl FROM @ddl;
+EXECUTE ddl;
+DEALLOCATE PREPARE ddl;
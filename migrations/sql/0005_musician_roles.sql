@@ -0,0 +1,4 @@
+-- Загрузка и правка каталога требуют роли musician. Владельцы профилей музыкантов,
+-- зарегистрированные раньше, получают её здесь (повторный запуск ничего не меняет)
+UPDATE user SET role = 'musician'
+WHERE role = 'user' AND id IN (SELECT user_id FROM musician);
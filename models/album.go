@@ -21,13 +21,13 @@ type RecommendedAlbum struct {
 }
 
 type AlbumPageResponse struct {
-	ID              string `json:"id"`
-	Title           string `json:"title"`
-	Year            int    `json:"year"`
-	CoverURL        string `json:"coverUrl"`
-	Tracks          []int  `json:"tracks"`
-	Description     string `json:"description"`
-	ArtistID        string `json:"artistId"`
-	ArtistName      string `json:"artistName"`
-	ArtistAvatarURL string `json:"artistAvatarUrl"`
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Year            int      `json:"year"`
+	CoverURL        string   `json:"coverUrl"`
+	Tracks          []string `json:"tracks"`
+	Description     string   `json:"description"`
+	ArtistID        string   `json:"artistId"`
+	ArtistName      string   `json:"artistName"`
+	ArtistAvatarURL string   `json:"artistAvatarUrl"`
 }
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type TrackResponse struct {
 	ID         string `json:"id"`
 	Title      string `json:"title"`
@@ -10,4 +12,7 @@ type TrackResponse struct {
 	Duration   int    `json:"duration"`
 	Plays      int    `json:"plays"`
 	Visibility string `json:"visibility"`
+	// Заполняются только для владельца трека
+	ReleaseAt  *time.Time `json:"releaseAt,omitempty"`
+	ShareToken string     `json:"shareToken,omitempty"`
 }
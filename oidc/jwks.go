@@ -0,0 +1,68 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+func (set jwkSet) publicKeys() (map[string]interface{}, error) {
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		switch key.KeyType {
+		case "RSA":
+			n, err := decodeBigInt(key.N)
+			if err != nil {
+				return nil, fmt.Errorf("oidc: bad RSA key %q: %w", key.KeyID, err)
+			}
+			e, err := decodeBigInt(key.E)
+			if err != nil {
+				return nil, fmt.Errorf("oidc: bad RSA key %q: %w", key.KeyID, err)
+			}
+			keys[key.KeyID] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			if key.Curve != "P-256" {
+				continue
+			}
+			x, err := decodeBigInt(key.X)
+			if err != nil {
+				return nil, fmt.Errorf("oidc: bad EC key %q: %w", key.KeyID, err)
+			}
+			y, err := decodeBigInt(key.Y)
+			if err != nil {
+				return nil, fmt.Errorf("oidc: bad EC key %q: %w", key.KeyID, err)
+			}
+			keys[key.KeyID] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		}
+	}
+	return keys, nil
+}
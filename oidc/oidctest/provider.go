@@ -0,0 +1,195 @@
+// Package oidctest - локальный OpenID Connect провайдер для интеграционных
+// проверок логина: discovery, JWKS, authorize с автоподтверждением и token с PKCE.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Edafi/MusicVibe/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "oidctest"
+
+type authRequest struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// Provider "логинит" одного пользователя, описанного полями Subject/Email/...
+type Provider struct {
+	Server   *httptest.Server
+	ClientID string
+
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]authRequest
+}
+
+func NewProvider(clientID string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	provider := &Provider{
+		ClientID:      clientID,
+		Subject:       "user-1",
+		Email:         "user@example.com",
+		EmailVerified: true,
+		Name:          "Test User",
+		key:           key,
+		codes:         make(map[string]authRequest),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.discovery)
+	mux.HandleFunc("/jwks", provider.jwks)
+	mux.HandleFunc("/authorize", provider.authorize)
+	mux.HandleFunc("/token", provider.token)
+	provider.Server = httptest.NewServer(mux)
+	return provider, nil
+}
+
+func (provider *Provider) Issuer() string {
+	return provider.Server.URL
+}
+
+// Config - настройки для oidc.Registry, указывающие на этот провайдер
+func (provider *Provider) Config(name, redirectURL string) oidc.ProviderConfig {
+	return oidc.ProviderConfig{
+		Name:        name,
+		Issuer:      provider.Issuer(),
+		ClientID:    provider.ClientID,
+		RedirectURL: redirectURL,
+	}
+}
+
+func (provider *Provider) Close() {
+	provider.Server.Close()
+}
+
+func writeJSON(response http.ResponseWriter, value interface{}) {
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(value)
+}
+
+func (provider *Provider) discovery(response http.ResponseWriter, request *http.Request) {
+	writeJSON(response, map[string]string{
+		"issuer":                 provider.Issuer(),
+		"authorization_endpoint": provider.Issuer() + "/authorize",
+		"token_endpoint":         provider.Issuer() + "/token",
+		"jwks_uri":               provider.Issuer() + "/jwks",
+	})
+}
+
+func (provider *Provider) jwks(response http.ResponseWriter, request *http.Request) {
+	public := provider.key.PublicKey
+	writeJSON(response, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize сразу "одобряет" вход и возвращает пользователя на redirect_uri
+func (provider *Provider) authorize(response http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if query.Get("client_id") != provider.ClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(response, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		http.Error(response, "server_error", http.StatusInternalServerError)
+		return
+	}
+	provider.mu.Lock()
+	provider.codes[code] = authRequest{
+		clientID:      query.Get("client_id"),
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	provider.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(response, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(response, request, redirect.String(), http.StatusFound)
+}
+
+func (provider *Provider) token(response http.ResponseWriter, request *http.Request) {
+	if err := request.ParseForm(); err != nil {
+		http.Error(response, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := request.PostForm.Get("code")
+	provider.mu.Lock()
+	auth, ok := provider.codes[code]
+	delete(provider.codes, code)
+	provider.mu.Unlock()
+
+	if !ok || request.PostForm.Get("grant_type") != "authorization_code" ||
+		request.PostForm.Get("client_id") != auth.clientID ||
+		request.PostForm.Get("redirect_uri") != auth.redirectURI ||
+		oidc.PKCEChallenge(request.PostForm.Get("code_verifier")) != auth.codeChallenge {
+		http.Error(response, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+
+	claims := oidc.IDTokenClaims{
+		Email:         provider.Email,
+		EmailVerified: provider.EmailVerified,
+		Name:          provider.Name,
+		Nonce:         auth.nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    provider.Issuer(),
+			Subject:   provider.Subject,
+			Audience:  jwt.ClaimStrings{auth.clientID},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(provider.key)
+	if err != nil {
+		http.Error(response, "server_error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(response, map[string]string{
+		"access_token": "oidctest-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
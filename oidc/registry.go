@@ -0,0 +1,81 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Registry лениво выполняет discovery: недоступность одного провайдера
+// при старте не должна мешать запуску сервиса
+type Registry struct {
+	Client  *http.Client
+	configs map[string]ProviderConfig
+
+	mu        sync.Mutex
+	providers map[string]*Provider
+}
+
+func NewRegistry(configs []ProviderConfig) (*Registry, error) {
+	registry := &Registry{
+		configs:   make(map[string]ProviderConfig, len(configs)),
+		providers: make(map[string]*Provider),
+	}
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc: provider %q: name, issuer, clientId and redirectUrl are required", config.Name)
+		}
+		if _, exists := registry.configs[config.Name]; exists {
+			return nil, fmt.Errorf("oidc: duplicate provider %q", config.Name)
+		}
+		registry.configs[config.Name] = config
+	}
+	return registry, nil
+}
+
+// LoadFile читает список провайдеров из JSON-файла. Пустой путь - вход через OIDC выключен
+func LoadFile(path string) (*Registry, error) {
+	if path == "" {
+		return NewRegistry(nil)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: read %s: %w", path, err)
+	}
+	var configs []ProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("oidc: parse %s: %w", path, err)
+	}
+	return NewRegistry(configs)
+}
+
+func (registry *Registry) Names() []string {
+	names := make([]string, 0, len(registry.configs))
+	for name := range registry.configs {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (registry *Registry) Provider(ctx context.Context, name string) (*Provider, bool, error) {
+	config, ok := registry.configs[name]
+	if !ok {
+		return nil, false, nil
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if provider, ok := registry.providers[name]; ok {
+		return provider, true, nil
+	}
+	provider, err := Discover(ctx, registry.Client, config)
+	if err != nil {
+		return nil, true, err
+	}
+	registry.providers[name] = provider
+	return provider, true, nil
+}
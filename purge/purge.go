@@ -0,0 +1,167 @@
+// Package purge окончательно удаляет строки альбомов и треков, которые владелец удалил
+// (deleted_at), вместе с журналом прослушиваний и позициями в чарте. Файлы и комментарии
+// обработчик удаления убирает сразу; purge повторяет это для того, что не удалось удалить.
+// Сервер очищает сам (Scheduler), команда purge - для ручного запуска
+package purge
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Edafi/MusicVibe/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Purger struct {
+	DB            *sql.DB
+	MongoDatabase *mongo.Database
+	Store         storage.BlobStore
+	Bucket        string
+}
+
+type Result struct {
+	AlbumIDs []string
+	TrackIDs []string
+	// Ключи объектов, которые удалены (или были бы удалены при dryRun)
+	Objects []string
+}
+
+type deletedTrack struct {
+	ID, MusicianID, FilePath string
+}
+
+type deletedAlbum struct {
+	ID, MusicianID string
+}
+
+// Run очищает всё, что удалено раньше before. При dryRun только собирает список
+func (purger *Purger) Run(ctx context.Context, before time.Time, dryRun bool) (Result, error) {
+	albums, err := purger.deletedAlbums(ctx, before)
+	if err != nil {
+		return Result{}, err
+	}
+	// Треки удалённого альбома очищаются вместе с ним, даже если помечены позже
+	tracks, err := purger.deletedTracks(ctx, before)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	for _, album := range albums {
+		result.AlbumIDs = append(result.AlbumIDs, album.ID)
+		covers, err := purger.Store.List(ctx, storage.ImagePrefix(storage.MusicianDir(album.MusicianID), storage.KindCover, album.ID))
+		if err != nil {
+			return Result{}, err
+		}
+		for _, object := range covers {
+			result.Objects = append(result.Objects, object.Key)
+		}
+	}
+	for _, track := range tracks {
+		result.TrackIDs = append(result.TrackIDs, track.ID)
+		audioKey := storage.TrackAudioKey(track.MusicianID, track.ID)
+		result.Objects = append(result.Objects, audioKey)
+		if key, ok := storage.KeyFromStoredPath(purger.Bucket, track.FilePath); ok && key != audioKey {
+			result.Objects = append(result.Objects, key)
+		}
+	}
+	if dryRun || (len(albums) == 0 && len(tracks) == 0) {
+		return result, nil
+	}
+
+	if err := purger.deleteRows(ctx, result.AlbumIDs, result.TrackIDs); err != nil {
+		return Result{}, err
+	}
+
+	// БД уже не ссылается на объекты, поэтому ошибки очистки только логируем
+	for _, key := range result.Objects {
+		if err := purger.Store.Delete(ctx, key); err != nil {
+			log.Println("purge: remove object error:", key, err)
+		}
+	}
+	if len(result.TrackIDs) > 0 {
+		_, err := purger.MongoDatabase.Collection("track_comments").DeleteMany(ctx, bson.M{"track_id": bson.M{"$in": result.TrackIDs}})
+		if err != nil {
+			log.Println("purge: delete comments error:", err)
+		}
+	}
+	return result, nil
+}
+
+func (purger *Purger) deletedAlbums(ctx context.Context, before time.Time) ([]deletedAlbum, error) {
+	rows, err := purger.DB.QueryContext(ctx, `
+		SELECT id, musician_id FROM album WHERE deleted_at < ?`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var albums []deletedAlbum
+	for rows.Next() {
+		var album deletedAlbum
+		if err := rows.Scan(&album.ID, &album.MusicianID); err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, rows.Err()
+}
+
+func (purger *Purger) deletedTracks(ctx context.Context, before time.Time) ([]deletedTrack, error) {
+	rows, err := purger.DB.QueryContext(ctx, `
+		SELECT t.id, t.musician_id, t.file_path
+		FROM track t
+		LEFT JOIN album a ON a.id = t.album_id
+		WHERE t.deleted_at < ? OR a.deleted_at < ?`, before, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tracks []deletedTrack
+	for rows.Next() {
+		var track deletedTrack
+		if err := rows.Scan(&track.ID, &track.MusicianID, &track.FilePath); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, rows.Err()
+}
+
+// Удаляет строки и все ссылки на них из библиотек, плейлистов, журнала и чарта
+func (purger *Purger) deleteRows(ctx context.Context, albumIDs, trackIDs []string) error {
+	tx, err := purger.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, trackID := range trackIDs {
+		for _, query := range []string{
+			`DELETE FROM liked_tracks WHERE track_id = ?`,
+			`DELETE FROM track_playlist WHERE track_id = ?`,
+			`DELETE FROM track_stream WHERE track_id = ?`,
+			`DELETE FROM track_chart WHERE track_id = ?`,
+			`DELETE FROM track WHERE id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, trackID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, albumID := range albumIDs {
+		for _, query := range []string{
+			`DELETE FROM liked_albums WHERE album_id = ?`,
+			`DELETE FROM album WHERE id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, albumID); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,50 @@
+package purge
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	DefaultInterval = time.Hour
+	// Сколько строка удалённого хранится до окончательной очистки
+	DefaultRetention = 30 * 24 * time.Hour
+)
+
+// Scheduler раз в Interval очищает то, что удалено больше Retention назад.
+// Несколько серверов могут очищать одновременно: удаление строк и объектов идемпотентно
+type Scheduler struct {
+	Purger    *Purger
+	Interval  time.Duration
+	Retention time.Duration
+}
+
+// Run работает до отмены ctx
+func (s *Scheduler) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	retention := s.Retention
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if result, err := s.Purger.Run(ctx, time.Now().Add(-retention), false); err != nil {
+			log.Println("Purge scheduler error:", err)
+		} else if len(result.AlbumIDs) > 0 || len(result.TrackIDs) > 0 {
+			log.Printf("Purge scheduler: purged %d albums, %d tracks, %d objects",
+				len(result.AlbumIDs), len(result.TrackIDs), len(result.Objects))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
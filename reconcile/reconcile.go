@@ -0,0 +1,165 @@
+// Package reconcile сверяет объекты хранилища со строками MySQL: находит объекты,
+// на которые ничего не ссылается, и строки, чьих файлов нет в хранилище
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/Edafi/MusicVibe/storage"
+)
+
+type Checker struct {
+	DB     *sql.DB
+	Store  storage.BlobStore
+	Bucket string
+}
+
+// Missing - строка БД ссылается на объект, которого нет в хранилище
+type Missing struct {
+	Table string
+	ID    string
+	Key   string
+}
+
+type Report struct {
+	Objects int
+	// Объекты из раскладки, владельца которых (трека, альбома, музыканта, пользователя) нет в БД
+	Orphans []storage.ObjectInfo
+	// Объекты вне раскладки: их назначение неизвестно, поэтому они только перечисляются
+	Unknown []storage.ObjectInfo
+	Missing []Missing
+}
+
+// Строки, на которые может ссылаться объект; удалённые владельцем (deleted_at) тоже
+// считаются - их файлы удаляет purge
+type catalog struct {
+	trackMusician map[string]string
+	albumMusician map[string]string
+	musicians     map[string]bool
+	users         map[string]bool
+	// Пути к файлам из БД: таблица, id строки, путь
+	paths []Missing
+}
+
+func (checker *Checker) Check(ctx context.Context) (Report, error) {
+	rows, err := checker.loadCatalog(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	objects, err := checker.Store.List(ctx, "")
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Objects: len(objects)}
+	keys := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		// Карантин - уже обработанные сироты, их сверять не с чем
+		if strings.HasPrefix(object.Key, QuarantinePrefix) {
+			report.Objects--
+			continue
+		}
+		keys[object.Key] = true
+		ref, ok := storage.ParseObjectKey(object.Key)
+		if !ok {
+			report.Unknown = append(report.Unknown, object)
+			continue
+		}
+		if !rows.owns(ref) {
+			report.Orphans = append(report.Orphans, object)
+		}
+	}
+
+	for trackID, musicianID := range rows.trackMusician {
+		if key := storage.TrackAudioKey(musicianID, trackID); !keys[key] {
+			report.Missing = append(report.Missing, Missing{Table: "track", ID: trackID, Key: key})
+		}
+	}
+	for _, path := range rows.paths {
+		// Пути вне бакета - статические файлы и внешние ссылки
+		if key, ok := storage.KeyFromStoredPath(checker.Bucket, path.Key); ok && !keys[key] {
+			report.Missing = append(report.Missing, Missing{Table: path.Table, ID: path.ID, Key: key})
+		}
+	}
+	return report, nil
+}
+
+func (rows *catalog) owns(ref storage.ObjectRef) bool {
+	switch {
+	case ref.Kind == storage.KindTrack:
+		return rows.trackMusician[ref.ID] == ref.OwnerID
+	case ref.Kind == storage.KindCover:
+		return rows.albumMusician[ref.ID] == ref.OwnerID
+	case ref.Owner == "musician":
+		return ref.ID == ref.OwnerID && rows.musicians[ref.ID]
+	default:
+		return ref.ID == ref.OwnerID && rows.users[ref.ID]
+	}
+}
+
+func (checker *Checker) loadCatalog(ctx context.Context) (*catalog, error) {
+	rows := &catalog{
+		trackMusician: make(map[string]string),
+		albumMusician: make(map[string]string),
+		musicians:     make(map[string]bool),
+		users:         make(map[string]bool),
+	}
+
+	err := scan(ctx, checker.DB, `SELECT id, musician_id FROM track`, func(values []string) {
+		rows.trackMusician[values[0]] = values[1]
+	})
+	if err == nil {
+		err = scan(ctx, checker.DB, `SELECT id, musician_id, cover_path FROM album`, func(values []string) {
+			rows.albumMusician[values[0]] = values[1]
+			rows.paths = append(rows.paths, Missing{Table: "album", ID: values[0], Key: values[2]})
+		})
+	}
+	if err == nil {
+		err = scan(ctx, checker.DB, `SELECT id, avatar_path, COALESCE(background_path, '') FROM musician`, func(values []string) {
+			rows.musicians[values[0]] = true
+			rows.paths = append(rows.paths,
+				Missing{Table: "musician", ID: values[0], Key: values[1]},
+				Missing{Table: "musician", ID: values[0], Key: values[2]})
+		})
+	}
+	if err == nil {
+		err = scan(ctx, checker.DB, `SELECT id, avatar_path, COALESCE(background_path, '') FROM user`, func(values []string) {
+			rows.users[values[0]] = true
+			rows.paths = append(rows.paths,
+				Missing{Table: "user", ID: values[0], Key: values[1]},
+				Missing{Table: "user", ID: values[0], Key: values[2]})
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// scan читает строковые колонки запроса построчно
+func scan(ctx context.Context, db *sql.DB, query string, row func(values []string)) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]string, len(columns))
+	targets := make([]interface{}, len(columns))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return err
+		}
+		row(values)
+	}
+	return rows.Err()
+}
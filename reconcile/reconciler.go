@@ -0,0 +1,126 @@
+package reconcile
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Edafi/MusicVibe/storage"
+)
+
+// QuarantinePrefix - куда переносятся сироты. Объект в карантине можно вернуть,
+// переложив его обратно без префикса, или удалить вручную
+const QuarantinePrefix = "quarantine/"
+
+const (
+	DefaultInterval = 6 * time.Hour
+	// Загрузка альбома кладёт файлы раньше строк, поэтому свежий объект без строки -
+	// скорее всего незавершённая загрузка, а не сирота
+	DefaultGracePeriod = 24 * time.Hour
+)
+
+// Result - итог одного прохода сверки
+type Result struct {
+	Report
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// Ключи сирот, перенесённых в карантин в этом проходе
+	Quarantined []string
+	Err         error
+}
+
+// Reconciler раз в Interval сверяет хранилище с БД и переносит в карантин сирот старше
+// GracePeriod. Несколько серверов могут сверять одновременно: перенос идемпотентен
+type Reconciler struct {
+	Checker     *Checker
+	Interval    time.Duration
+	GracePeriod time.Duration
+
+	// Проходы не пересекаются: фоновый и запущенный через API ждут друг друга
+	running sync.Mutex
+	mu      sync.Mutex
+	last    *Result
+}
+
+// Run работает до отмены ctx
+func (reconciler *Reconciler) Run(ctx context.Context) {
+	interval := reconciler.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result := reconciler.RunOnce(ctx)
+		if result.Err != nil {
+			log.Println("Storage reconciler error:", result.Err)
+		} else if len(result.Orphans) > 0 || len(result.Missing) > 0 {
+			log.Printf("Storage reconciler: %d orphaned (%d quarantined), %d missing",
+				len(result.Orphans), len(result.Quarantined), len(result.Missing))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce выполняет проход сверки и запоминает его результат
+func (reconciler *Reconciler) RunOnce(ctx context.Context) Result {
+	reconciler.running.Lock()
+	defer reconciler.running.Unlock()
+
+	result := Result{StartedAt: time.Now()}
+	result.Report, result.Err = reconciler.Checker.Check(ctx)
+	if result.Err == nil {
+		grace := reconciler.GracePeriod
+		if grace <= 0 {
+			grace = DefaultGracePeriod
+		}
+		for _, object := range result.Orphans {
+			if result.StartedAt.Sub(object.LastModified) < grace {
+				continue
+			}
+			if err := Quarantine(ctx, reconciler.Checker.Store, object); err != nil {
+				log.Println("Storage reconciler: quarantine error:", object.Key, err)
+				continue
+			}
+			result.Quarantined = append(result.Quarantined, object.Key)
+		}
+	}
+	result.FinishedAt = time.Now()
+
+	reconciler.mu.Lock()
+	reconciler.last = &result
+	reconciler.mu.Unlock()
+	return result
+}
+
+// Last - результат последнего прохода; false, если сверка ещё не выполнялась
+func (reconciler *Reconciler) Last() (Result, bool) {
+	reconciler.mu.Lock()
+	defer reconciler.mu.Unlock()
+	if reconciler.last == nil {
+		return Result{}, false
+	}
+	return *reconciler.last, true
+}
+
+// Quarantine переносит объект под QuarantinePrefix с тем же ключом
+func Quarantine(ctx context.Context, store storage.BlobStore, object storage.ObjectInfo) error {
+	source, err := store.Open(ctx, object.Key)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info := source.Info()
+	if err := store.Put(ctx, QuarantinePrefix+object.Key, source, info.Size, info.ContentType); err != nil {
+		return err
+	}
+	return store.Delete(ctx, object.Key)
+}
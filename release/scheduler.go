@@ -0,0 +1,53 @@
+// Package release публикует треки с отложенным релизом.
+package release
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+const DefaultInterval = time.Minute
+
+// Scheduler раз в Interval переводит треки в статусе scheduled с наступившим
+// release_at в public. Запуск на нескольких серверах безопасен: UPDATE идемпотентен
+type Scheduler struct {
+	DB       *sql.DB
+	Interval time.Duration
+}
+
+// Run работает до отмены ctx
+func (s *Scheduler) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if published, err := s.PublishDue(ctx); err != nil {
+			log.Println("Release scheduler error:", err)
+		} else if published > 0 {
+			log.Println("Release scheduler: published", published, "tracks")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishDue публикует все треки, чей релиз уже наступил
+func (s *Scheduler) PublishDue(ctx context.Context) (int64, error) {
+	result, err := s.DB.ExecContext(ctx, `
+		UPDATE track SET visibility = 'public'
+		WHERE visibility = 'scheduled' AND release_at IS NOT NULL AND release_at <= ?`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Edafi/MusicVibe/models"
+)
+
+type AlbumRepo interface {
+	// Get возвращает альбом, только если он виден зрителю. Tracks не заполняется -
+	// список треков тоже зависит от зрителя, см. TrackRepo.ListIDsByAlbum
+	Get(ctx context.Context, albumID string, viewer Viewer) (models.AlbumPageResponse, error)
+	// Альбомы с публичными треками из любимых жанров пользователя, в случайном порядке
+	ListRecommended(ctx context.Context, userID string, limit int) ([]models.RecommendedAlbum, error)
+	// Видимые зрителю альбомы музыканта с ID публичных треков
+	ListByMusician(ctx context.Context, musicianID string, viewer Viewer) ([]models.AlbumPreview, error)
+	// MusicianID возвращает музыканта неудалённого альбома без учёта видимости:
+	// обложки отдаются только по подписанной ссылке
+	MusicianID(ctx context.Context, albumID string) (string, error)
+}
+
+type SQLAlbumRepo struct {
+	DB Querier
+}
+
+var _ AlbumRepo = (*SQLAlbumRepo)(nil)
+
+func (repo *SQLAlbumRepo) Get(ctx context.Context, albumID string, viewer Viewer) (models.AlbumPageResponse, error) {
+	var album models.AlbumPageResponse
+	err := repo.DB.QueryRowContext(ctx, `
+		SELECT a.id, a.title, YEAR(a.release_date), a.cover_path,
+		COALESCE(a.description, ''), m.id, m.name, m.avatar_path
+		FROM album a
+		JOIN musician m ON a.musician_id = m.id
+		WHERE a.id = ? AND `+AlbumVisibleCondition,
+		albumID, viewer.UserID, viewer.UserID, viewer.ShareToken).Scan(
+		&album.ID, &album.Title, &album.Year, &album.CoverURL,
+		&album.Description, &album.ArtistID, &album.ArtistName, &album.ArtistAvatarURL,
+	)
+	if err != nil {
+		return models.AlbumPageResponse{}, notFound(err)
+	}
+	return album, nil
+}
+
+func (repo *SQLAlbumRepo) ListRecommended(ctx context.Context, userID string, limit int) ([]models.RecommendedAlbum, error) {
+	rows, err := repo.DB.QueryContext(ctx, `
+		SELECT a.id, a.title, a.musician_id, m.name,
+		a.cover_path, YEAR(a.release_date), COALESCE(a.description, '')
+		FROM album a
+		JOIN musician m ON a.musician_id = m.id
+		JOIN user_genre ug ON a.genre_id = ug.genre_id
+		WHERE ug.user_id = ? AND `+publicAlbumCondition+`
+		ORDER BY RAND()
+		LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	albums := make([]models.RecommendedAlbum, 0)
+	for rows.Next() {
+		var album models.RecommendedAlbum
+		if err := rows.Scan(
+			&album.ID, &album.Title, &album.ArtistID, &album.ArtistName,
+			&album.CoverUrl, &album.Year, &album.Description,
+		); err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, rows.Err()
+}
+
+func (repo *SQLAlbumRepo) ListByMusician(ctx context.Context, musicianID string, viewer Viewer) ([]models.AlbumPreview, error) {
+	rows, err := repo.DB.QueryContext(ctx, `
+		SELECT a.id, a.title, YEAR(a.release_date), a.cover_path, COALESCE(a.description, '')
+		FROM album a
+		JOIN musician m ON a.musician_id = m.id
+		WHERE a.musician_id = ? AND `+AlbumVisibleCondition,
+		musicianID, viewer.UserID, viewer.UserID, viewer.ShareToken)
+	if err != nil {
+		return nil, err
+	}
+
+	albums := make([]models.AlbumPreview, 0)
+	for rows.Next() {
+		var album models.AlbumPreview
+		if err := rows.Scan(&album.ID, &album.Title, &album.Year, &album.CoverUrl, &album.Description); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Треки запрашиваются после закрытия rows, чтобы не держать два соединения
+	for i := range albums {
+		albums[i].Tracks, err = scanStrings(repo.DB.QueryContext(ctx, `
+			SELECT id FROM track t WHERE t.album_id = ? AND `+publicTrackCondition, albums[i].ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return albums, nil
+}
+
+func (repo *SQLAlbumRepo) MusicianID(ctx context.Context, albumID string) (string, error) {
+	var musicianID string
+	err := repo.DB.QueryRowContext(ctx, `SELECT musician_id FROM album WHERE id = ? AND deleted_at IS NULL`, albumID).Scan(&musicianID)
+	if err != nil {
+		return "", notFound(err)
+	}
+	return musicianID, nil
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+// CatalogRepo - изменения альбомов и треков их владельцем
+type CatalogRepo interface {
+	// OwnedAlbum возвращает музыканта-владельца альбома; ErrNotFound, если альбом
+	// удалён или принадлежит другому пользователю
+	OwnedAlbum(ctx context.Context, userID, albumID string) (string, error)
+	// OwnedTrack возвращает ErrNotFound, если трек удалён или принадлежит другому пользователю
+	OwnedTrack(ctx context.Context, userID, trackID string) error
+	GenreExists(ctx context.Context, genreID int) (bool, error)
+	UpdateAlbum(ctx context.Context, albumID string, changes AlbumChanges) error
+	SetAlbumCover(ctx context.Context, albumID, coverPath string) error
+	UpdateTrack(ctx context.Context, trackID string, changes TrackChanges) error
+	// DeleteTrack помечает трек удалённым (deleted_at) и сразу убирает ссылки на него
+	// из избранного и плейлистов. Строка остаётся, пока её не очистит purge.
+	// Возвращает трек, чтобы вызывающий удалил его файлы и комментарии
+	DeleteTrack(ctx context.Context, trackID string, at time.Time) (DeletedTrack, error)
+	// DeleteAlbum делает то же для альбома и всех его треков
+	DeleteAlbum(ctx context.Context, albumID string, at time.Time) ([]DeletedTrack, error)
+}
+
+type DeletedTrack struct {
+	ID         string
+	MusicianID string
+	FilePath   string
+}
+
+// VisibilityChange - новая видимость трека. ReleaseAt учитывается только для scheduled
+type VisibilityChange struct {
+	Visibility string
+	ReleaseAt  *time.Time
+}
+
+// nil-поля не меняются
+type AlbumChanges struct {
+	Title       *string
+	Description *string
+	// Жанр трека при загрузке берётся из альбома, поэтому меняется вместе с альбомом
+	GenreID *int
+	// Применяется ко всем трекам альбома
+	Visibility *VisibilityChange
+}
+
+type TrackChanges struct {
+	Title      *string
+	Visibility *VisibilityChange
+}
+
+type SQLCatalogRepo struct {
+	DB *sql.DB
+}
+
+var _ CatalogRepo = (*SQLCatalogRepo)(nil)
+
+// NewShareToken - секрет для ссылки на трек с видимостью unlisted
+func NewShareToken() (string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func (repo *SQLCatalogRepo) OwnedAlbum(ctx context.Context, userID, albumID string) (string, error) {
+	var musicianID string
+	err := repo.DB.QueryRowContext(ctx, `
+		SELECT a.musician_id
+		FROM album a
+		JOIN musician m ON m.id = a.musician_id
+		WHERE a.id = ? AND m.user_id = ? AND a.deleted_at IS NULL`, albumID, userID).Scan(&musicianID)
+	if err != nil {
+		return "", notFound(err)
+	}
+	return musicianID, nil
+}
+
+func (repo *SQLCatalogRepo) OwnedTrack(ctx context.Context, userID, trackID string) error {
+	var exists bool
+	err := repo.DB.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM track t
+			JOIN musician m ON m.id = t.musician_id
+			WHERE t.id = ? AND m.user_id = ? AND t.deleted_at IS NULL)`, trackID, userID).Scan(&exists)
+	if err == nil && !exists {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (repo *SQLCatalogRepo) GenreExists(ctx context.Context, genreID int) (bool, error) {
+	var exists bool
+	err := repo.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM genre WHERE id = ?)`, genreID).Scan(&exists)
+	return exists, err
+}
+
+func (repo *SQLCatalogRepo) UpdateAlbum(ctx context.Context, albumID string, changes AlbumChanges) error {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if changes.Title != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE album SET title = ?, title_lower = ? WHERE id = ?`,
+			*changes.Title, strings.ToLower(*changes.Title), albumID)
+	}
+	if err == nil && changes.Description != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE album SET description = ? WHERE id = ?`, *changes.Description, albumID)
+	}
+	if err == nil && changes.GenreID != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE album SET genre_id = ? WHERE id = ?`, *changes.GenreID, albumID)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `UPDATE track SET genre_id = ? WHERE album_id = ?`, *changes.GenreID, albumID)
+		}
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `
+				INSERT IGNORE INTO musician_genre (musician_id, genre_id)
+				SELECT musician_id, ? FROM album WHERE id = ?`, *changes.GenreID, albumID)
+		}
+	}
+	if err == nil && changes.Visibility != nil {
+		var trackIDs []string
+		trackIDs, err = scanStrings(tx.QueryContext(ctx, `SELECT id FROM track WHERE album_id = ? AND deleted_at IS NULL`, albumID))
+		for _, trackID := range trackIDs {
+			if err = setTrackVisibility(ctx, tx, trackID, *changes.Visibility); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (repo *SQLCatalogRepo) SetAlbumCover(ctx context.Context, albumID, coverPath string) error {
+	_, err := repo.DB.ExecContext(ctx, `UPDATE album SET cover_path = ? WHERE id = ?`, coverPath, albumID)
+	return err
+}
+
+func (repo *SQLCatalogRepo) UpdateTrack(ctx context.Context, trackID string, changes TrackChanges) error {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if changes.Title != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE track SET title = ?, title_lower = ? WHERE id = ?`,
+			*changes.Title, strings.ToLower(*changes.Title), trackID)
+	}
+	if err == nil && changes.Visibility != nil {
+		err = setTrackVisibility(ctx, tx, trackID, *changes.Visibility)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Для unlisted создаёт share-токен, если его ещё нет: у каждого трека свой
+func setTrackVisibility(ctx context.Context, tx *sql.Tx, trackID string, change VisibilityChange) error {
+	var releaseAt *time.Time
+	if change.Visibility == "scheduled" {
+		releaseAt = change.ReleaseAt
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE track SET visibility = ?, release_at = ? WHERE id = ?`,
+		change.Visibility, releaseAt, trackID); err != nil {
+		return err
+	}
+	if change.Visibility != "unlisted" {
+		return nil
+	}
+	token, err := NewShareToken()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE track SET share_token = ? WHERE id = ? AND share_token IS NULL`, token, trackID)
+	return err
+}
+
+func (repo *SQLCatalogRepo) DeleteTrack(ctx context.Context, trackID string, at time.Time) (DeletedTrack, error) {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return DeletedTrack{}, err
+	}
+	defer tx.Rollback()
+
+	tracks, err := deleteTracks(ctx, tx, `t.id = ?`, trackID, at)
+	if err != nil {
+		return DeletedTrack{}, err
+	}
+	if len(tracks) == 0 {
+		return DeletedTrack{}, ErrNotFound
+	}
+	return tracks[0], tx.Commit()
+}
+
+func (repo *SQLCatalogRepo) DeleteAlbum(ctx context.Context, albumID string, at time.Time) ([]DeletedTrack, error) {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tracks, err := deleteTracks(ctx, tx, `t.album_id = ?`, albumID, at)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `UPDATE album SET deleted_at = ? WHERE id = ?`, at, albumID)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM liked_albums WHERE album_id = ?`, albumID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tracks, tx.Commit()
+}
+
+// Помечает удалёнными ещё не удалённые треки по условию where и убирает их
+// из избранного и плейлистов. Журнал прослушиваний и чарт чистит purge
+func deleteTracks(ctx context.Context, tx *sql.Tx, where string, arg interface{}, at time.Time) ([]DeletedTrack, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT t.id, t.musician_id, t.file_path FROM track t
+		WHERE `+where+` AND t.deleted_at IS NULL
+		FOR UPDATE`, arg)
+	if err != nil {
+		return nil, err
+	}
+	var tracks []DeletedTrack
+	for rows.Next() {
+		var track DeletedTrack
+		if err := rows.Scan(&track.ID, &track.MusicianID, &track.FilePath); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, track := range tracks {
+		if _, err := tx.ExecContext(ctx, `UPDATE track SET deleted_at = ? WHERE id = ?`, at, track.ID); err != nil {
+			return nil, err
+		}
+		for _, query := range []string{
+			`DELETE FROM liked_tracks WHERE track_id = ?`,
+			`DELETE FROM track_playlist WHERE track_id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, track.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tracks, nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// LibraryRepo - избранные треки и альбомы и подписки на музыкантов
+type LibraryRepo interface {
+	// ID избранных треков, которые пользователь всё ещё может видеть
+	LikedTrackIDs(ctx context.Context, userID string) ([]string, error)
+	LikeTrack(ctx context.Context, userID, trackID string) error
+	UnlikeTrack(ctx context.Context, userID, trackID string) error
+	LikedAlbumIDs(ctx context.Context, userID string) ([]string, error)
+	LikeAlbum(ctx context.Context, userID, albumID string) error
+	UnlikeAlbum(ctx context.Context, userID, albumID string) error
+	FollowedMusicianIDs(ctx context.Context, userID string) ([]string, error)
+	Follow(ctx context.Context, userID, musicianID string) error
+	Unfollow(ctx context.Context, userID, musicianID string) error
+	// Подписки, выбранные при первичной настройке; одной транзакцией отмечает настройку завершённой
+	CompleteSetupFollowing(ctx context.Context, userID string, musicianIDs []string) error
+}
+
+type SQLLibraryRepo struct {
+	DB *sql.DB
+}
+
+var _ LibraryRepo = (*SQLLibraryRepo)(nil)
+
+func (repo *SQLLibraryRepo) LikedTrackIDs(ctx context.Context, userID string) ([]string, error) {
+	return scanStrings(repo.DB.QueryContext(ctx, `
+		SELECT t.id
+		FROM liked_tracks lt
+		JOIN track t ON lt.track_id = t.id
+		JOIN musician m ON m.id = t.musician_id
+		WHERE lt.user_id = ? AND t.deleted_at IS NULL
+			AND (t.visibility IN ('public', 'unlisted') OR m.user_id = lt.user_id)`, userID))
+}
+
+func (repo *SQLLibraryRepo) LikeTrack(ctx context.Context, userID, trackID string) error {
+	_, err := repo.DB.ExecContext(ctx, `INSERT IGNORE INTO liked_tracks (user_id, track_id) VALUES (?, ?)`, userID, trackID)
+	return err
+}
+
+func (repo *SQLLibraryRepo) UnlikeTrack(ctx context.Context, userID, trackID string) error {
+	_, err := repo.DB.ExecContext(ctx, `DELETE FROM liked_tracks WHERE user_id = ? AND track_id = ?`, userID, trackID)
+	return err
+}
+
+func (repo *SQLLibraryRepo) LikedAlbumIDs(ctx context.Context, userID string) ([]string, error) {
+	return scanStrings(repo.DB.QueryContext(ctx, `
+		SELECT a.id
+		FROM liked_albums la
+		JOIN album a ON la.album_id = a.id
+		WHERE la.user_id = ? AND a.deleted_at IS NULL`, userID))
+}
+
+func (repo *SQLLibraryRepo) LikeAlbum(ctx context.Context, userID, albumID string) error {
+	_, err := repo.DB.ExecContext(ctx, `INSERT IGNORE INTO liked_albums (user_id, album_id) VALUES (?, ?)`, userID, albumID)
+	return err
+}
+
+func (repo *SQLLibraryRepo) UnlikeAlbum(ctx context.Context, userID, albumID string) error {
+	_, err := repo.DB.ExecContext(ctx, `DELETE FROM liked_albums WHERE user_id = ? AND album_id = ?`, userID, albumID)
+	return err
+}
+
+func (repo *SQLLibraryRepo) FollowedMusicianIDs(ctx context.Context, userID string) ([]string, error) {
+	return scanStrings(repo.DB.QueryContext(ctx, `
+		SELECT m.id
+		FROM user_following uf
+		JOIN musician m ON uf.musician_id = m.id
+		WHERE uf.user_id = ?`, userID))
+}
+
+func (repo *SQLLibraryRepo) Follow(ctx context.Context, userID, musicianID string) error {
+	_, err := repo.DB.ExecContext(ctx, `INSERT IGNORE INTO user_following (user_id, musician_id) VALUES (?, ?)`, userID, musicianID)
+	return err
+}
+
+func (repo *SQLLibraryRepo) Unfollow(ctx context.Context, userID, musicianID string) error {
+	_, err := repo.DB.ExecContext(ctx, `DELETE FROM user_following WHERE user_id = ? AND musician_id = ?`, userID, musicianID)
+	return err
+}
+
+func (repo *SQLLibraryRepo) CompleteSetupFollowing(ctx context.Context, userID string, musicianIDs []string) error {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, musicianID := range musicianIDs {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO user_following (user_id, musician_id) VALUES (?, ?)`, userID, musicianID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE user SET has_complete_setup = 1 WHERE id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
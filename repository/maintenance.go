@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SQLMaintenance - пересчёты производных данных для административных команд
+type SQLMaintenance struct {
+	DB *sql.DB
+}
+
+// ReindexSearch заново заполняет title_lower и name_lower, по которым работает поиск.
+// Сравнение бинарное: при регистронезависимой сводке "ABC" = "abc"
+func (repo *SQLMaintenance) ReindexSearch(ctx context.Context) (int64, error) {
+	var total int64
+	for _, query := range []string{
+		`UPDATE track SET title_lower = LOWER(title) WHERE BINARY title_lower <> BINARY LOWER(title)`,
+		`UPDATE album SET title_lower = LOWER(title) WHERE BINARY title_lower <> BINARY LOWER(title)`,
+		`UPDATE musician SET name_lower = LOWER(name) WHERE BINARY name_lower <> BINARY LOWER(name)`,
+	} {
+		result, err := repo.DB.ExecContext(ctx, query)
+		if err != nil {
+			return total, err
+		}
+		affected, _ := result.RowsAffected()
+		total += affected
+	}
+	return total, nil
+}
+
+// RecomputeStreamCounts пересчитывает track.stream_count по журналу track_stream
+// и возвращает число изменённых треков
+func (repo *SQLMaintenance) RecomputeStreamCounts(ctx context.Context) (int64, error) {
+	result, err := repo.DB.ExecContext(ctx, `
+		UPDATE track t
+		LEFT JOIN (
+			SELECT track_id, COUNT(*) AS plays FROM track_stream GROUP BY track_id
+		) s ON s.track_id = t.id
+		SET t.stream_count = t.imported_stream_count + COALESCE(s.plays, 0)`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RecomputeChart заменяет track_chart топом публичных треков по прослушиваниям с since
+// и возвращает число позиций
+func (repo *SQLMaintenance) RecomputeChart(ctx context.Context, since time.Time, size int) (int64, error) {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM track_chart`); err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO track_chart (position, track_id, plays, computed_at)
+		SELECT ROW_NUMBER() OVER (ORDER BY COUNT(*) DESC, s.track_id), s.track_id, COUNT(*), ?
+		FROM track_stream s
+		JOIN track t ON t.id = s.track_id
+		WHERE s.streamed_at >= ? AND `+publicTrackCondition+`
+		GROUP BY s.track_id
+		ORDER BY COUNT(*) DESC, s.track_id
+		LIMIT ?`, time.Now(), since, size)
+	if err != nil {
+		return 0, err
+	}
+	positions, _ := result.RowsAffected()
+	return positions, tx.Commit()
+}
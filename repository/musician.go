@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Edafi/MusicVibe/models"
+)
+
+type MusicianRepo interface {
+	// Get и ListRecommended заполняют только поля из musician и user;
+	// жанры, соцсети, прослушивания и альбомы запрашиваются отдельно
+	Get(ctx context.Context, musicianID string) (models.Musician, error)
+	// Музыканты из любимых жанров пользователя
+	ListRecommended(ctx context.Context, userID string) ([]models.Musician, error)
+	Genres(ctx context.Context, musicianID string) ([]string, error)
+	SocialLinks(ctx context.Context, userID string) ([]models.SocialLink, error)
+	// Сумма прослушиваний публичных треков
+	Auditions(ctx context.Context, musicianID string) (int, error)
+}
+
+type SQLMusicianRepo struct {
+	DB Querier
+}
+
+var _ MusicianRepo = (*SQLMusicianRepo)(nil)
+
+const musicianColumns = `m.id, m.user_id, m.name, u.email, m.avatar_path,
+	COALESCE(m.background_path, u.background_path, ''),
+	COALESCE(m.description, u.description, ''), u.has_complete_setup`
+
+func musicianScanTargets(musician *models.Musician) []interface{} {
+	return []interface{}{
+		&musician.ID, &musician.UserID, &musician.Name, &musician.Email, &musician.AvatarPath,
+		&musician.BackgroundPath, &musician.Description, &musician.HasCompleteSetup,
+	}
+}
+
+func (repo *SQLMusicianRepo) Get(ctx context.Context, musicianID string) (models.Musician, error) {
+	var musician models.Musician
+	err := repo.DB.QueryRowContext(ctx, `
+		SELECT `+musicianColumns+`
+		FROM musician m
+		JOIN user u ON m.user_id = u.id
+		WHERE m.id = ?`, musicianID).Scan(musicianScanTargets(&musician)...)
+	if err != nil {
+		return models.Musician{}, notFound(err)
+	}
+	return musician, nil
+}
+
+func (repo *SQLMusicianRepo) ListRecommended(ctx context.Context, userID string) ([]models.Musician, error) {
+	rows, err := repo.DB.QueryContext(ctx, `
+		SELECT `+musicianColumns+`
+		FROM musician m
+		JOIN user u ON m.user_id = u.id
+		WHERE EXISTS (
+			SELECT 1 FROM musician_genre mg
+			JOIN user_genre ug ON ug.genre_id = mg.genre_id
+			WHERE mg.musician_id = m.id AND ug.user_id = ?)`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	musicians := make([]models.Musician, 0)
+	for rows.Next() {
+		var musician models.Musician
+		if err := rows.Scan(musicianScanTargets(&musician)...); err != nil {
+			return nil, err
+		}
+		musicians = append(musicians, musician)
+	}
+	return musicians, rows.Err()
+}
+
+func (repo *SQLMusicianRepo) Genres(ctx context.Context, musicianID string) ([]string, error) {
+	return scanStrings(repo.DB.QueryContext(ctx, `
+		SELECT g.name
+		FROM genre g
+		JOIN musician_genre mg ON mg.genre_id = g.id
+		WHERE mg.musician_id = ?`, musicianID))
+}
+
+func (repo *SQLMusicianRepo) SocialLinks(ctx context.Context, userID string) ([]models.SocialLink, error) {
+	rows, err := repo.DB.QueryContext(ctx, `
+		SELECT sn.name, usn.profile_url
+		FROM user_social_network usn
+		JOIN social_network sn ON usn.social_network_id = sn.id
+		WHERE usn.user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]models.SocialLink, 0)
+	for rows.Next() {
+		var link models.SocialLink
+		if err := rows.Scan(&link.Name, &link.URL); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (repo *SQLMusicianRepo) Auditions(ctx context.Context, musicianID string) (int, error) {
+	var auditions int
+	err := repo.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(stream_count), 0)
+		FROM track t
+		WHERE t.musician_id = ? AND `+publicTrackCondition, musicianID).Scan(&auditions)
+	return auditions, err
+}
@@ -0,0 +1,74 @@
+// Package repository собирает SQL-запросы к MySQL в одном месте. Обработчики работают
+// с интерфейсами TrackRepo, AlbumRepo, MusicianRepo, UserRepo, LibraryRepo и CatalogRepo,
+// поэтому в тестах их можно заменить подделками.
+//
+// Поля ссылок в возвращаемых моделях (ImageURL, CoverURL, AvatarPath...) содержат пути
+// из БД как есть - абсолютные ссылки строит обработчик через mediaurl
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrNotFound = errors.New("repository: not found")
+
+// Querier - общее у *sql.DB и *sql.Tx
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Viewer - кто смотрит каталог: от этого зависит, какие треки видны
+type Viewer struct {
+	// Пустой для анонимного доступа
+	UserID string
+	// Секрет из ссылки на трек с видимостью unlisted
+	ShareToken string
+}
+
+// Условие видимости трека t (с JOIN musician m) для зрителя. Удалённые треки не видны никому.
+// Параметры запроса: Viewer.UserID, Viewer.ShareToken
+const TrackVisibleCondition = `(t.deleted_at IS NULL AND (t.visibility = 'public'
+	OR m.user_id = ?
+	OR (t.visibility = 'unlisted' AND t.share_token IS NOT NULL AND t.share_token = ?)))`
+
+// Трек t виден всем и попадает в подборки
+const publicTrackCondition = `t.visibility = 'public' AND t.deleted_at IS NULL`
+
+// Условие видимости альбома a (с JOIN musician m): владельцу виден всегда, остальным -
+// только если в нём есть видимый зрителю трек. Так название и обложка не раскрываются
+// до выхода первого трека. Треки альбома принадлежат его музыканту, поэтому m подходит и им.
+// Параметры запроса: Viewer.UserID, Viewer.UserID, Viewer.ShareToken
+const AlbumVisibleCondition = `(a.deleted_at IS NULL AND (m.user_id = ? OR EXISTS(
+	SELECT 1 FROM track t WHERE t.album_id = a.id AND ` + TrackVisibleCondition + `)))`
+
+// Альбом a виден всем: в нём есть публичный трек
+const publicAlbumCondition = `a.deleted_at IS NULL AND EXISTS(
+	SELECT 1 FROM track t WHERE t.album_id = a.id AND ` + publicTrackCondition + `)`
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func scanStrings(rows *sql.Rows, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]string, 0)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
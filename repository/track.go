@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Edafi/MusicVibe/models"
+)
+
+type TrackRepo interface {
+	// Get возвращает трек, только если он виден зрителю
+	Get(ctx context.Context, trackID string, viewer Viewer) (TrackDetails, error)
+	IsVisible(ctx context.Context, trackID string, viewer Viewer) (bool, error)
+	// MusicianID возвращает музыканта трека, если трек виден зрителю, иначе ErrNotFound
+	MusicianID(ctx context.Context, trackID string, viewer Viewer) (string, error)
+	// RecordStream увеличивает счётчик прослушиваний и пишет журнал track_stream,
+	// по которому пересчитываются счётчики и чарты. userID пуст для анонимного доступа
+	RecordStream(ctx context.Context, trackID, userID string, at time.Time) error
+	ListByAlbum(ctx context.Context, albumID string, viewer Viewer) ([]models.TrackResponse, error)
+	ListIDsByAlbum(ctx context.Context, albumID string, viewer Viewer) ([]string, error)
+	ListNew(ctx context.Context, limit int) ([]models.TrackResponse, error)
+	ListChart(ctx context.Context, limit int) ([]models.TrackResponse, error)
+	Search(ctx context.Context, query string, limit int) ([]models.TrackResponse, error)
+	// Публичные треки музыкантов из любимых жанров пользователя, в случайном порядке
+	ListRecommended(ctx context.Context, userID string, limit int) ([]models.TrackResponse, error)
+	// Публичные треки из избранного; limit <= 0 - без ограничения
+	ListLiked(ctx context.Context, userID string, limit int) ([]models.TrackResponse, error)
+	ListPopularByMusician(ctx context.Context, musicianID string, limit int) ([]models.TrackResponse, error)
+}
+
+// TrackDetails дополняет трек полями, которые видит только владелец
+type TrackDetails struct {
+	models.TrackResponse
+	OwnerUserID string
+	ReleaseAt   *time.Time
+	ShareToken  string
+}
+
+type SQLTrackRepo struct {
+	DB Querier
+}
+
+var _ TrackRepo = (*SQLTrackRepo)(nil)
+
+// Единый набор колонок трека: t - track, m - musician, a - album.
+// ImageURL получает путь обложки альбома, AudioURL не заполняется
+const trackColumns = `t.id, t.title, t.musician_id, m.name, COALESCE(a.cover_path, ''),
+	t.duration, t.stream_count, t.visibility`
+
+const trackFrom = `
+	FROM track t
+	JOIN musician m ON m.id = t.musician_id
+	LEFT JOIN album a ON a.id = t.album_id`
+
+func trackScanTargets(track *models.TrackResponse) []interface{} {
+	return []interface{}{
+		&track.ID, &track.Title, &track.ArtistID, &track.ArtistName, &track.ImageURL,
+		&track.Duration, &track.Plays, &track.Visibility,
+	}
+}
+
+func (repo *SQLTrackRepo) list(ctx context.Context, query string, args ...interface{}) ([]models.TrackResponse, error) {
+	rows, err := repo.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tracks := make([]models.TrackResponse, 0)
+	for rows.Next() {
+		var track models.TrackResponse
+		if err := rows.Scan(trackScanTargets(&track)...); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, rows.Err()
+}
+
+func (repo *SQLTrackRepo) Get(ctx context.Context, trackID string, viewer Viewer) (TrackDetails, error) {
+	var details TrackDetails
+	var releaseAt sql.NullTime
+	var shareToken sql.NullString
+
+	// Скрытый трек для постороннего выглядит так же, как несуществующий
+	targets := append(trackScanTargets(&details.TrackResponse), &details.OwnerUserID, &releaseAt, &shareToken)
+	err := repo.DB.QueryRowContext(ctx, `
+		SELECT `+trackColumns+`, m.user_id, t.release_at, t.share_token`+trackFrom+`
+		WHERE t.id = ? AND `+TrackVisibleCondition,
+		trackID, viewer.UserID, viewer.ShareToken).Scan(targets...)
+	if err != nil {
+		return TrackDetails{}, notFound(err)
+	}
+	if releaseAt.Valid {
+		details.ReleaseAt = &releaseAt.Time
+	}
+	details.ShareToken = shareToken.String
+	return details, nil
+}
+
+func (repo *SQLTrackRepo) IsVisible(ctx context.Context, trackID string, viewer Viewer) (bool, error) {
+	var visible bool
+	err := repo.DB.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM track t
+			JOIN musician m ON m.id = t.musician_id
+			WHERE t.id = ? AND `+TrackVisibleCondition+`)`,
+		trackID, viewer.UserID, viewer.ShareToken).Scan(&visible)
+	return visible, err
+}
+
+func (repo *SQLTrackRepo) MusicianID(ctx context.Context, trackID string, viewer Viewer) (string, error) {
+	var musicianID string
+	err := repo.DB.QueryRowContext(ctx, `
+		SELECT t.musician_id FROM track t
+		JOIN musician m ON m.id = t.musician_id
+		WHERE t.id = ? AND `+TrackVisibleCondition,
+		trackID, viewer.UserID, viewer.ShareToken).Scan(&musicianID)
+	if err != nil {
+		return "", notFound(err)
+	}
+	return musicianID, nil
+}
+
+func (repo *SQLTrackRepo) RecordStream(ctx context.Context, trackID, userID string, at time.Time) error {
+	if _, err := repo.DB.ExecContext(ctx, `UPDATE track SET stream_count = stream_count + 1 WHERE id = ?`, trackID); err != nil {
+		return err
+	}
+	_, err := repo.DB.ExecContext(ctx, `INSERT INTO track_stream (track_id, user_id, streamed_at) VALUES (?, NULLIF(?, ''), ?)`,
+		trackID, userID, at)
+	return err
+}
+
+func (repo *SQLTrackRepo) ListByAlbum(ctx context.Context, albumID string, viewer Viewer) ([]models.TrackResponse, error) {
+	return repo.list(ctx, `
+		SELECT `+trackColumns+trackFrom+`
+		WHERE t.album_id = ? AND `+TrackVisibleCondition+`
+		ORDER BY t.id`,
+		albumID, viewer.UserID, viewer.ShareToken)
+}
+
+func (repo *SQLTrackRepo) ListIDsByAlbum(ctx context.Context, albumID string, viewer Viewer) ([]string, error) {
+	return scanStrings(repo.DB.QueryContext(ctx, `
+		SELECT t.id FROM track t
+		JOIN musician m ON m.id = t.musician_id
+		WHERE t.album_id = ? AND `+TrackVisibleCondition+`
+		ORDER BY t.id`,
+		albumID, viewer.UserID, viewer.ShareToken))
+}
+
+func (repo *SQLTrackRepo) ListNew(ctx context.Context, limit int) ([]models.TrackResponse, error) {
+	return repo.list(ctx, `
+		SELECT `+trackColumns+trackFrom+`
+		WHERE `+publicTrackCondition+`
+		ORDER BY a.release_date DESC
+		LIMIT ?`, limit)
+}
+
+// Чарт берётся из track_chart; пока его ни разу не пересчитали - треки с наибольшим числом прослушиваний
+func (repo *SQLTrackRepo) ListChart(ctx context.Context, limit int) ([]models.TrackResponse, error) {
+	tracks, err := repo.list(ctx, `
+		SELECT `+trackColumns+trackFrom+`
+		JOIN track_chart c ON c.track_id = t.id
+		WHERE `+publicTrackCondition+`
+		ORDER BY c.position
+		LIMIT ?`, limit)
+	if err != nil || len(tracks) > 0 {
+		return tracks, err
+	}
+	return repo.list(ctx, `
+		SELECT `+trackColumns+trackFrom+`
+		WHERE `+publicTrackCondition+`
+		ORDER BY t.stream_count DESC
+		LIMIT ?`, limit)
+}
+
+func (repo *SQLTrackRepo) Search(ctx context.Context, query string, limit int) ([]models.TrackResponse, error) {
+	likePattern := "%" + strings.ToLower(query) + "%"
+	return repo.list(ctx, `
+		SELECT `+trackColumns+trackFrom+`
+		WHERE (t.title_lower LIKE ? OR m.name_lower LIKE ?)
+		AND `+publicTrackCondition+`
+		LIMIT ?`, likePattern, likePattern, limit)
+}
+
+func (repo *SQLTrackRepo) ListRecommended(ctx context.Context, userID string, limit int) ([]models.TrackResponse, error) {
+	return repo.list(ctx, `
+		SELECT `+trackColumns+trackFrom+`
+		WHERE `+publicTrackCondition+` AND EXISTS (
+			SELECT 1 FROM musician_genre mg
+			JOIN user_genre ug ON ug.genre_id = mg.genre_id
+			WHERE mg.musician_id = m.id AND ug.user_id = ?)
+		ORDER BY RAND()
+		LIMIT ?`, userID, limit)
+}
+
+func (repo *SQLTrackRepo) ListLiked(ctx context.Context, userID string, limit int) ([]models.TrackResponse, error) {
+	query := `
+		SELECT ` + trackColumns + trackFrom + `
+		JOIN liked_tracks lt ON lt.track_id = t.id
+		WHERE lt.user_id = ? AND ` + publicTrackCondition
+	if limit <= 0 {
+		return repo.list(ctx, query, userID)
+	}
+	return repo.list(ctx, query+` LIMIT ?`, userID, limit)
+}
+
+func (repo *SQLTrackRepo) ListPopularByMusician(ctx context.Context, musicianID string, limit int) ([]models.TrackResponse, error) {
+	return repo.list(ctx, `
+		SELECT `+trackColumns+trackFrom+`
+		WHERE t.musician_id = ? AND `+publicTrackCondition+`
+		ORDER BY t.stream_count DESC
+		LIMIT ?`, musicianID, limit)
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Edafi/MusicVibe/models"
+)
+
+// UserRepo - учётные записи для администрирования
+type UserRepo interface {
+	List(ctx context.Context) ([]models.User, error)
+	Get(ctx context.Context, userID string) (models.User, error)
+	Create(ctx context.Context, user models.User) error
+	// Update возвращает ErrNotFound, если пользователя нет
+	Update(ctx context.Context, userID string, user models.User) error
+	Delete(ctx context.Context, userID string) error
+}
+
+type SQLUserRepo struct {
+	DB Querier
+}
+
+var _ UserRepo = (*SQLUserRepo)(nil)
+
+const userColumns = `id, email, passwd_hash, role, username, avatar_path, creation_date`
+
+func userScanTargets(user *models.User) []interface{} {
+	return []interface{}{
+		&user.ID, &user.Email, &user.PasswdHash, &user.Role, &user.Username, &user.AvatarPath, &user.CreationDate,
+	}
+}
+
+func (repo *SQLUserRepo) List(ctx context.Context) ([]models.User, error) {
+	rows, err := repo.DB.QueryContext(ctx, `SELECT `+userColumns+` FROM user`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(userScanTargets(&user)...); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (repo *SQLUserRepo) Get(ctx context.Context, userID string) (models.User, error) {
+	var user models.User
+	err := repo.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM user WHERE id = ?`, userID).
+		Scan(userScanTargets(&user)...)
+	if err != nil {
+		return models.User{}, notFound(err)
+	}
+	return user, nil
+}
+
+func (repo *SQLUserRepo) Create(ctx context.Context, user models.User) error {
+	_, err := repo.DB.ExecContext(ctx, `
+		INSERT INTO user (id, email, passwd_hash, role, username, avatar_path)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		user.ID, user.Email, user.PasswdHash, user.Role, user.Username, user.AvatarPath)
+	return err
+}
+
+func (repo *SQLUserRepo) Update(ctx context.Context, userID string, user models.User) error {
+	result, err := repo.DB.ExecContext(ctx, `
+		UPDATE user SET email = ?, passwd_hash = ?, role = ?, username = ?, avatar_path = ?
+		WHERE id = ?`,
+		user.Email, user.PasswdHash, user.Role, user.Username, user.AvatarPath, userID)
+	if err != nil {
+		return err
+	}
+	// Без изменённых строк отличаем "нет пользователя" от "значения не изменились"
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		var exists bool
+		if err := repo.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM user WHERE id = ?)`, userID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+func (repo *SQLUserRepo) Delete(ctx context.Context, userID string) error {
+	_, err := repo.DB.ExecContext(ctx, `DELETE FROM user WHERE id = ?`, userID)
+	return err
+}
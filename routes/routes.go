@@ -4,47 +4,155 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Edafi/MusicVibe/audit"
+	"github.com/Edafi/MusicVibe/config"
 	"github.com/Edafi/MusicVibe/handlers"
+	"github.com/Edafi/MusicVibe/jwtkeys"
+	"github.com/Edafi/MusicVibe/loginguard"
+	"github.com/Edafi/MusicVibe/mailer"
+	"github.com/Edafi/MusicVibe/mediasign"
+	"github.com/Edafi/MusicVibe/mediaurl"
+	"github.com/Edafi/MusicVibe/metrics"
 	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/oidc"
+	"github.com/Edafi/MusicVibe/reconcile"
+	"github.com/Edafi/MusicVibe/repository"
+	"github.com/Edafi/MusicVibe/storage"
 	"github.com/gorilla/mux"
-	"github.com/minio/minio-go/v7"
 	"github.com/rs/cors"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func SetupRoutes(db *sql.DB, mongoDatabase *mongo.Database, minioClient *minio.Client) http.Handler {
+func SetupRoutes(cfg *config.Config, db *sql.DB, mongoDatabase *mongo.Database, store storage.BlobStore, keys *jwtkeys.KeySet, mail mailer.Mailer, oidcProviders *oidc.Registry, mediaSigner *mediasign.Signer, reconciler *reconcile.Reconciler, shuttingDown <-chan struct{}) http.Handler {
 	router := mux.NewRouter()
-
-	// обработчики пользователя
-	userHandler := &handlers.UserHandler{DB: db}
-	router.HandleFunc("/users", userHandler.GetUsers).Methods("GET")
-	router.HandleFunc("/user/{id}", userHandler.GetUser).Methods("GET")
-	router.HandleFunc("/users", userHandler.CreateUser).Methods("POST")
-	router.HandleFunc("/users/{id}", userHandler.UpdateUser).Methods("PUT")
-	router.HandleFunc("/users/{id}", userHandler.DeleteUser).Methods("DELETE")
+	router.Use(metrics.HTTPMiddleware)
+
+	// Ссылки на /media, которые отдают обработчики
+	media := mediaurl.New(cfg.Server.PublicBaseURL, cfg.Media.CDNBaseURL, cfg.MinIO.Bucket, mediaSigner)
+
+	// SQL-доступ к каталогу и библиотеке пользователя
+	users := &repository.SQLUserRepo{DB: db}
+	tracks := &repository.SQLTrackRepo{DB: db}
+	albums := &repository.SQLAlbumRepo{DB: db}
+	musicians := &repository.SQLMusicianRepo{DB: db}
+	library := &repository.SQLLibraryRepo{DB: db}
+	catalog := &repository.SQLCatalogRepo{DB: db}
+
+	// Проверки для балансировщика и оркестратора, без аутентификации
+	healthHandler := &handlers.HealthHandler{
+		DB:           db,
+		MongoClient:  mongoDatabase.Client(),
+		Store:        store,
+		ShuttingDown: shuttingDown,
+	}
+	router.HandleFunc("/healthz", healthHandler.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", healthHandler.Readyz).Methods("GET")
+	router.Handle("/metrics", metrics.Handler(cfg.Metrics.Token)).Methods("GET")
 
 	secured := router.PathPrefix("/").Subrouter()
-	secured.Use(middleware.JWTMiddleware)
+	authenticator := &middleware.Authenticator{DB: db, Keys: keys}
+	secured.Use(authenticator.JWTMiddleware)
+	// Личные токены доступа пускаются только на маршруты, обёрнутые в middleware.WithScope
+
+	// обработчики пользователя (администрирование)
+	userHandler := &handlers.UserHandler{Users: users}
+	secured.Handle("/users", middleware.RequirePermission(middleware.PermissionManageUsers, userHandler.GetUsers)).Methods("GET")
+	secured.Handle("/user/{id}", middleware.RequirePermission(middleware.PermissionManageUsers, userHandler.GetUser)).Methods("GET")
+	secured.Handle("/users", middleware.RequirePermission(middleware.PermissionManageUsers, userHandler.CreateUser)).Methods("POST")
+	secured.Handle("/users/{id}", middleware.RequirePermission(middleware.PermissionManageUsers, userHandler.UpdateUser)).Methods("PUT")
+	secured.Handle("/users/{id}", middleware.RequirePermission(middleware.PermissionManageUsers, userHandler.DeleteUser)).Methods("DELETE")
+
+	// сверка хранилища с БД (администрирование)
+	storageAdminHandler := &handlers.StorageAdminHandler{Reconciler: reconciler}
+	secured.Handle("/admin/storage/reconcile", middleware.RequirePermission(middleware.PermissionManageStorage, storageAdminHandler.GetStorageReport)).Methods("GET")
+	secured.Handle("/admin/storage/reconcile", middleware.RequirePermission(middleware.PermissionManageStorage, storageAdminHandler.ReconcileStorage)).Methods("POST")
 
 	// жанровые обработчики
 	genreHandler := &handlers.GenreHandler{DB: db}
-	secured.HandleFunc("/genres", genreHandler.GetGenres).Methods("GET")
+	secured.Handle("/genres", middleware.WithScope(middleware.ScopeReadCatalog, genreHandler.GetGenres)).Methods("GET")
 	secured.HandleFunc("/user/genres", genreHandler.PostUserGenres).Methods("POST")
 
 	// обработчики музыкантов
-	musicianHandler := &handlers.MusicianHandler{DB: db}
-	secured.HandleFunc("/musicians", musicianHandler.GetMusicians).Methods("GET")
+	musicianHandler := &handlers.MusicianHandler{
+		Musicians: musicians,
+		Albums:    albums,
+		Tracks:    tracks,
+		Library:   library,
+		Media:     media,
+	}
+	secured.Handle("/musicians", middleware.WithScope(middleware.ScopeReadCatalog, musicianHandler.GetMusicians)).Methods("GET")
 	secured.HandleFunc("/user/following", musicianHandler.PostUserFollowing).Methods("POST")
-	secured.HandleFunc("/musician/{id}", musicianHandler.GetMusician).Methods("GET")
-	secured.HandleFunc("/musician/{id}/popular-tracks", musicianHandler.GetPopularTracks).Methods("GET")
+	secured.Handle("/musician/{id}", middleware.WithScope(middleware.ScopeReadCatalog, musicianHandler.GetMusician)).Methods("GET")
+	secured.Handle("/musician/{id}/popular-tracks", middleware.WithScope(middleware.ScopeReadCatalog, musicianHandler.GetPopularTracks)).Methods("GET")
 
 	// обработчики регистрации/логина
-	authHandler := &handlers.AuthHandler{DB: db}
+	authHandler := &handlers.AuthHandler{
+		DB:     db,
+		Keys:   keys,
+		Mailer: mail,
+		Guard:  &loginguard.Guard{Store: &loginguard.SQLStore{DB: db}},
+		Audit:  &audit.SQLLogger{DB: db},
+		OIDC:   oidcProviders,
+		AppURL: cfg.Server.AppURL,
+		Media:  media,
+	}
 	router.HandleFunc("/register", authHandler.Register).Methods("POST")
 	router.HandleFunc("/login", authHandler.Login).Methods("POST")
+	router.HandleFunc("/auth/refresh", authHandler.Refresh).Methods("POST")
+	router.HandleFunc("/.well-known/jwks.json", authHandler.JWKS).Methods("GET")
+	router.HandleFunc("/auth/email/verify", authHandler.VerifyEmail).Methods("POST")
+	router.HandleFunc("/auth/password/forgot", authHandler.ForgotPassword).Methods("POST")
+	router.HandleFunc("/auth/password/reset", authHandler.ResetPassword).Methods("POST")
+	router.HandleFunc("/auth/2fa/verify", authHandler.VerifyTwoFactor).Methods("POST")
+	router.HandleFunc("/auth/oidc/providers", authHandler.GetOIDCProviders).Methods("GET")
+	router.HandleFunc("/auth/oidc/{provider}/login", authHandler.OIDCLogin).Methods("GET")
+	router.HandleFunc("/auth/oidc/{provider}/callback", authHandler.OIDCCallback).Methods("GET")
 	secured.HandleFunc("/auth/me", authHandler.Me).Methods("GET")
-
-	homeHandler := &handlers.HomeHandler{DB: db}
+	secured.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
+	secured.HandleFunc("/auth/sessions", authHandler.GetSessions).Methods("GET")
+	secured.HandleFunc("/auth/sessions", authHandler.RevokeOtherSessions).Methods("DELETE")
+	secured.HandleFunc("/auth/sessions/{id}", authHandler.RevokeSession).Methods("DELETE")
+	secured.HandleFunc("/auth/email/resend", authHandler.ResendVerificationEmail).Methods("POST")
+	secured.HandleFunc("/auth/password/change", authHandler.ChangePassword).Methods("POST")
+	secured.HandleFunc("/auth/2fa/enroll", authHandler.EnrollTwoFactor).Methods("POST")
+	secured.HandleFunc("/auth/2fa/confirm", authHandler.ConfirmTwoFactor).Methods("POST")
+	secured.HandleFunc("/auth/2fa/disable", authHandler.DisableTwoFactor).Methods("POST")
+	secured.HandleFunc("/auth/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes).Methods("POST")
+	secured.HandleFunc("/auth/tokens", authHandler.GetAPITokens).Methods("GET")
+	secured.HandleFunc("/auth/tokens", authHandler.CreateAPIToken).Methods("POST")
+	secured.HandleFunc("/auth/tokens/{id}", authHandler.RevokeAPIToken).Methods("DELETE")
+
+	artistHandler := &handlers.ArtistHandler{
+		DB:            db,
+		Store:         store,
+		Bucket:        cfg.MinIO.Bucket,
+		MaxImageBytes: cfg.Limits.ImageUploadBytes,
+		Media:         media,
+	}
+	secured.HandleFunc("/artists", artistHandler.CreateArtist).Methods("POST")
+	secured.HandleFunc("/artists/mine", artistHandler.GetMyArtists).Methods("GET")
+	secured.HandleFunc("/artists/{id}", artistHandler.UpdateArtist).Methods("PATCH")
+	secured.Handle("/artists/{id}/stats", middleware.WithScope(middleware.ScopeReadStats, artistHandler.GetArtistStats)).Methods("GET")
+
+	profileImageHandler := &handlers.ProfileImageHandler{
+		DB:            db,
+		Store:         store,
+		Bucket:        cfg.MinIO.Bucket,
+		MaxImageBytes: cfg.Limits.ImageUploadBytes,
+		Media:         media,
+	}
+	secured.HandleFunc("/user/avatar", profileImageHandler.UploadUserAvatar).Methods("PUT")
+	secured.HandleFunc("/user/background", profileImageHandler.UploadUserBackground).Methods("PUT")
+	secured.HandleFunc("/artists/{id}/avatar", profileImageHandler.UploadArtistAvatar).Methods("PUT")
+	secured.HandleFunc("/artists/{id}/background", profileImageHandler.UploadArtistBackground).Methods("PUT")
+
+	socialLinkHandler := &handlers.SocialLinkHandler{DB: db}
+	secured.HandleFunc("/social-networks", socialLinkHandler.GetSocialNetworks).Methods("GET")
+	secured.HandleFunc("/user/social-links", socialLinkHandler.GetSocialLinks).Methods("GET")
+	secured.HandleFunc("/user/social-links/{network}", socialLinkHandler.PutSocialLink).Methods("PUT")
+	secured.HandleFunc("/user/social-links/{network}", socialLinkHandler.DeleteSocialLink).Methods("DELETE")
+
+	homeHandler := &handlers.HomeHandler{Tracks: tracks, Albums: albums, Media: media}
 	secured.HandleFunc("/tracks/recommended", homeHandler.GetRecommendedTracks).Methods("GET")
 	secured.HandleFunc("/albums/recommended", homeHandler.GetRecommendedAlbums).Methods("GET")
 	secured.HandleFunc("/tracks/tracked", homeHandler.GetTrackedTracks).Methods("GET")
@@ -52,45 +160,70 @@ func SetupRoutes(db *sql.DB, mongoDatabase *mongo.Database, minioClient *minio.C
 	secured.HandleFunc("/home/albums/recommended", homeHandler.GetHomeRecommendedAlbums).Methods("GET")
 	secured.HandleFunc("/home/tracks/tracked", homeHandler.GetHomeTrackedTracks).Methods("GET")
 
-	searchHandler := &handlers.SearchHandler{DB: db}
-	secured.HandleFunc("/tracks/new", searchHandler.GetNewTracks).Methods("GET")
-	secured.HandleFunc("/tracks/chart", searchHandler.GetChartTracks).Methods("GET")
-	secured.HandleFunc("/tracks/search", searchHandler.SearchTracks).Methods("GET")
+	searchHandler := &handlers.SearchHandler{Tracks: tracks, Media: media}
+	secured.Handle("/tracks/new", middleware.WithScope(middleware.ScopeReadCatalog, searchHandler.GetNewTracks)).Methods("GET")
+	secured.Handle("/tracks/chart", middleware.WithScope(middleware.ScopeReadCatalog, searchHandler.GetChartTracks)).Methods("GET")
+	secured.Handle("/tracks/search", middleware.WithScope(middleware.ScopeReadCatalog, searchHandler.SearchTracks)).Methods("GET")
 
-	trackHandler := &handlers.TrackHandler{DB: db}
-	secured.HandleFunc("/track/{id}", trackHandler.GetTrack).Methods("GET")
+	trackHandler := &handlers.TrackHandler{Tracks: tracks, Media: media}
+	secured.Handle("/track/{id}", middleware.WithScope(middleware.ScopeReadCatalog, trackHandler.GetTrack)).Methods("GET")
 
-	commentHandler := &handlers.CommentHandler{DB: db, MongoDatabase: mongoDatabase}
-	secured.HandleFunc("/comments/track/{id}", commentHandler.GetTrackComments).Methods("GET")
+	commentHandler := &handlers.CommentHandler{DB: db, MongoDatabase: mongoDatabase, Tracks: tracks, Media: media}
+	secured.Handle("/comments/track/{id}", middleware.WithScope(middleware.ScopeReadCatalog, commentHandler.GetTrackComments)).Methods("GET")
 	secured.HandleFunc("/comments/track/{id}", commentHandler.PostTrackComment).Methods("POST")
-
-	albumHandler := &handlers.AlbumHandler{DB: db}
-	secured.HandleFunc("/album/{id}", albumHandler.GetAlbum).Methods("GET")
-	secured.HandleFunc("/album/{id}/tracks", albumHandler.GetAlbumTracks).Methods("GET")
-
-	favorites := &handlers.FavoritesHandler{DB: db}
-	secured.HandleFunc("/favorites", favorites.GetFavoriteTracks).Methods("GET")
-	secured.HandleFunc("/favorites/{id}", favorites.AddFavoriteTrack).Methods("POST")
-	secured.HandleFunc("/favorites/{id}", favorites.DeleteFavoriteTrack).Methods("DELETE")
-	secured.HandleFunc("/favorites/albums", favorites.GetFavoriteAlbums).Methods("GET")
-	secured.HandleFunc("/favorites/albums/{id}", favorites.AddFavoriteAlbum).Methods("POST")
-	secured.HandleFunc("/favorites/albums/{id}", favorites.DeleteFavoriteAlbum).Methods("DELETE")
-
-	following := &handlers.FollowingHandler{DB: db}
-	secured.HandleFunc("/following", following.GetFollowingMusicians).Methods("GET")
-	secured.HandleFunc("/following/{id}", following.FollowMusician).Methods("POST")
-	secured.HandleFunc("/following/{id}", following.UnfollowMusician).Methods("DELETE")
-
-	uploadHandler := &handlers.UploadHandler{DB: db, MinioClient: minioClient}
-	secured.HandleFunc("/upload/album", uploadHandler.UploadAlbum).Methods("POST")
-
-	mediaHandler := &handlers.MediaHandler{MinioClient: minioClient, BucketName: "music", DB: db}
+	secured.Handle("/comments/{id}", middleware.RequirePermission(middleware.PermissionModerateComments, commentHandler.DeleteComment)).Methods("DELETE")
+
+	albumHandler := &handlers.AlbumHandler{Albums: albums, Tracks: tracks, Media: media}
+	secured.Handle("/album/{id}", middleware.WithScope(middleware.ScopeReadCatalog, albumHandler.GetAlbum)).Methods("GET")
+	secured.Handle("/album/{id}/tracks", middleware.WithScope(middleware.ScopeReadCatalog, albumHandler.GetAlbumTracks)).Methods("GET")
+
+	catalogEditHandler := &handlers.CatalogEditHandler{
+		Catalog:       catalog,
+		MongoDatabase: mongoDatabase,
+		Store:         store,
+		Bucket:        cfg.MinIO.Bucket,
+		MaxImageBytes: cfg.Limits.ImageUploadBytes,
+		Media:         media,
+	}
+	publish := func(next http.HandlerFunc) http.HandlerFunc {
+		return middleware.RequirePermission(middleware.PermissionPublishCatalog, next)
+	}
+	secured.Handle("/album/{id}", middleware.WithScope(middleware.ScopeWriteUpload, publish(catalogEditHandler.UpdateAlbum))).Methods("PATCH")
+	secured.Handle("/album/{id}/cover", middleware.WithScope(middleware.ScopeWriteUpload, publish(catalogEditHandler.ReplaceAlbumCover))).Methods("PUT")
+	secured.Handle("/album/{id}", publish(catalogEditHandler.DeleteAlbum)).Methods("DELETE")
+	secured.Handle("/track/{id}", middleware.WithScope(middleware.ScopeWriteUpload, publish(catalogEditHandler.UpdateTrack))).Methods("PATCH")
+	secured.Handle("/track/{id}", publish(catalogEditHandler.DeleteTrack)).Methods("DELETE")
+
+	favorites := &handlers.FavoritesHandler{Library: library, Tracks: tracks}
+	secured.Handle("/favorites", middleware.WithScope(middleware.ScopeReadLibrary, favorites.GetFavoriteTracks)).Methods("GET")
+	secured.Handle("/favorites/{id}", middleware.WithScope(middleware.ScopeWriteLibrary, favorites.AddFavoriteTrack)).Methods("POST")
+	secured.Handle("/favorites/{id}", middleware.WithScope(middleware.ScopeWriteLibrary, favorites.DeleteFavoriteTrack)).Methods("DELETE")
+	secured.Handle("/favorites/albums", middleware.WithScope(middleware.ScopeReadLibrary, favorites.GetFavoriteAlbums)).Methods("GET")
+	secured.Handle("/favorites/albums/{id}", middleware.WithScope(middleware.ScopeWriteLibrary, favorites.AddFavoriteAlbum)).Methods("POST")
+	secured.Handle("/favorites/albums/{id}", middleware.WithScope(middleware.ScopeWriteLibrary, favorites.DeleteFavoriteAlbum)).Methods("DELETE")
+
+	following := &handlers.FollowingHandler{Library: library}
+	secured.Handle("/following", middleware.WithScope(middleware.ScopeReadLibrary, following.GetFollowingMusicians)).Methods("GET")
+	secured.Handle("/following/{id}", middleware.WithScope(middleware.ScopeWriteLibrary, following.FollowMusician)).Methods("POST")
+	secured.Handle("/following/{id}", middleware.WithScope(middleware.ScopeWriteLibrary, following.UnfollowMusician)).Methods("DELETE")
+
+	uploadHandler := &handlers.UploadHandler{
+		DB:             db,
+		Store:          store,
+		Bucket:         cfg.MinIO.Bucket,
+		MaxUploadBytes: cfg.Limits.AlbumUploadBytes,
+		MaxImageBytes:  cfg.Limits.ImageUploadBytes,
+	}
+	secured.Handle("/upload/album", middleware.WithScope(middleware.ScopeWriteUpload, publish(uploadHandler.UploadAlbum))).Methods("POST")
+
+	mediaHandler := &handlers.MediaHandler{Store: store, Tracks: tracks, Albums: albums, Signer: mediaSigner}
 	router.HandleFunc("/media/audio/{trackId}", mediaHandler.ServeAudio).Methods("GET")
 	router.HandleFunc("/media/image/{filename}", mediaHandler.ServeImage).Methods("GET")
+	router.HandleFunc("/media/image/{kind}/{id}", mediaHandler.ServeImageByKind).Methods("GET")
 	// CORS
 	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedOrigins: cfg.Server.CORSOrigins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
 		AllowedHeaders: []string{"Content-Type", "Authorization"},
 		Debug:          false,
 	})
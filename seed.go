@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Edafi/MusicVibe/handlers"
+	"github.com/Edafi/MusicVibe/imageproc"
+	"github.com/Edafi/MusicVibe/middleware"
+	"github.com/Edafi/MusicVibe/storage"
+	"github.com/google/uuid"
+)
+
+// Демо-данные для локальной разработки. Повторный запуск ничего не дублирует
+var seedGenres = []string{"Pop", "Rock", "Hip-Hop", "Electronic", "Jazz", "Classical", "Metal", "Indie", "R&B", "Folk"}
+
+var seedSocialNetworks = []string{"VK", "Telegram", "YouTube", "Instagram", "SoundCloud"}
+
+var seedTracks = []struct {
+	Title   string
+	Seconds int
+}{
+	{"Morning Static", 12},
+	{"Quiet Signal", 9},
+	{"Long Way Home", 15},
+}
+
+const (
+	seedListenerEmail = "listener@demo.musicvibe"
+	seedMusicianEmail = "artist@demo.musicvibe"
+	seedArtistName    = "Demo Artist"
+	seedAlbumTitle    = "First Light"
+	seedGenre         = "Electronic"
+)
+
+func seedCommand(ctx context.Context, app *App, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	password := flags.String("password", "demo12345", "password for the demo users")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	for _, name := range seedGenres {
+		if _, err := app.DB.ExecContext(ctx, `INSERT IGNORE INTO genre (name) VALUES (?)`, name); err != nil {
+			return err
+		}
+	}
+	for _, name := range seedSocialNetworks {
+		if _, err := app.DB.ExecContext(ctx, `INSERT IGNORE INTO social_network (name) VALUES (?)`, name); err != nil {
+			return err
+		}
+	}
+	var genreID int
+	if err := app.DB.QueryRowContext(ctx, `SELECT id FROM genre WHERE name = ?`, seedGenre).Scan(&genreID); err != nil {
+		return err
+	}
+
+	listenerID, err := seedUser(ctx, app.DB, "demo_listener", seedListenerEmail, *password, middleware.RoleUser)
+	if err != nil {
+		return err
+	}
+	if _, err := app.DB.ExecContext(ctx, `INSERT IGNORE INTO user_genre (user_id, genre_id) VALUES (?, ?)`, listenerID, genreID); err != nil {
+		return err
+	}
+	artistUserID, err := seedUser(ctx, app.DB, "demo_artist", seedMusicianEmail, *password, middleware.RoleMusician)
+	if err != nil {
+		return err
+	}
+
+	var musicianID string
+	err = app.DB.QueryRowContext(ctx, `SELECT id FROM musician WHERE user_id = ?`, artistUserID).Scan(&musicianID)
+	if err == nil {
+		log.Println("Demo data already present, musician", musicianID)
+		return nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return seedCatalog(ctx, app, artistUserID, genreID)
+}
+
+// seedUser возвращает id существующего пользователя с этой почтой или создаёт нового
+func seedUser(ctx context.Context, db *sql.DB, username, email, password, role string) (string, error) {
+	var userID string
+	err := db.QueryRowContext(ctx, `SELECT id FROM user WHERE email = ?`, email).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	userID, err = insertUser(ctx, db, username, email, password, role)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Demo user %s created", email)
+	return userID, nil
+}
+
+// Музыкант, альбом с обложкой и треки с тишиной вместо аудио
+func seedCatalog(ctx context.Context, app *App, userID string, genreID int) (err error) {
+	bucket := app.Config.MinIO.Bucket
+	musicianID := uuid.New().String()
+	albumID := uuid.New().String()
+	dir := storage.MusicianDir(musicianID)
+
+	// Файлы загружаются до коммита, чтобы строки не ссылались на отсутствующие объекты.
+	// Если до коммита не дошло, всё загруженное в каталог нового музыканта удаляется
+	defer func() {
+		if err != nil {
+			removeSeedObjects(app.Store, dir)
+		}
+	}()
+
+	coverPath, err := handlers.StoreImageVariants(ctx, app.Store, bucket, dir, storage.KindCover, albumID, seedCover(), imageproc.CoverVariants)
+	if err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO musician (id, user_id, name, avatar_path, name_lower, description)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		musicianID, userID, seedArtistName, "/avatarUser/defaultAvatar.png", strings.ToLower(seedArtistName), "Demo artist created by the seed command")
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `INSERT INTO musician_genre (musician_id, genre_id) VALUES (?, ?)`, musicianID, genreID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO album (id, musician_id, title, release_date, cover_path, genre_id, description, title_lower)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		albumID, musicianID, seedAlbumTitle, time.Now().Format("2006-01-02"), coverPath,
+		genreID, "Demo album", strings.ToLower(seedAlbumTitle))
+	if err != nil {
+		return err
+	}
+
+	for _, track := range seedTracks {
+		trackID := uuid.New().String()
+		audio := silentMP3(track.Seconds)
+		audioKey := storage.TrackAudioKey(musicianID, trackID)
+		if err = app.Store.Put(ctx, audioKey, bytes.NewReader(audio), int64(len(audio)), "audio/mpeg"); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO track (id, title, album_id, musician_id, file_path, genre_id, duration, stream_count, visibility, title_lower)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			trackID, track.Title, albumID, musicianID, storage.StoredPath(bucket, audioKey), genreID,
+			track.Seconds, 0, "public", strings.ToLower(track.Title))
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Demo artist %q with album %q and %d tracks created", seedArtistName, seedAlbumTitle, len(seedTracks))
+	return nil
+}
+
+// Контекст свой: очистка нужна и тогда, когда сид прерван отменой ctx
+func removeSeedObjects(store storage.BlobStore, dir string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	objects, err := store.List(ctx, dir+"/")
+	if err != nil {
+		log.Println("seed: list uploaded objects error:", err)
+		return
+	}
+	for _, object := range objects {
+		if err := store.Delete(ctx, object.Key); err != nil {
+			log.Println("seed: remove object error:", object.Key, err)
+		}
+	}
+}
+
+// Градиент 600x600 вместо настоящей обложки
+func seedCover() image.Image {
+	const size = 600
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / size), G: 64, B: uint8(y * 255 / size), A: 255})
+		}
+	}
+	return img
+}
+
+// silentMP3 - тишина заданной длительности: кадры MPEG-1 Layer III, 128 кбит/с, 44.1 кГц
+// (417 байт и ~26 мс на кадр) с нулевыми данными
+func silentMP3(seconds int) []byte {
+	const frameSize = 417
+	frames := seconds * 44100 / 1152
+	data := make([]byte, 0, frames*frameSize)
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, frameSize)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0xC4})
+		data = append(data, frame...)
+	}
+	return data
+}
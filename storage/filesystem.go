@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileStore хранит объекты файлами в каталоге Root - для локальной разработки без MinIO.
+// Тип содержимого определяется по расширению ключа
+type FileStore struct {
+	Root string
+}
+
+var _ BlobStore = (*FileStore)(nil)
+
+func NewFileStore(root string) (*FileStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("storage: create %s: %w", root, err)
+	}
+	return &FileStore{Root: root}, nil
+}
+
+// Ключ не должен выходить за пределы Root
+func (s *FileStore) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+func (s *FileStore) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.Root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage: %s is not a directory", s.Root)
+	}
+	return nil
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	// Пишем во временный файл и переименовываем, чтобы читатели не видели недописанный объект
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("storage: %s: wrote %d bytes, expected %d", key, written, size)
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+type fileObject struct {
+	*os.File
+	info ObjectInfo
+}
+
+func (o *fileObject) Info() ObjectInfo {
+	return o.info
+}
+
+func (s *FileStore) Open(ctx context.Context, key string) (Object, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, fileError(err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileObject{File: file, info: fileInfo(key, stat)}, nil
+}
+
+func (s *FileStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	obj, err := s.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := obj.Seek(offset, io.SeekStart); err != nil {
+		obj.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return obj, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(obj, length), obj}, nil
+}
+
+func (s *FileStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	stat, err := os.Stat(target)
+	if err != nil {
+		return ObjectInfo{}, fileError(err)
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return fileInfo(key, stat), nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.Root, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Root, current)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, fileInfo(key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Обход идёт по каталогам ("a/b" раньше "a.txt"), а MinIO перечисляет в порядке ключей
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *FileStore) Presign(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+func fileInfo(key string, stat fs.FileInfo) ObjectInfo {
+	// ETag нужен только для условных запросов, поэтому достаточно размера и времени изменения
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", key, stat.Size(), stat.ModTime().UnixNano())))
+	return ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  contentTypeFor(key),
+		ETag:         hex.EncodeToString(sum[:16]),
+		LastModified: stat.ModTime(),
+	}
+}
+
+func contentTypeFor(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+func fileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Раскладка ключей в хранилище. В БД пути хранятся как /<bucket>/<key>.
+//
+//	musician_<id>/tracks/track_<trackId>.mp3
+//	musician_<id>/cover/album_<albumId>[_<size>].jpg|.webp
+//	musician_<id>/avatar/avatar_<id>[_<size>].jpg|.webp
+//	musician_<id>/background/background_<id>[_<size>].jpg|.webp
+//	user_<id>/avatar/..., user_<id>/background/... - так же, как у музыканта
+
+const (
+	KindAvatar     = "avatar"
+	KindBackground = "background"
+	KindCover      = "cover"
+)
+
+func MusicianDir(musicianID string) string {
+	return "musician_" + musicianID
+}
+
+func UserDir(userID string) string {
+	return "user_" + userID
+}
+
+func TrackAudioKey(musicianID, trackID string) string {
+	return fmt.Sprintf("%s/tracks/track_%s.mp3", MusicianDir(musicianID), trackID)
+}
+
+// ImageKey - ключ JPEG-варианта; size == "" - основной объект (самый крупный размер).
+// Обложки исторически называются album_<id>.jpg
+func ImageKey(dir, kind, id, size string) string {
+	prefix := kind
+	if kind == KindCover {
+		prefix = "album"
+	}
+	key := fmt.Sprintf("%s/%s/%s_%s", dir, kind, prefix, id)
+	if size != "" {
+		key += "_" + size
+	}
+	return key + ".jpg"
+}
+
+// ImagePrefix покрывает основной объект и все его варианты
+func ImagePrefix(dir, kind, id string) string {
+	return strings.TrimSuffix(ImageKey(dir, kind, id, ""), ".jpg")
+}
+
+func WebPKey(jpegKey string) string {
+	return strings.TrimSuffix(jpegKey, ".jpg") + ".webp"
+}
+
+func StoredPath(bucket, key string) string {
+	return "/" + bucket + "/" + key
+}
+
+// KeyFromStoredPath - обратное к StoredPath; false, если путь не из этого бакета
+func KeyFromStoredPath(bucket, path string) (string, bool) {
+	key, found := strings.CutPrefix(path, "/"+bucket+"/")
+	return key, found && key != ""
+}
+
+// ParseImageKey разбирает ключ основного изображения: владелец ("musician" или "user"),
+// вид изображения и id из имени файла
+func ParseImageKey(key string) (owner, kind, id string, ok bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	dir, kind, file := parts[0], parts[1], strings.TrimSuffix(parts[2], ".jpg")
+
+	_, id, found := strings.Cut(file, "_")
+	if !found || id == "" {
+		return "", "", "", false
+	}
+	switch {
+	case strings.HasPrefix(dir, "musician_") && (kind == KindAvatar || kind == KindBackground || kind == KindCover):
+		return "musician", kind, id, true
+	case strings.HasPrefix(dir, "user_") && (kind == KindAvatar || kind == KindBackground):
+		return "user", kind, id, true
+	}
+	return "", "", "", false
+}
+
+// KindTrack - каталог с аудио в раскладке musician_<id>/tracks/
+const KindTrack = "tracks"
+
+// ObjectRef - кому принадлежит объект хранилища по раскладке ключей
+type ObjectRef struct {
+	// "musician" или "user"
+	Owner   string
+	OwnerID string
+	// KindTrack, KindCover, KindAvatar или KindBackground
+	Kind string
+	// Трек, альбом или сам владелец
+	ID string
+}
+
+// ParseObjectKey разбирает любой ключ раскладки, включая варианты размеров и WebP.
+// false - ключ не из раскладки (например, загружен до её появления)
+func ParseObjectKey(key string) (ObjectRef, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return ObjectRef{}, false
+	}
+	dir, kind, file := parts[0], parts[1], parts[2]
+
+	var ref ObjectRef
+	switch {
+	case strings.HasPrefix(dir, "musician_"):
+		ref.Owner, ref.OwnerID = "musician", strings.TrimPrefix(dir, "musician_")
+	case strings.HasPrefix(dir, "user_"):
+		ref.Owner, ref.OwnerID = "user", strings.TrimPrefix(dir, "user_")
+	default:
+		return ObjectRef{}, false
+	}
+
+	filePrefix, extensions := kind+"_", []string{".jpg", ".webp"}
+	switch kind {
+	case KindTrack:
+		filePrefix, extensions = "track_", []string{".mp3"}
+	case KindCover:
+		filePrefix = "album_"
+	case KindAvatar, KindBackground:
+	default:
+		return ObjectRef{}, false
+	}
+	if ref.Owner == "user" && kind != KindAvatar && kind != KindBackground {
+		return ObjectRef{}, false
+	}
+
+	dot := strings.LastIndex(file, ".")
+	if dot < 0 || !slices.Contains(extensions, file[dot:]) {
+		return ObjectRef{}, false
+	}
+	name, found := strings.CutPrefix(file[:dot], filePrefix)
+	if !found {
+		return ObjectRef{}, false
+	}
+	// id - UUID без подчёркиваний, после него может идти _<size>
+	id, _, _ := strings.Cut(name, "_")
+	if id == "" || ref.OwnerID == "" {
+		return ObjectRef{}, false
+	}
+	ref.Kind, ref.ID = kind, id
+	return ref, true
+}
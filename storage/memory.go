@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore держит объекты в памяти - для тестов обработчиков
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryBlob
+	Now     func() time.Time
+}
+
+type memoryBlob struct {
+	data []byte
+	info ObjectInfo
+}
+
+var _ BlobStore = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]memoryBlob)}
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("storage: %s: read %d bytes, expected %d", key, len(data), size)
+	}
+	if contentType == "" {
+		contentType = contentTypeFor(key)
+	}
+	sum := md5.Sum(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryBlob{data: data, info: ObjectInfo{
+		Key:          key,
+		Size:         int64(len(data)),
+		ContentType:  contentType,
+		ETag:         hex.EncodeToString(sum[:]),
+		LastModified: s.now(),
+	}}
+	return nil
+}
+
+func (s *MemoryStore) get(key string) (memoryBlob, error) {
+	if err := checkKey(key); err != nil {
+		return memoryBlob{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blob, ok := s.objects[key]
+	if !ok {
+		return memoryBlob{}, ErrNotFound
+	}
+	return blob, nil
+}
+
+type memoryObject struct {
+	*bytes.Reader
+	info ObjectInfo
+}
+
+func (o *memoryObject) Info() ObjectInfo {
+	return o.info
+}
+
+func (o *memoryObject) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) Open(ctx context.Context, key string) (Object, error) {
+	blob, err := s.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryObject{Reader: bytes.NewReader(blob.data), info: blob.info}, nil
+}
+
+func (s *MemoryStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	blob, err := s.get(key)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(blob.data))
+	if offset < 0 || offset > size {
+		return nil, fmt.Errorf("storage: %s: offset %d out of range", key, offset)
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+	return io.NopCloser(bytes.NewReader(blob.data[offset:end])), nil
+}
+
+func (s *MemoryStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	blob, err := s.get(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return blob.info, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var objects []ObjectInfo
+	for key, blob := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, blob.info)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *MemoryStore) Presign(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+var _ BlobStore = (*MinIOStore)(nil)
+
+type MinIOStore struct {
+	Client *minio.Client
+	Bucket string
+}
+
+func NewMinIO(client *minio.Client, bucket string) *MinIOStore {
+	return &MinIOStore{Client: client, Bucket: bucket}
+}
+
+// EnsureBucket создаёт бакет, если его ещё нет
+func (s *MinIOStore) EnsureBucket(ctx context.Context) (created bool, err error) {
+	exists, err := s.Client.BucketExists(ctx, s.Bucket)
+	if err != nil {
+		return false, fmt.Errorf("storage: check bucket: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+	if err := s.Client.MakeBucket(ctx, s.Bucket, minio.MakeBucketOptions{}); err != nil {
+		return false, fmt.Errorf("storage: create bucket: %w", err)
+	}
+	return true, nil
+}
+
+func (s *MinIOStore) Ping(ctx context.Context) error {
+	exists, err := s.Client.BucketExists(ctx, s.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("storage: bucket %s does not exist", s.Bucket)
+	}
+	return nil
+}
+
+func (s *MinIOStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.Client.PutObject(ctx, s.Bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+type minioObject struct {
+	*minio.Object
+	info ObjectInfo
+}
+
+func (o *minioObject) Info() ObjectInfo {
+	return o.info
+}
+
+func (s *MinIOStore) Open(ctx context.Context, key string) (Object, error) {
+	obj, err := s.Client.GetObject(ctx, s.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minioError(err)
+	}
+	// GetObject ленивый: отсутствие объекта обнаруживается только при Stat
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, minioError(err)
+	}
+	return &minioObject{Object: obj, info: minioInfo(stat)}, nil
+}
+
+func (s *MinIOStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	var err error
+	if length < 0 {
+		err = opts.SetRange(offset, 0)
+	} else if length > 0 {
+		err = opts.SetRange(offset, offset+length-1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	obj, err := s.Client.GetObject(ctx, s.Bucket, key, opts)
+	if err != nil {
+		return nil, minioError(err)
+	}
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, minioError(err)
+	}
+	return obj, nil
+}
+
+func (s *MinIOStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	stat, err := s.Client.StatObject(ctx, s.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, minioError(err)
+	}
+	return minioInfo(stat), nil
+}
+
+func (s *MinIOStore) Delete(ctx context.Context, key string) error {
+	return s.Client.RemoveObject(ctx, s.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *MinIOStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for object := range s.Client.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		objects = append(objects, minioInfo(object))
+	}
+	return objects, nil
+}
+
+func (s *MinIOStore) Presign(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	presigned, err := s.Client.PresignedGetObject(ctx, s.Bucket, key, ttl, nil)
+	if err != nil {
+		return "", err
+	}
+	return presigned.String(), nil
+}
+
+func minioInfo(stat minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          stat.Key,
+		Size:         stat.Size,
+		ContentType:  stat.ContentType,
+		ETag:         stat.ETag,
+		LastModified: stat.LastModified,
+	}
+}
+
+func minioError(err error) error {
+	if code := minio.ToErrorResponse(err).Code; code == "NoSuchKey" || code == "NotFoundObject" {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+// Package storage скрывает, где лежат медиафайлы: в MinIO, на локальном диске
+// (для разработки) или в памяти (для тестов)
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("storage: object not found")
+	// Прямые ссылки умеет выдавать только MinIO; остальные хранилища отдают файлы через API
+	ErrPresignUnsupported = errors.New("storage: presigned URLs are not supported")
+	ErrInvalidKey         = errors.New("storage: invalid object key")
+)
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Object можно отдавать через http.ServeContent: Seek позволяет обслуживать Range-запросы
+type Object interface {
+	io.ReadSeekCloser
+	Info() ObjectInfo
+}
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (Object, error)
+	// GetRange читает length байт начиная с offset; length < 0 - до конца объекта
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Удаление отсутствующего объекта не считается ошибкой
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	Presign(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// Ping проверяет, что хранилище доступно - для проверки готовности сервера
+	Ping(ctx context.Context) error
+}
+
+// Ключ - относительный путь через "/" без пустых, "." и ".." сегментов: так он одинаково
+// адресует объект в MinIO и файл внутри каталога FileStore
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Один набор проверок для всех хранилищ без внешних зависимостей: обработчики и сверка
+// рассчитывают на одинаковое поведение, где бы ни лежали файлы
+func backends(t *testing.T) map[string]BlobStore {
+	files, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]BlobStore{
+		"memory":     NewMemoryStore(),
+		"filesystem": files,
+	}
+}
+
+func put(t *testing.T, store BlobStore, key, data string) {
+	t.Helper()
+	if err := store.Put(context.Background(), key, strings.NewReader(data), int64(len(data)), "audio/mpeg"); err != nil {
+		t.Fatalf("Put(%q): %v", key, err)
+	}
+}
+
+func readAll(t *testing.T, r io.ReadCloser) string {
+	t.Helper()
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range backends(t) {
+		for _, key := range []string{"", "/abs", "..", "../escape", "a/../b", "a//b", "./a", "a/"} {
+			if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("%s: Put(%q) = %v, want ErrInvalidKey", name, key, err)
+			}
+			if _, err := store.Open(ctx, key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("%s: Open(%q) = %v, want ErrInvalidKey", name, key, err)
+			}
+			if _, err := store.Stat(ctx, key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("%s: Stat(%q) = %v, want ErrInvalidKey", name, key, err)
+			}
+			if err := store.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("%s: Delete(%q) = %v, want ErrInvalidKey", name, key, err)
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range backends(t) {
+		key := TrackAudioKey("musician-1", "track-1")
+		put(t, store, key, "0123456789")
+
+		info, err := store.Stat(ctx, key)
+		if err != nil {
+			t.Fatalf("%s: Stat: %v", name, err)
+		}
+		if info.Key != key || info.Size != 10 || info.ContentType != "audio/mpeg" || info.ETag == "" {
+			t.Errorf("%s: Stat = %+v", name, info)
+		}
+
+		object, err := store.Open(ctx, key)
+		if err != nil {
+			t.Fatalf("%s: Open: %v", name, err)
+		}
+		if object.Info().Size != 10 {
+			t.Errorf("%s: Open().Info().Size = %d, want 10", name, object.Info().Size)
+		}
+		// Seek нужен http.ServeContent для Range-запросов
+		if _, err := object.Seek(4, io.SeekStart); err != nil {
+			t.Fatalf("%s: Seek: %v", name, err)
+		}
+		if got := readAll(t, object); got != "456789" {
+			t.Errorf("%s: read after Seek = %q", name, got)
+		}
+
+		for _, tc := range []struct {
+			offset, length int64
+			want           string
+		}{
+			{0, 3, "012"},
+			{7, -1, "789"},
+			{8, 100, "89"},
+		} {
+			reader, err := store.GetRange(ctx, key, tc.offset, tc.length)
+			if err != nil {
+				t.Fatalf("%s: GetRange(%d, %d): %v", name, tc.offset, tc.length, err)
+			}
+			if got := readAll(t, reader); got != tc.want {
+				t.Errorf("%s: GetRange(%d, %d) = %q, want %q", name, tc.offset, tc.length, got, tc.want)
+			}
+		}
+
+		// Повторный Put заменяет объект
+		put(t, store, key, "new")
+		if info, _ := store.Stat(ctx, key); info.Size != 3 {
+			t.Errorf("%s: size after overwrite = %d, want 3", name, info.Size)
+		}
+	}
+}
+
+func TestPutSizeMismatch(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range backends(t) {
+		if err := store.Put(ctx, "short.mp3", strings.NewReader("abc"), 10, ""); err == nil {
+			t.Errorf("%s: Put with wrong size succeeded", name)
+		}
+		if _, err := store.Stat(ctx, "short.mp3"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: object after failed Put: %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestMissingObject(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range backends(t) {
+		if _, err := store.Open(ctx, "missing.mp3"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Open = %v, want ErrNotFound", name, err)
+		}
+		if _, err := store.Stat(ctx, "missing.mp3"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Stat = %v, want ErrNotFound", name, err)
+		}
+		if _, err := store.GetRange(ctx, "missing.mp3", 0, -1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: GetRange = %v, want ErrNotFound", name, err)
+		}
+		if err := store.Delete(ctx, "missing.mp3"); err != nil {
+			t.Errorf("%s: Delete of a missing object = %v, want nil", name, err)
+		}
+		if _, err := store.Presign(ctx, "missing.mp3", 0); !errors.Is(err, ErrPresignUnsupported) {
+			t.Errorf("%s: Presign = %v, want ErrPresignUnsupported", name, err)
+		}
+	}
+}
+
+func TestListAndDelete(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range backends(t) {
+		for _, key := range []string{"a/b.jpg", "a.txt", "a/c/d.jpg", "b/e.jpg"} {
+			put(t, store, key, key)
+		}
+
+		objects, err := store.List(ctx, "a")
+		if err != nil {
+			t.Fatalf("%s: List: %v", name, err)
+		}
+		var keys []string
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+		// Порядок ключей, как у MinIO: "a.txt" < "a/b.jpg"
+		if got, want := strings.Join(keys, ","), "a.txt,a/b.jpg,a/c/d.jpg"; got != want {
+			t.Errorf("%s: List(a) = %s, want %s", name, got, want)
+		}
+
+		if err := store.Delete(ctx, "a/b.jpg"); err != nil {
+			t.Fatalf("%s: Delete: %v", name, err)
+		}
+		if _, err := store.Stat(ctx, "a/b.jpg"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Stat after Delete = %v, want ErrNotFound", name, err)
+		}
+		if objects, _ := store.List(ctx, "a/"); len(objects) != 1 || objects[0].Key != "a/c/d.jpg" {
+			t.Errorf("%s: List(a/) after Delete = %+v", name, objects)
+		}
+		if err := store.Ping(ctx); err != nil {
+			t.Errorf("%s: Ping: %v", name, err)
+		}
+	}
+}
+
+// Недописанные временные файлы не видны как объекты
+func TestFileStoreListSkipsUploads(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	put(t, store, "a/b.jpg", "x")
+	if err := os.WriteFile(filepath.Join(store.Root, "a", ".upload-123"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := store.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "a/b.jpg" {
+		t.Fatalf("List = %+v, want only a/b.jpg", objects)
+	}
+}
@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Ключ из приложения B RFC 6238 ("12345678901234567890") в base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Векторы SHA-1 из RFC 6238; ожидаемые коды - последние 6 из 8 цифр
+func TestCodeRFC6238Vectors(t *testing.T) {
+	for _, tc := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		got, err := Code(rfcSecret, time.Unix(tc.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("Code at %d = %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestValidateSkewWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	for _, tc := range []struct {
+		offset int64
+		want   bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	} {
+		code, err := Code(rfcSecret, now.Add(time.Duration(tc.offset)*Period))
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfcSecret, code, now, 0)
+		if ok != tc.want {
+			t.Errorf("offset %d: ok = %v, want %v", tc.offset, ok, tc.want)
+		}
+		if ok && step != current+tc.offset {
+			t.Errorf("offset %d: step = %d, want %d", tc.offset, step, current+tc.offset)
+		}
+	}
+}
+
+func TestValidateRejectsReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(rfcSecret, code, now, 0)
+	if !ok {
+		t.Fatal("fresh code rejected")
+	}
+	if _, ok := Validate(rfcSecret, code, now, step); ok {
+		t.Error("code accepted again for lastUsedStep == step")
+	}
+	if _, ok := Validate(rfcSecret, code, now, step+1); ok {
+		t.Error("code accepted for lastUsedStep > step")
+	}
+	if _, ok := Validate(rfcSecret, code, now, step-1); !ok {
+		t.Error("code rejected for lastUsedStep < step")
+	}
+}
+
+func TestValidateNormalizesInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	if _, ok := Validate(rfcSecret, " 287 082 ", now, 0); !ok {
+		t.Error("code with spaces rejected")
+	}
+	if _, ok := Validate(rfcSecret, "28708", now, 0); ok {
+		t.Error("short code accepted")
+	}
+}